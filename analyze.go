@@ -2,6 +2,7 @@ package soyusage
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/robfig/soy/ast"
 	"github.com/robfig/soy/data"
@@ -13,6 +14,49 @@ import (
 type Config struct {
 	// RecursionDepth defines the number of levels to which a recursive call will be analyzed
 	RecursionDepth int
+	// Strict causes the analysis to fail if any usage cannot be determined,
+	// rather than recording unknown usage.
+	Strict bool
+	// StrictMode causes the analysis to fail if the result contains any unknown
+	// access, either a map key that could not be determined ([?]) or a param
+	// with unknown usage.
+	StrictMode bool
+	// OptionalTracking marks usage through variables derived from
+	// optional params as Optional.
+	OptionalTracking bool
+	// WarningHandler is called for each warning found during analysis
+	WarningHandler func(Warning)
+	// Memoize enables caching of the analysis of called templates, so templates
+	// called from multiple places with the same shape of params are only walked once.
+	Memoize bool
+	// Parallelism sets the number of templates analyzed concurrently by AnalyzeRegistry
+	Parallelism int
+	// MaxConstantKeys limits the number of constant keys recorded for each map
+	// from key expressions, such as $m[$k], with further keys recorded as an
+	// unknown key ([?]). The first keys found are kept, and range() only
+	// enumerates enough values to exceed the limit. A value less than 1 removes
+	// the limit.
+	MaxConstantKeys int
+	// MaxConstantVariants limits the number of constant values a {let} body
+	// made up of several conditional parts may take, as each combination of
+	// branches is a separate value. Bodies with more values are not constant.
+	// A value less than 1 removes the limit.
+	MaxConstantVariants int
+	// IgnoreLogStatements excludes usage within {log} blocks, for templates
+	// where logging is stripped in production.
+	IgnoreLogStatements bool
+	// Directives lists the fields used by custom print directives, keyed by
+	// the name of the directive. Values printed with one of these directives
+	// only use the listed fields, rather than the whole value.
+	Directives map[string][]string
+	// FastPath analyzes templates that only print params and their fields
+	// directly, such as {$profile.name}, without the scopes and constant
+	// value tracking needed for other templates.
+	FastPath bool
+	// Globals are the values of soy globals for templates compiled by LoadDir,
+	// LoadFS or NewAnalyzer. Other registries are given their globals when the
+	// bundle is compiled.
+	Globals data.Map
 }
 
 // Recursion sets the recursion depth for this analysis
@@ -23,15 +67,158 @@ func Recursion(depth int) Option {
 	}
 }
 
+// Strict enables strict mode for this analysis.
+// In strict mode, constructs that would result in unknown usage, such as
+// unrecognized functions or map keys with no constant values, are returned
+// together as a *StrictError.
+func Strict() Option {
+	return func(c Config) Config {
+		c.Strict = true
+		return c
+	}
+}
+
+// StrictMode causes the analysis to return an *UnknownAccessError listing the
+// paths to any unknown access in the result, instead of the result.
+// Unlike Strict, which reports each construct with unknown usage, this checks
+// the final parameter tree, so unknown access in templates that are called
+// is reported at the path it affects in the calling template.
+func StrictMode() Option {
+	return func(c Config) Config {
+		c.StrictMode = true
+		return c
+	}
+}
+
+// WithOptionalTracking enables or disables tracking of usage through variables
+// derived from optional params.
+func WithOptionalTracking(enabled bool) Option {
+	return func(c Config) Config {
+		c.OptionalTracking = enabled
+		return c
+	}
+}
+
+// Memoize enables or disables caching of the analysis of called templates.
+// Memoization is enabled by default.
+func Memoize(enabled bool) Option {
+	return func(c Config) Config {
+		c.Memoize = enabled
+		return c
+	}
+}
+
+// FastPath enables or disables the direct analysis of templates that only
+// print params and their fields. The result is the same either way.
+// The fast path is enabled by default.
+func FastPath(enabled bool) Option {
+	return func(c Config) Config {
+		c.FastPath = enabled
+		return c
+	}
+}
+
+// Parallelism sets the number of templates to be analyzed concurrently when
+// analyzing a whole registry.
+func Parallelism(workers int) Option {
+	return func(c Config) Config {
+		c.Parallelism = workers
+		return c
+	}
+}
+
+// MaxConstantKeys sets the maximum number of constant keys recorded for each map
+// from key expressions. Defaults to 64.
+func MaxConstantKeys(max int) Option {
+	return func(c Config) Config {
+		c.MaxConstantKeys = max
+		return c
+	}
+}
+
+// WithMaxConstantVariants sets the maximum number of constant values a {let} body
+// with several conditional parts may take. Defaults to 32.
+func WithMaxConstantVariants(max int) Option {
+	return func(c Config) Config {
+		c.MaxConstantVariants = max
+		return c
+	}
+}
+
+// IgnoreLogStatements enables or disables excluding usage within {log} blocks.
+// Log blocks are evaluated when rendering, so are analyzed by default.
+func IgnoreLogStatements(ignore bool) Option {
+	return func(c Config) Config {
+		c.IgnoreLogStatements = ignore
+		return c
+	}
+}
+
+// WithLogBlocksIncluded enables or disables recording usage within {log} blocks.
+// It is the inverse of IgnoreLogStatements.
+func WithLogBlocksIncluded(enabled bool) Option {
+	return IgnoreLogStatements(!enabled)
+}
+
+// Directive registers a custom print directive that uses only the given fields
+// of the value it is applied to, as dot-separated paths. For example, with
+// Directive("fullName", "first", "last"), {$user.name |fullName} uses the fields
+// $user.name.first and $user.name.last. A directive with no fields does not use
+// the value.
+func Directive(name string, fields ...string) Option {
+	return func(c Config) Config {
+		directives := make(map[string][]string)
+		for existing, existingFields := range c.Directives {
+			directives[existing] = existingFields
+		}
+		directives[name] = fields
+		c.Directives = directives
+		return c
+	}
+}
+
+// Globals sets the values of soy globals for templates compiled by LoadDir,
+// LoadFS or NewAnalyzer.
+func Globals(globals data.Map) Option {
+	return func(c Config) Config {
+		c.Globals = globals
+		return c
+	}
+}
+
 // Option defines a function that modifies the configuration for an analysis
 type Option func(Config) Config
 
 // AnalyzeTemplate walks the AST for the specified template and outputs a parameter
 // tree defining where and how those parameters are used.
+//
+// The registry is not modified, so a registry compiled from a soy.Bundle for
+// rendering may be analyzed directly without parsing the templates again.
 func AnalyzeTemplate(templateName string, registry *template.Registry, options ...Option) (Params, error) {
+	return analyzeTemplate(templateName, registry, newConfig(options...), newMemo())
+}
+
+func newConfig(options ...Option) Config {
+	config := Config{
+		RecursionDepth:      2,
+		Memoize:             true,
+		FastPath:            true,
+		MaxConstantKeys:     64,
+		MaxConstantVariants: 32,
+	}
+	for _, option := range options {
+		config = option(config)
+	}
+	return config
+}
+
+func analyzeTemplate(templateName string, registry *template.Registry, config Config, memo *memo) (Params, error) {
 	template, found := registry.Template(templateName)
 	if !found {
-		return nil, fmt.Errorf("template not found: %s", templateName)
+		return nil, &AnalysisError{
+			Template: templateName,
+			Err:      fmt.Errorf("template not found: %s", templateName),
+		}
 	}
 
 	s := &scope{
@@ -39,34 +226,63 @@ func AnalyzeTemplate(templateName string, registry *template.Registry, options .
 		templateName: templateName,
 		parameters:   make(Params),
 		variables:    make(map[Identifier][]*Param),
-		config: Config{
-			RecursionDepth: 2,
-		},
-	}
-	for _, option := range options {
-		s.config = option(s.config)
+		css:          newParam(),
+		xid:          newParam(),
+		unknowns:     new([]error),
+		memo:         memo,
+		config:       config,
 	}
 
 	// Add placeholders for all input variables
+	types := declaredTypes(registry, template)
 	for _, paramDoc := range template.Doc.Params {
-		s.parameters[Name(paramDoc.Name)] = newParam()
+		p := newParam()
+		p.optional = paramDoc.Optional && s.config.OptionalTracking
+		p.Type = types[docParamName(paramDoc)]
+		s.parameters[Name(docParamName(paramDoc))] = p
 	}
 
-	err := analyzeNode(s, usageUndefined, template.Node)
-	if err != nil {
+	// The analysis is memoized as for a call passing each param on with data="all",
+	// so it is reused by callers passing on their own params of the same names
+	if s.config.FastPath && isSimpleTemplate(s, template.Node.Body) {
+		analyzeSimpleTemplate(s, template.Node.Body)
+	} else if err := analyzeCallee(s, template.Node); err != nil {
 		return nil, err
 	}
+	if len(*s.unknowns) > 0 {
+		return nil, &StrictError{Errors: *s.unknowns}
+	}
 
 	// Filter out all the params that are not passed into this template
 	var filteredParams = make(Params)
 	for _, paramDoc := range template.Doc.Params {
-		name := Name(paramDoc.Name)
+		name := Name(docParamName(paramDoc))
 		if param, exists := s.parameters[name]; exists {
+			if len(param.Children) == 0 && len(param.Usage) == 0 {
+				s.warn(paramDoc, WarningUnusedParam, "param %v is never used", docParamName(paramDoc))
+			}
 			if !paramDoc.Optional || len(param.Children) > 0 || len(param.Usage) > 0 {
 				filteredParams[name] = param
 			}
 		}
 	}
+	if len(s.css.Children) > 0 {
+		filteredParams[CSSNames{}] = s.css
+	}
+	if len(s.xid.Children) > 0 {
+		filteredParams[XIDNames{}] = s.xid
+	}
+	subsumeIndexes(filteredParams)
+	limitKeys(s, template.Node, filteredParams, "")
+
+	if s.config.StrictMode {
+		if paths := unknownPaths(filteredParams, nil, isUnknownAccess); len(paths) > 0 {
+			return nil, &UnknownAccessError{
+				Template: templateName,
+				Paths:    paths,
+			}
+		}
+	}
 
 	return filteredParams, nil
 }
@@ -84,7 +300,7 @@ func analyzeNode(s *scope, usageType UsageType, node ...ast.Node) error {
 			case *ast.CallNode:
 				return analyzeCall(cs, v)
 			case *ast.CssNode:
-				return analyzeNode(s, UsageFull, v.Children()...)
+				return analyzeCss(cs, v)
 			case *ast.DataRefNode:
 				if _, err := recordDataRef(cs, usageType, v); err != nil {
 					return err
@@ -100,24 +316,98 @@ func analyzeNode(s *scope, usageType UsageType, node ...ast.Node) error {
 				if err != nil {
 					return wrapError(s, node, err)
 				}
-				cs.variables[Name(v.Var)] = variables
+				for _, variable := range variables {
+					if variable.isMapLiteral() {
+						cs.warn(v, WarningNonListIteration, "iterating over a map literal: %v", v.List)
+						break
+					}
+				}
+				if !holdsListLiteral(cs, v.List) {
+					for _, variable := range variables {
+						if !variable.isConstant() && !variable.isMapLiteral() {
+							variable.markList(true)
+						}
+					}
+				}
+				keysOf, err := mapKeysOf(cs, v.List)
+				if err != nil {
+					return wrapError(s, node, err)
+				}
 				constants, err := constantValues(cs, v.List)
 				if err != nil {
 					return wrapError(s, node, err)
 				}
-				cs.variables[Name(v.Var)] = appendConstants(cs.variables[Name(v.Var)], constants...)
-				return analyzeNode(cs, usageType, v.Body)
+				// The loop variable is only defined within the body, not the ifempty block
+				loop := cs.inner()
+				loop.loopVariable = Name(v.Var)
+				loop.variables[Name(v.Var)] = appendConstants(variables, constants...)
+				loop.setKeysOf(Name(v.Var), keysOf)
+				if err := analyzeNode(loop, usageType, v.Body); err != nil {
+					return err
+				}
+				if v.IfEmpty != nil {
+					return analyzeNode(cs, usageType, v.IfEmpty)
+				}
+				return nil
 			case *ast.FunctionNode:
+				if v.Name == "xid" {
+					return analyzeXid(cs, v)
+				}
 				var usage = UsageUnknown
-				switch v.Name {
-				case "isFirst", "isLast", "index", "isNonnull", "length":
+				switch functionName(v) {
+				case "isFirst", "isLast", "index":
+					// Loop position functions depend only on the position of a
+					// loop variable in its list, not on the value of the element
+					if isLoopVariableRef(cs, v.Args) {
+						return nil
+					}
+					cs.reportUnknown(v, "%v requires a loop variable", v)
+					return analyzeNode(cs, UsageUnknown, v.Args...)
+				case "isNonnull", "isNull":
+					usage = UsageExists
+				case "checkNotNull":
+					// The argument is passed through, so is used as the result would be
+					return analyzeNode(cs, usageType, v.Args...)
+				case "length":
 					usage = UsageMeta
 				case "keys":
-					usage = UsageMeta
-				case "augmentMap", "quoteKeysIfJs":
-					usage = UsageReference
-				case "round", "floor", "ceiling", "min", "max", "randomInt", "strContains":
+					usage = UsageKeys
+				case "list":
+					// The list constructor is equivalent to a list literal
+					return analyzeNode(cs, usageType, v.Args...)
+				case "map":
+					// The map constructor alternates keys, used in full, with values,
+					// which are used as the values of a map literal are
+					for i, arg := range v.Args {
+						argUsage := usageType
+						if i%2 == 0 {
+							argUsage = UsageFull
+						}
+						if err := analyzeNode(cs, argUsage, arg); err != nil {
+							return err
+						}
+					}
+					return nil
+				case "augmentMap", "quoteKeysIfJs", "concat":
+					// The result holds the values of every argument, so each is
+					// used as the result is, such as by keys(augmentMap($a, $b))
+					return analyzeNode(cs, usageType, v.Args...)
+				case "listFlat", "slice":
+					// The list is referenced, while other arguments are depths or bounds
+					if len(v.Args) == 0 {
+						return nil
+					}
+					if err := analyzeNode(cs, UsageReference, v.Args[0]); err != nil {
+						return err
+					}
+					return analyzeNode(cs, UsageFull, v.Args[1:]...)
+				case "round", "floor", "ceiling", "min", "max", "randomInt", "strContains", "range":
 					usage = UsageFull
+				case "strToAsciiLowerCase", "strToAsciiUpperCase", "strSub":
+					usage = UsageFull
+				}
+				if usage == UsageUnknown {
+					cs.reportUnknown(v, "unknown function %v", v)
 				}
 				return analyzeNode(cs, usage, v.Children()...)
 			case *ast.GlobalNode:
@@ -148,18 +438,35 @@ func analyzeNode(s *scope, usageType UsageType, node ...ast.Node) error {
 					return wrapError(s, node, err)
 				}
 				cs.variables[Name(v.Name)] = variables
+				cs.setListLiteral(Name(v.Name), false)
 			case *ast.LetValueNode:
 				variables, err := extractVariables(cs, v.Expr)
 				if err != nil {
 					return wrapError(s, node, err)
 				}
 				cs.variables[Name(v.Name)] = variables
+				cs.setListLiteral(Name(v.Name), holdsListLiteral(cs, v.Expr))
+				keyListOf, err := mapKeysOf(cs, v.Expr)
+				if err != nil {
+					return wrapError(s, node, err)
+				}
+				cs.setKeyListOf(Name(v.Name), keyListOf)
+				cs.setKeysOf(Name(v.Name), mapKeyOf(cs, v.Expr))
+				if referencesVariable(v.Expr, v.Name) {
+					// A let referring to an existing definition of the same variable,
+					// such as {let $x: concat($x, [$y])/} in a loop, accumulates values
+					// into that definition.
+					cs.accumulate(Name(v.Name), variables)
+				}
 				return nil
 			case *ast.ListLiteralNode:
 				return analyzeNode(cs, usageType, v.Items...)
 			case *ast.ListNode:
 				return analyzeNode(cs, usageType, v.Children()...)
 			case *ast.LogNode:
+				if cs.config.IgnoreLogStatements {
+					return nil
+				}
 				return analyzeNode(cs, UsageFull, v.Body)
 			case *ast.LtNode:
 				return analyzeNode(cs, UsageFull, v.Arg1, v.Arg2)
@@ -188,6 +495,9 @@ func analyzeNode(s *scope, usageType UsageType, node ...ast.Node) error {
 						return err
 					}
 				}
+				if v.Default != nil {
+					return analyzeNode(cs, usageType, v.Default)
+				}
 			case *ast.MulNode:
 				return analyzeNode(cs, UsageFull, v.Arg1, v.Arg2)
 			case *ast.NegateNode:
@@ -197,12 +507,16 @@ func analyzeNode(s *scope, usageType UsageType, node ...ast.Node) error {
 			case *ast.NotNode:
 				return analyzeNode(cs, UsageFull, v.Arg)
 			case *ast.PrintNode:
-				err := analyzeNode(cs, UsageFull, v.Arg)
-				if err != nil {
+				if err := analyzePrint(cs, v); err != nil {
 					return err
 				}
-				// Note, directives can be ignored as they are applied after
-				// the parameters are printed
+				// Arguments to directives are used as scalars, such as the
+				// length given to |truncate
+				for _, directive := range v.Directives {
+					if err := analyzeNode(cs, UsageFull, directive.Args...); err != nil {
+						return err
+					}
+				}
 			case *ast.SwitchNode:
 				if err := analyzeNode(cs, UsageFull, v.Value); err != nil {
 					return err
@@ -225,6 +539,7 @@ func analyzeNode(s *scope, usageType UsageType, node ...ast.Node) error {
 				return analyzeNode(cs, UsageFull, v.Arg1, v.Arg2)
 			case
 				*ast.StringNode,
+				// Includes the text of special characters, such as {lb}, {rb} and {sp}
 				*ast.RawTextNode,
 				*ast.NullNode,
 				*ast.LiteralNode,
@@ -236,7 +551,7 @@ func analyzeNode(s *scope, usageType UsageType, node ...ast.Node) error {
 				*ast.MsgHtmlTagNode,
 				nil:
 			default:
-				return fmt.Errorf("unexpected node type: %T", node)
+				return newErrorf(cs, node, "unexpected node type: %T", node)
 			}
 			return nil
 		}()
@@ -252,7 +567,7 @@ func findParams(
 	s *scope,
 	name Identifier,
 ) ([]*Param, error) {
-	if params, exist := s.variables[name]; exist {
+	if params, exist := s.variable(name); exist {
 		return params, nil
 	}
 	if _, exists := s.parameters[name]; !exists {
@@ -269,17 +584,43 @@ func constantValues(s *scope, node ast.Node) ([]interface{}, error) {
 		return []interface{}{v.Value}, nil
 	case *ast.IntNode:
 		return []interface{}{int(v.Value)}, nil
+	case *ast.FloatNode:
+		return []interface{}{v.Value}, nil
+	case *ast.BoolNode:
+		return []interface{}{v.True}, nil
+	case *ast.GlobalNode:
+		switch value := v.Value.(type) {
+		case data.String:
+			return []interface{}{string(value)}, nil
+		case data.Int:
+			return []interface{}{int(value)}, nil
+		case data.Float:
+			return []interface{}{float64(value)}, nil
+		case data.Bool:
+			return []interface{}{bool(value)}, nil
+		}
+		return []interface{}{nonConstant{}}, nil
 	case *ast.DataRefNode:
-		params, err := findParams(s, Name(v.Key))
+		params, err := resolveDataRef(s, v)
 		if err != nil {
 			return nil, wrapError(s, v, err)
 		}
-		var out []interface{}
+		var (
+			out  []interface{}
+			seen = make(map[interface{}]bool)
+		)
 		for _, param := range params {
+			if param.isMapLiteral() {
+				continue
+			}
+			var value interface{} = nonConstant{}
 			if param.isConstant() {
-				out = append(out, param.constant)
-			} else {
-				out = append(out, nonConstant{})
+				value = param.constant
+			}
+			// Variables assigned in several branches may repeat the same value
+			if !seen[value] {
+				seen[value] = true
+				out = append(out, value)
 			}
 		}
 		return out, nil
@@ -292,28 +633,51 @@ func constantValues(s *scope, node ast.Node) ([]interface{}, error) {
 		if err != nil {
 			return nil, wrapError(s, v, err)
 		}
-		var out = make(map[string]struct{})
-		for _, arg1 := range arg1Values {
-			for _, arg2 := range arg2Values {
-				_, arg1IsString := arg1.(string)
-				_, arg2IsString := arg2.(string)
-				if arg1IsString || arg2IsString {
-					out[fmt.Sprint(arg1)+fmt.Sprint(arg2)] = struct{}{}
-				}
+		return combineConstants(arg1Values, arg2Values, addConstants), nil
+	case *ast.SubNode:
+		return arithmeticConstants(s, v.Arg1, v.Arg2, func(a, b int) (int, bool) { return a - b, true })
+	case *ast.MulNode:
+		return arithmeticConstants(s, v.Arg1, v.Arg2, func(a, b int) (int, bool) { return a * b, true })
+	case *ast.DivNode:
+		// Division produces a float in Soy, so only exact results are used as keys
+		return arithmeticConstants(s, v.Arg1, v.Arg2, func(a, b int) (int, bool) {
+			if b == 0 {
+				return 0, false
 			}
-		}
-		return stringSetToInterface(out), nil
+			return a / b, a%b == 0
+		})
+	case *ast.ModNode:
+		return arithmeticConstants(s, v.Arg1, v.Arg2, func(a, b int) (int, bool) {
+			if b == 0 {
+				return 0, false
+			}
+			return a % b, true
+		})
 	case *ast.FunctionNode:
-		if v.Name == "keys" {
-			return constantValues(s, v.Args[0])
+		switch functionName(v) {
+		case "keys":
+			return constantKeys(s, v.Args[0])
+		case "checkNotNull":
+			if len(v.Args) == 1 {
+				return constantValues(s, v.Args[0])
+			}
+		case "list", "map", "concat", "slice", "listFlat", "augmentMap", "quoteKeysIfJs":
+			// Lists and maps have no constant value, and any constant elements
+			// are found when extracting the variables they contain
+			return nil, nil
+		}
+		if fn, isStringFunction := stringFunctions[functionName(v)]; isStringFunction {
+			return functionConstants(s, v, fn)
 		}
-		if v.Name == "range" {
-			var out = make(map[int]struct{})
+		if functionName(v) == "range" {
 			var (
-				starts     = []interface{}{0}
-				ends       []interface{}
-				increments = []interface{}{1}
-				err        error
+				values           []interface{}
+				seen             = make(map[int]struct{})
+				nonConstantBound bool
+				starts           = []interface{}{0}
+				ends             []interface{}
+				increments       = []interface{}{1}
+				err              error
 			)
 			if len(v.Args) == 1 {
 				ends, err = constantValues(s, v.Args[0])
@@ -334,41 +698,152 @@ func constantValues(s *scope, node ast.Node) ([]interface{}, error) {
 					return nil, wrapError(s, v, err)
 				}
 			}
+			// Only enough values to exceed the maximum constant keys are
+			// enumerated, any further values are unknown
+			limit := s.config.MaxConstantKeys + 1
+		enumerate:
 			for _, increment := range increments {
 				var (
 					incrementI, startI, endI int
 					isInt                    bool
 				)
-				if incrementI, isInt = increment.(int); !isInt {
+				if incrementI, isInt = increment.(int); !isInt || incrementI == 0 {
+					nonConstantBound = true
 					continue
 				}
 				for _, start := range starts {
 					for _, end := range ends {
 						if startI, isInt = start.(int); !isInt {
+							nonConstantBound = true
 							continue
 						}
 						if endI, isInt = end.(int); !isInt {
+							nonConstantBound = true
 							continue
 						}
-						for i := startI; i < endI; i += incrementI {
-							out[i] = struct{}{}
+						// A negative increment counts down from start towards end
+						for i := startI; (incrementI > 0 && i < endI) || (incrementI < 0 && i > endI); i += incrementI {
+							if _, found := seen[i]; found {
+								continue
+							}
+							if limit > 1 && len(values) == limit {
+								nonConstantBound = true
+								break enumerate
+							}
+							seen[i] = struct{}{}
+							values = append(values, i)
 						}
 					}
 				}
 			}
-			return intSetToInterface(out), nil
+			if nonConstantBound || len(starts) == 0 || len(ends) == 0 || len(increments) == 0 {
+				// The loop variable may take values that can't be determined
+				values = append(values, nonConstant{})
+			}
+			return values, nil
 		}
 		return []interface{}{nonConstant{}}, nil
 	}
 	return nil, nil
 }
 
-func intSetToInterface(set map[int]struct{}) []interface{} {
-	var r []interface{}
-	for val := range set {
-		r = append(r, val)
+// constantKeys returns the keys of any map literals the node may refer to.
+func constantKeys(s *scope, node ast.Node) ([]interface{}, error) {
+	var params []*Param
+	switch v := node.(type) {
+	case *ast.MapLiteralNode:
+		var out []interface{}
+		for key := range v.Items {
+			out = append(out, key)
+		}
+		return out, nil
+	case *ast.DataRefNode:
+		var err error
+		if params, err = resolveDataRef(s, v); err != nil {
+			return nil, wrapError(s, v, err)
+		}
 	}
-	return r
+	var out = make(map[string]struct{})
+	for _, param := range params {
+		if !param.isMapLiteral() {
+			return []interface{}{nonConstant{}}, nil
+		}
+		for key := range param.entries {
+			out[key] = struct{}{}
+		}
+	}
+	if len(params) == 0 {
+		return []interface{}{nonConstant{}}, nil
+	}
+	return stringSetToInterface(out), nil
+}
+
+// addConstants adds two constants as Soy would, concatenating if either is a string.
+func addConstants(a, b interface{}) (interface{}, bool) {
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	if aIsString || bIsString {
+		return fmt.Sprint(a) + fmt.Sprint(b), true
+	}
+	aInt, aIsInt := a.(int)
+	bInt, bIsInt := b.(int)
+	if aIsInt && bIsInt {
+		return aInt + bInt, true
+	}
+	return nil, false
+}
+
+// arithmeticConstants applies an integer operation to each pair of constant values of its arguments.
+func arithmeticConstants(s *scope, arg1, arg2 ast.Node, op func(a, b int) (int, bool)) ([]interface{}, error) {
+	arg1Values, err := constantValues(s, arg1)
+	if err != nil {
+		return nil, wrapError(s, arg1, err)
+	}
+	arg2Values, err := constantValues(s, arg2)
+	if err != nil {
+		return nil, wrapError(s, arg2, err)
+	}
+	return combineConstants(arg1Values, arg2Values, func(a, b interface{}) (interface{}, bool) {
+		aInt, aIsInt := a.(int)
+		bInt, bIsInt := b.(int)
+		if !aIsInt || !bIsInt {
+			return nil, false
+		}
+		return op(aInt, bInt)
+	}), nil
+}
+
+// combineConstants combines each pair of constant values with op, returning the distinct results.
+// If either value is not constant, or op cannot combine them, the result is not constant.
+// An argument with no known values is not constant.
+func combineConstants(arg1Values, arg2Values []interface{}, op func(a, b interface{}) (interface{}, bool)) []interface{} {
+	if len(arg1Values) == 0 {
+		arg1Values = []interface{}{nonConstant{}}
+	}
+	if len(arg2Values) == 0 {
+		arg2Values = []interface{}{nonConstant{}}
+	}
+	var (
+		out  []interface{}
+		seen = make(map[interface{}]bool)
+	)
+	for _, arg1 := range arg1Values {
+		for _, arg2 := range arg2Values {
+			var value interface{} = nonConstant{}
+			_, arg1NonConstant := arg1.(nonConstant)
+			_, arg2NonConstant := arg2.(nonConstant)
+			if !arg1NonConstant && !arg2NonConstant {
+				if result, ok := op(arg1, arg2); ok {
+					value = result
+				}
+			}
+			if !seen[value] {
+				seen[value] = true
+				out = append(out, value)
+			}
+		}
+	}
+	return out
 }
 
 func stringSetToInterface(set map[string]struct{}) []interface{} {
@@ -386,61 +861,229 @@ func extractConstantVariables(
 	if err := analyzeNode(s, UsageFull, node); err != nil {
 		return nil, wrapError(s, node, err)
 	}
-	if l, isList := node.(*ast.ListNode); isList && len(l.Nodes) == 1 {
-		var params []*Param
-		switch v := l.Nodes[0].(type) {
-		case *ast.RawTextNode:
-			p := newParam()
-			p.constant = v.String()
-			params = append(params, p)
-		case *ast.SwitchNode:
-			for _, c := range v.Cases {
-				p, err := extractConstantVariables(s, c.Body)
-				if err != nil {
-					return nil, wrapError(s, c, err)
-				}
-				params = append(params, p...)
-			}
-		case *ast.IfNode:
-			for _, c := range v.Conds {
-				p, err := extractConstantVariables(s, c.Body)
-				if err != nil {
-					return nil, wrapError(s, c, err)
-				}
-				params = append(params, p...)
-			}
-		case *ast.MsgPlaceholderNode:
-			p, err := extractConstantVariables(s, v.Body)
+	constants, err := bodyConstants(s, node)
+	if err != nil {
+		return nil, err
+	}
+	return appendConstants(nil, constants...), nil
+}
+
+// bodyConstants returns the possible constant values of the body of a {let} or
+// a branch within it.
+func bodyConstants(s *scope, node ast.Node) ([]interface{}, error) {
+	l, isList := node.(*ast.ListNode)
+	if !isList {
+		return nil, nil
+	}
+	switch len(l.Nodes) {
+	case 0:
+		// A body containing only whitespace is an empty string
+		return []interface{}{""}, nil
+	case 1:
+		constants, known, err := nodeConstants(s, l.Nodes[0])
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			return nil, newErrorf(s, l.Nodes[0], "unexpected type: %T", l.Nodes[0])
+		}
+		return constants, nil
+	}
+	return concatenatedConstants(s, l.Nodes)
+}
+
+// nodeConstants returns the possible constant values of a single node in the body
+// of a {let}, and whether the type of node is known.
+func nodeConstants(s *scope, node ast.Node) ([]interface{}, bool, error) {
+	var out []interface{}
+	switch v := node.(type) {
+	case *ast.RawTextNode:
+		if strings.TrimSpace(v.String()) == "" {
+			return []interface{}{""}, true, nil
+		}
+		return []interface{}{v.String()}, true, nil
+	case *ast.SwitchNode:
+		for _, c := range v.Cases {
+			constants, err := bodyConstants(s, c.Body)
 			if err != nil {
-				return nil, wrapError(s, v, err)
+				return nil, true, wrapError(s, c, err)
 			}
-			params = append(params, p...)
-		case *ast.MsgNode:
-			p, err := extractConstantVariables(s, v.Body)
+			out = append(out, constants...)
+		}
+	case *ast.IfNode:
+		for _, c := range v.Conds {
+			constants, err := bodyConstants(s, c.Body)
 			if err != nil {
-				return nil, wrapError(s, v, err)
+				return nil, true, wrapError(s, c, err)
 			}
-			params = append(params, p...)
-		case *ast.PrintNode:
-			constants, err := constantValues(s, v.Arg)
+			out = append(out, constants...)
+		}
+	case *ast.MsgNode:
+		constants, err := msgConstants(s, v.Body)
+		if err != nil {
+			return nil, true, wrapError(s, v, err)
+		}
+		out = constants
+	case *ast.PrintNode:
+		constants, err := constantValues(s, v.Arg)
+		if err != nil {
+			return nil, true, wrapError(s, v, err)
+		}
+		for _, value := range constants {
+			value, err = applyDirectivesToConstant(s, v, value)
 			if err != nil {
-				return nil, wrapError(s, v, err)
+				return nil, true, wrapError(s, v, err)
 			}
-			for _, value := range constants {
-				p := newParam()
-				p.constant, err = applyDirectivesToConstant(s, v, value)
+			out = append(out, value)
+		}
+	case *ast.CallNode:
+		constants, err := callConstants(s, v)
+		if err != nil {
+			return nil, true, wrapError(s, v, err)
+		}
+		out = constants
+	case *ast.ForNode:
+	default:
+		return nil, false, nil
+	}
+	return out, true, nil
+}
+
+// concatenatedConstants returns the possible values of a body made up of several
+// parts, as each combination of the values of those parts.
+// If there are more combinations than the configured maximum, the value is not constant.
+func concatenatedConstants(s *scope, nodes []ast.Node) ([]interface{}, error) {
+	var out = []interface{}{""}
+	for _, node := range nodes {
+		constants, _, err := nodeConstants(s, node)
+		if err != nil {
+			return nil, err
+		}
+		out = combineConstants(out, constants, addConstants)
+		if max := s.config.MaxConstantVariants; max > 0 && len(out) > max {
+			return []interface{}{nonConstant{}}, nil
+		}
+	}
+	return out, nil
+}
+
+// functionAliases maps the names of functions to the equivalent functions
+// handled by the analysis, such as the newer names of collection builtins.
+var functionAliases = map[string]string{
+	"listLen":     "length",
+	"mapKeys":     "keys",
+	"concatLists": "concat",
+}
+
+// functionName returns the name of the function called by a node, with aliases
+// resolved to the equivalent function.
+func functionName(node *ast.FunctionNode) string {
+	if name, isAlias := functionAliases[node.Name]; isAlias {
+		return name
+	}
+	return node.Name
+}
+
+// isLoopVariableRef returns true iff a function's arguments are a single
+// reference to a foreach loop variable.
+func isLoopVariableRef(s *scope, args []ast.Node) bool {
+	if len(args) != 1 {
+		return false
+	}
+	ref, isDataRef := args[0].(*ast.DataRefNode)
+	return isDataRef && len(ref.Access) == 0 && s.isLoopVariable(Name(ref.Key))
+}
+
+// msgConstants returns the possible values of a message body, made up of text
+// and placeholders. Placeholders printing constant values are folded into the text,
+// so {msg desc="..."}c_{'bio'}{/msg} has the value "c_bio".
+// A plural may take the value of any of its cases.
+func msgConstants(s *scope, body ast.ParentNode) ([]interface{}, error) {
+	var out = []interface{}{""}
+	for _, node := range body.Children() {
+		var values []interface{}
+		switch v := node.(type) {
+		case *ast.RawTextNode:
+			values = []interface{}{string(v.Text)}
+		case *ast.MsgPluralNode:
+			// The message may take the value of any case
+			bodies := []ast.ParentNode{v.Default}
+			for _, c := range v.Cases {
+				bodies = append(bodies, c.Body)
+			}
+			for _, body := range bodies {
+				if body == nil {
+					continue
+				}
+				constants, err := msgConstants(s, body)
 				if err != nil {
 					return nil, wrapError(s, v, err)
 				}
-				params = append(params, p)
+				if constants == nil {
+					constants = []interface{}{nonConstant{}}
+				}
+				values = append(values, constants...)
+			}
+		case *ast.MsgPlaceholderNode:
+			switch placeholder := v.Body.(type) {
+			case *ast.MsgHtmlTagNode:
+				values = []interface{}{string(placeholder.Text)}
+			case *ast.PrintNode:
+				constants, err := constantValues(s, placeholder.Arg)
+				if err != nil {
+					return nil, wrapError(s, placeholder, err)
+				}
+				for _, value := range constants {
+					value, err = applyDirectivesToConstant(s, placeholder, value)
+					if err != nil {
+						return nil, wrapError(s, placeholder, err)
+					}
+					values = append(values, value)
+				}
+			}
+			if len(values) == 0 {
+				values = []interface{}{nonConstant{}}
 			}
-		case *ast.CallNode, *ast.ForNode:
 		default:
-			return nil, newErrorf(s, v, "unexpected type: %T\n", v)
+			return nil, nil
 		}
-		return params, nil
+		out = combineConstants(out, values, addConstants)
 	}
-	return nil, nil
+	return out, nil
+}
+
+// analyzePrint records the usage of a printed value. The value is used in full,
+// unless the first directive applied to it is a custom directive using only
+// some of its fields.
+func analyzePrint(s *scope, node *ast.PrintNode) error {
+	if len(node.Directives) == 0 {
+		return analyzeNode(s, UsageFull, node.Arg)
+	}
+	fields, isCustom := s.config.Directives[node.Directives[0].Name]
+	if !isCustom {
+		return analyzeNode(s, UsageFull, node.Arg)
+	}
+	variables, err := extractVariables(s, node.Arg)
+	if err != nil {
+		return wrapError(s, node, err)
+	}
+	for _, variable := range variables {
+		if variable.isConstant() {
+			continue
+		}
+		for _, field := range fields {
+			param := variable
+			for _, name := range strings.Split(field, ".") {
+				param = param.getChildOrNew(Name(name))
+			}
+			param.addUsageToLeaves(Usage{
+				Type:     UsageFull,
+				Template: s.templateName,
+				node:     node,
+			})
+		}
+	}
+	return nil
 }
 
 // applyDirectivesToConstant will make best efforts to apply existing directives to a constant
@@ -455,6 +1098,9 @@ func applyDirectivesToConstant(s *scope, node *ast.PrintNode, constant interface
 	var result = data.New(constant)
 	for _, directiveNode := range node.Directives {
 		var directive, ok = soyhtml.PrintDirectives[directiveNode.Name]
+		if _, isCustom := s.config.Directives[directiveNode.Name]; !ok && isCustom {
+			return nonConstant{}, nil
+		}
 		if !ok {
 			return nil, newErrorf(s, directiveNode, "directive %q not found", directiveNode.Name)
 		}
@@ -491,6 +1137,12 @@ func extractVariables(
 		p := newParam()
 		p.constant = int(v.Value)
 		out = append(out, p)
+	case *ast.GlobalNode:
+		constants, err := constantValues(s, v)
+		if err != nil {
+			return nil, wrapError(s, v, err)
+		}
+		out = appendConstants(out, constants...)
 	case *ast.ListLiteralNode:
 		for _, item := range v.Items {
 			p, err := extractVariables(s, item)
@@ -500,13 +1152,16 @@ func extractVariables(
 			out = append(out, p...)
 		}
 	case *ast.MapLiteralNode:
-		for _, item := range v.Items {
-			p, err := extractVariables(s, item)
+		p := newParam()
+		p.entries = make(map[string][]*Param)
+		for key, item := range v.Items {
+			values, err := extractVariables(s, item)
 			if err != nil {
 				return nil, wrapError(s, item, err)
 			}
-			out = append(out, p...)
+			p.entries[key] = values
 		}
+		out = append(out, p)
 	case *ast.DataRefNode:
 		p, err := recordDataRef(s, UsageReference, v)
 		if err != nil {
@@ -545,7 +1200,39 @@ func extractVariables(
 		}
 		out = append(out, v2...)
 	case *ast.FunctionNode:
-		if v.Name == "augmentMap" || v.Name == "quoteKeysIfJs" {
+		if functionName(v) == "listFlat" && len(v.Args) > 0 {
+			// Flattening nests the elements of the list's elements directly in the
+			// result, and elements of nested lists share the param of the list
+			variables, err := extractVariables(s, v.Args[0])
+			if err != nil {
+				return nil, wrapError(s, node, err)
+			}
+			for _, variable := range variables {
+				if !variable.isConstant() && !variable.isMapLiteral() {
+					variable.markList(true)
+				}
+			}
+			out = append(out, variables...)
+			if err := analyzeNode(s, UsageFull, v.Args[1:]...); err != nil {
+				return nil, wrapError(s, node, err)
+			}
+		} else if functionName(v) == "slice" && len(v.Args) > 0 {
+			// A slice contains elements of the list, from bounds that need not be constant
+			variables, err := extractVariables(s, v.Args[0])
+			if err != nil {
+				return nil, wrapError(s, node, err)
+			}
+			out = append(out, variables...)
+			if err := analyzeNode(s, UsageFull, v.Args[1:]...); err != nil {
+				return nil, wrapError(s, node, err)
+			}
+		} else if functionName(v) == "map" {
+			variables, err := mapConstructorVariables(s, v)
+			if err != nil {
+				return nil, wrapError(s, node, err)
+			}
+			out = append(out, variables...)
+		} else if passesArgsThrough(functionName(v)) {
 			for _, arg := range v.Args {
 				variables, err := extractVariables(s, arg)
 				if err != nil {
@@ -553,9 +1240,26 @@ func extractVariables(
 				}
 				out = append(out, variables...)
 			}
-		} else {
-			analyzeNode(s, UsageUnknown, v.Children()...)
+		} else if err := analyzeNode(s, UsageUnknown, v); err != nil {
+			return nil, wrapError(s, node, err)
+		}
+		if !passesArgsThrough(functionName(v)) {
+			// Other functions produce a new value, which may not be constant
+			constants, err := constantValues(s, v)
+			if err != nil {
+				return nil, wrapError(s, node, err)
+			}
+			out = appendConstants(out, constants...)
 		}
+	case *ast.AddNode, *ast.SubNode, *ast.MulNode, *ast.DivNode, *ast.ModNode:
+		if err := analyzeNode(s, UsageFull, v.(ast.ParentNode).Children()...); err != nil {
+			return nil, wrapError(s, node, err)
+		}
+		constants, err := constantValues(s, v)
+		if err != nil {
+			return nil, wrapError(s, node, err)
+		}
+		out = appendConstants(out, constants...)
 	default:
 		type withChildren interface {
 			Children() []ast.Node
@@ -567,7 +1271,84 @@ func extractVariables(
 		}
 
 	}
-	return out, nil
+	return distinctParams(out), nil
+}
+
+// onlyConstants returns true if none of the params refer to data passed
+// into the template, such as when a value was produced by a function.
+func onlyConstants(params []*Param) bool {
+	for _, param := range params {
+		if !param.isConstant() {
+			return false
+		}
+	}
+	return true
+}
+
+// mapConstructorVariables returns the variables for a call to the map
+// constructor, map(key1, value1, key2, value2, ...), which is treated as the
+// equivalent map literal. Where a key is not constant, the values are used with
+// unknown usage instead.
+func mapConstructorVariables(s *scope, node *ast.FunctionNode) ([]*Param, error) {
+	var keys = make([][]interface{}, len(node.Args)/2)
+	for i := range keys {
+		constants, err := constantValues(s, node.Args[2*i])
+		if err != nil {
+			return nil, err
+		}
+		for _, constant := range constants {
+			if _, isNonConstant := constant.(nonConstant); isNonConstant {
+				constants = nil
+				break
+			}
+		}
+		if len(constants) == 0 {
+			return nil, analyzeNode(s, UsageUnknown, node)
+		}
+		keys[i] = constants
+	}
+	p := newParam()
+	p.entries = make(map[string][]*Param)
+	for i, constants := range keys {
+		values, err := extractVariables(s, node.Args[2*i+1])
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range constants {
+			name := fmt.Sprint(key)
+			p.entries[name] = append(p.entries[name], values...)
+		}
+	}
+	return []*Param{p}, nil
+}
+
+// passesArgsThrough returns true if the function with the given name
+// produces a value containing the variables passed as its arguments.
+func passesArgsThrough(name string) bool {
+	switch name {
+	case "listFlat", "slice", "augmentMap", "quoteKeysIfJs", "concat", "checkNotNull", "list":
+		return true
+	}
+	return false
+}
+
+// distinctParams removes repeated params, so values repeated across branches
+// don't multiply as they are assigned from one variable to another.
+func distinctParams(params []*Param) []*Param {
+	if len(params) < 2 {
+		return params
+	}
+	var (
+		out  = make([]*Param, 0, len(params))
+		seen = make(map[*Param]bool, len(params))
+	)
+	for _, param := range params {
+		if !seen[param] {
+			seen[param] = true
+			out = append(out, param)
+		}
+	}
+	return out
 }
 
 type nonConstant struct{}
@@ -593,7 +1374,7 @@ func templateParams(s *scope) []string {
 	}
 	var out []string
 	for _, param := range template.Doc.Params {
-		out = append(out, param.Name)
+		out = append(out, docParamName(param))
 	}
 	return out
 }
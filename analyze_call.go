@@ -1,16 +1,21 @@
 package soyusage
 
 import (
+	"strings"
+
 	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
 )
 
 func analyzeCall(
 	s *scope,
 	call *ast.CallNode,
 ) error {
+	warnUnrecognisedAttributes(s, call)
 	template, found := s.registry.Template(call.Name)
 	if !found {
-		return newErrorf(s, call, "template not found: %s", call.Name)
+		s.warn(call, WarningMissingTemplate, "template not found: %s", call.Name)
+		return analyzeMissingCall(s, call)
 	}
 
 	callScope := s.call(call.Name)
@@ -19,6 +24,24 @@ func analyzeCall(
 		return nil
 	}
 
+	if err := bindCall(s, callScope, call, template); err != nil {
+		return err
+	}
+
+	if err := analyzeCallee(callScope, template.Node); err != nil {
+		return wrapError(s, template.Node, err)
+	}
+	return nil
+}
+
+// bindCall populates the scope for a called template with the params and data
+// passed by the call.
+func bindCall(
+	s *scope,
+	callScope *scope,
+	call *ast.CallNode,
+	template template.Template,
+) error {
 	for _, parameter := range call.Params {
 		switch v := parameter.(type) {
 		case *ast.CallParamContentNode:
@@ -39,68 +62,125 @@ func analyzeCall(
 			}
 			n := Name(v.Key)
 			callScope.variables[n] = append(callScope.variables[n], variables...)
+			callScope.setListLiteral(n, holdsListLiteral(s, v.Value))
 		}
 	}
 
 	if call.AllData {
 		for _, templateParam := range template.Doc.Params {
-			paramName := Name(templateParam.Name)
+			paramName := Name(docParamName(templateParam))
 			if paramValue, exists := s.parameters[paramName]; exists {
 				callScope.parameters[paramName] = paramValue
 			}
-			if variableValues, exists := s.variables[paramName]; exists {
+			if variableValues, exists := s.variable(paramName); exists {
 				callScope.variables[paramName] = variableValues
 			}
 			_, paramPopulated := callScope.parameters[paramName]
 			_, variablePopulated := callScope.variables[paramName]
-			if !paramPopulated && !variablePopulated {
-				p := newParam()
-				if callScope.callCycles() == s.config.RecursionDepth {
-					p.addUsageToLeaves(Usage{
-						Type:     UsageFull,
-						Template: callScope.templateName,
-						node:     getNodeForName(s, templateParam.Name, call),
-					})
+			if paramPopulated || variablePopulated {
+				continue
+			}
+			if len(s.data) > 0 {
+				// A param this template does not declare is taken from its own data
+				for _, data := range s.data {
+					p := data.getChildOrNew(paramName)
+					if callScope.callCycles() == s.config.RecursionDepth {
+						p.addUsageToLeaves(Usage{
+							Type:     UsageFull,
+							Template: callScope.templateName,
+							node:     getNodeForName(s, docParamName(templateParam), call),
+						})
+					}
+					callScope.variables[paramName] = append(callScope.variables[paramName], p)
 				}
-				s.parameters[paramName] = p
-				callScope.parameters[paramName] = p
+				continue
+			}
+			p := newParam()
+			if callScope.callCycles() == s.config.RecursionDepth {
+				p.addUsageToLeaves(Usage{
+					Type:     UsageFull,
+					Template: callScope.templateName,
+					node:     getNodeForName(s, docParamName(templateParam), call),
+				})
 			}
+			s.parameters[paramName] = p
+			callScope.parameters[paramName] = p
 		}
+		callScope.data = append(callScope.data, s.data...)
 	}
 
 	if call.Data != nil {
-		variables, err := extractVariables(s, call.Data)
+		dataScope := s.inner()
+		dataScope.attribute = call
+		variables, err := extractVariables(dataScope, call.Data)
 		if err != nil {
-			return wrapError(s, call.Data, err)
+			return wrapError(dataScope, call.Data, err)
+		}
+		if onlyConstants(variables) {
+			dataScope.reportUnknown(call.Data, "cannot resolve data expression %v", call.Data)
+		}
+		// Params passed explicitly or with all data are not taken from the data
+		var passed = make(map[Identifier]bool)
+		for _, templateParam := range template.Doc.Params {
+			paramName := Name(docParamName(templateParam))
+			_, paramPopulated := callScope.parameters[paramName]
+			_, variablePopulated := callScope.variables[paramName]
+			passed[paramName] = paramPopulated || variablePopulated
 		}
+		// The data may be any of several maps, such as those merged by augmentMap,
+		// so each param is taken from all of them
 		for _, param := range variables {
-			for name, param := range param.Children {
-				callScope.variables[name] = append(callScope.variables[name], param)
+			if param.isMapLiteral() {
+				for key, values := range param.entries {
+					n := Name(key)
+					callScope.variables[n] = append(callScope.variables[n], values...)
+				}
+				continue
+			}
+			callScope.data = append(callScope.data, param)
+			for _, name := range sortedNames(param.Children) {
+				callScope.variables[name] = append(callScope.variables[name], param.Children[name])
 			}
 			for _, templateParam := range template.Doc.Params {
-				paramName := Name(templateParam.Name)
-				_, paramPopulated := callScope.parameters[paramName]
-				_, variablePopulated := callScope.variables[paramName]
-				if !paramPopulated && !variablePopulated {
-					p := newParam()
-					if callScope.callCycles() == s.config.RecursionDepth {
-						p.addUsageToLeaves(Usage{
-							Type:     UsageFull,
-							Template: callScope.templateName,
-							node:     getNodeForName(s, templateParam.Name, call),
-						})
-					}
-					param.Children[paramName] = p
-					callScope.parameters[paramName] = p
+				paramName := Name(docParamName(templateParam))
+				if _, exists := param.Children[paramName]; exists || passed[paramName] {
+					continue
 				}
+				p := param.getChildOrNew(paramName)
+				if callScope.callCycles() == s.config.RecursionDepth {
+					p.addUsageToLeaves(Usage{
+						Type:     UsageFull,
+						Template: callScope.templateName,
+						node:     getNodeForName(s, docParamName(templateParam), call),
+					})
+				}
+				callScope.variables[paramName] = append(callScope.variables[paramName], p)
 			}
 		}
 	}
+	return nil
+}
 
-	if err := analyzeNode(callScope, usageUndefined, template.Node); err != nil {
-		return wrapError(s, template.Node, err)
+// callConstants returns the possible constant values printed by a called
+// template, such as when the call makes up the body of a {let}.
+// Calls that are recursive beyond the recursion depth are not constant.
+func callConstants(s *scope, call *ast.CallNode) ([]interface{}, error) {
+	template, found := s.registry.Template(call.Name)
+	if !found {
+		return []interface{}{nonConstant{}}, nil
 	}
-	return nil
+	callScope := s.call(call.Name)
+	if callScope.callCycles() > s.config.RecursionDepth {
+		return []interface{}{nonConstant{}}, nil
+	}
+	if err := bindCall(s, callScope, call, template); err != nil {
+		return nil, err
+	}
+	constants, err := concatenatedConstants(callScope, template.Node.Body.Nodes)
+	if err != nil {
+		return nil, wrapError(s, call, err)
+	}
+	return constants, nil
 }
 
 func getNodeForName(
@@ -122,3 +202,139 @@ func getNodeForName(
 	}
 	return call
 }
+
+// analyzeMissingCall records unknown usage for all params passed to a call
+// where the called template could not be found.
+func analyzeMissingCall(
+	s *scope,
+	call *ast.CallNode,
+) error {
+	s.reportUnknown(call, "cannot resolve called template %v", call.Name)
+	for _, parameter := range call.Params {
+		switch v := parameter.(type) {
+		case *ast.CallParamContentNode:
+			if err := analyzeNode(s, UsageFull, v.Content); err != nil {
+				return wrapError(s, parameter, err)
+			}
+		case *ast.CallParamValueNode:
+			if err := analyzeNode(s, UsageUnknown, v.Value); err != nil {
+				return wrapError(s, parameter, err)
+			}
+		}
+	}
+	if call.AllData {
+		for _, name := range templateParams(s) {
+			params, err := findParams(s, Name(name))
+			if err != nil {
+				return wrapError(s, call, err)
+			}
+			for _, param := range params {
+				param.addUsageToLeaves(Usage{
+					Type:     UsageUnknown,
+					Template: s.templateName,
+					node:     call,
+				})
+			}
+		}
+	}
+	if call.Data != nil {
+		if err := analyzeNode(s, UsageUnknown, call.Data); err != nil {
+			return wrapError(s, call.Data, err)
+		}
+	}
+	return nil
+}
+
+// warnUnrecognisedAttributes warns of each attribute of the {param} commands of
+// a call that does not apply to the form of the param, and so is ignored, such as
+// a key attribute on a param named before its attributes, or a kind on a value param.
+// The source of the calling template is only looked up when warnings are recorded.
+func warnUnrecognisedAttributes(s *scope, call *ast.CallNode) {
+	if len(call.Params) == 0 || s.trace == nil && s.config.WarningHandler == nil {
+		return
+	}
+	t, found := s.registry.Template(s.templateName)
+	if !found {
+		return
+	}
+	src := templateSource(s.registry, t.Node)
+	for _, parameter := range call.Params {
+		var key string
+		switch v := parameter.(type) {
+		case *ast.CallParamContentNode:
+			key = v.Key
+		case *ast.CallParamValueNode:
+			key = v.Key
+		default:
+			continue
+		}
+		_, isValue := parameter.(*ast.CallParamValueNode)
+		named, attributes := paramAttributes(src, int(parameter.Position()))
+		for _, attribute := range attributes {
+			var recognised bool
+			switch attribute {
+			case "key":
+				recognised = !named
+			case "value":
+				recognised = isValue
+			case "kind":
+				recognised = !isValue
+			}
+			if !recognised {
+				s.warn(parameter, WarningUnrecognisedParamAttribute, "unrecognised attribute %v on param %v", attribute, key)
+			}
+		}
+	}
+}
+
+// paramAttributes lists the names of the attributes of the {param} command at
+// a position in a soy file, and whether the param is named before them, as in
+// {param name kind="text"}. The parser does not keep the attributes, so they
+// are read from the source.
+func paramAttributes(src string, pos int) (named bool, attributes []string) {
+	if pos < 0 || pos >= len(src) {
+		return false, nil
+	}
+	// The position of a param is that of the command name, following the delimiter
+	text := strings.TrimPrefix(src[pos:], "{")
+	if !strings.HasPrefix(text, "param") {
+		return false, nil
+	}
+	text = text[len("param"):]
+	skipSpace := func() {
+		text = strings.TrimLeft(text, " \t\r\n")
+	}
+	for {
+		skipSpace()
+		end := strings.IndexFunc(text, func(r rune) bool {
+			return !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+		})
+		if end <= 0 {
+			return named, attributes
+		}
+		name := text[:end]
+		text = text[end:]
+		skipSpace()
+		if !strings.HasPrefix(text, "=") {
+			named = true
+			continue
+		}
+		text = text[1:]
+		skipSpace()
+		if text == "" || text[0] != '"' && text[0] != '\'' {
+			return named, attributes
+		}
+		attributes = append(attributes, name)
+		quote := text[0]
+		var i int
+		for i = 1; i < len(text) && text[i] != quote; i++ {
+			if text[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(text) {
+			return named, attributes
+		}
+		text = text[i+1:]
+	}
+}
@@ -41,6 +41,84 @@ func TestAnalyzeCall(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "data passed on with all",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{call .card data="$profile"/}
+				{/template}
+
+				/**
+				* @param name
+				*/
+				{template .card}
+					{$name}
+					{if true}
+						{call .link data="all"/}
+					{/if}
+				{/template}
+
+				/**
+				* @param? url
+				* @param? title
+				*/
+				{template .link}
+					<a href="{$url}">{$title ?: $url}</a>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name":  "*",
+					"url":   "*",
+					"title": "*",
+				},
+			},
+		},
+		{
+			name: "data from a loop variable passed on with all",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				*/
+				{template .main}
+					{foreach $item in $items}
+						{call .item data="$item"/}
+					{/foreach}
+				{/template}
+
+				/**
+				* @param label
+				*/
+				{template .item}
+					{$label}
+					{call .link data="all"/}
+				{/template}
+
+				/**
+				* @param? url
+				*/
+				{template .link}
+					{$url}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"items": map[string]interface{}{
+					"label": "*",
+					"url":   "*",
+				},
+			},
+		},
 		{
 			name: "call params with all",
 			templates: map[string]string{
@@ -229,6 +307,245 @@ func TestAnalyzeCall(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "calls within param content are analyzed in the caller's data",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param user
+				* @param style
+				*/
+				{template .main}
+					{call .sub}
+						{param name}{call .computeName data="all" /}{/param}
+						{param style: $style/}
+					{/call}
+				{/template}
+
+				/**
+				* @param user
+				*/
+				{template .computeName}
+					{$user.first} {$user.last}
+				{/template}
+
+				/**
+				* @param name
+				* @param style
+				*/
+				{template .sub}
+					<span class="{$style.className}">{$name}</span>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"user": map[string]interface{}{
+					"first": "*",
+					"last":  "*",
+				},
+				"style": map[string]interface{}{
+					"className": "*",
+				},
+			},
+		},
+		{
+			name: "callee iterates over a list passed as a param",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param myList
+				* @param page
+				*/
+				{template .main}
+					{call .listRenderer}
+						{param items: $myList /}
+					{/call}
+					{call .listRenderer}
+						{param items: $page.related /}
+					{/call}
+				{/template}
+
+				/**
+				* @param items
+				*/
+				{template .listRenderer}
+					{foreach $item in $items}
+						{$item.title}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"myList": map[string]interface{}{
+					"[]": map[string]interface{}{
+						"title": "*",
+					},
+				},
+				"page": map[string]interface{}{
+					"related": map[string]interface{}{
+						"[]": map[string]interface{}{
+							"title": "*",
+						},
+					},
+				},
+			},
+		},
+		{
+			// The parser expands aliases when reading a call, so aliased calls
+			// resolve in the same way as relative calls. Only the {alias a.b.c}
+			// form is supported, {alias a.b.c as d} is rejected by the parser.
+			name: "calls through a namespace alias",
+			templates: map[string]string{
+				"main.soy": `
+				{namespace app.pages}
+				{alias app.widgets.cards}
+				/**
+				* @param primary
+				*/
+				{template .main}
+					{call cards.card data="$primary"/}
+				{/template}
+			`,
+				"cards.soy": `
+				{namespace app.widgets.cards}
+				/**
+				* @param secondary
+				*/
+				{template .list}
+					{call .card data="$secondary"/}
+				{/template}
+
+				/**
+				* @param title
+				* @param? subtitle
+				*/
+				{template .card}
+					{$title}
+					{if $subtitle}{$subtitle.text}{/if}
+				{/template}
+			`,
+			},
+			templateName: "app.pages.main",
+			expected: map[string]interface{}{
+				"primary": map[string]interface{}{
+					"title": "*",
+					"subtitle": map[string]interface{}{
+						"text": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "relative calls to an aliased template",
+			templates: map[string]string{
+				"main.soy": `
+				{namespace app.pages}
+				{alias app.widgets.cards}
+				/**
+				* @param primary
+				*/
+				{template .main}
+					{call cards.card data="$primary"/}
+				{/template}
+			`,
+				"cards.soy": `
+				{namespace app.widgets.cards}
+				/**
+				* @param secondary
+				*/
+				{template .list}
+					{call .card data="$secondary"/}
+				{/template}
+
+				/**
+				* @param title
+				* @param? subtitle
+				*/
+				{template .card}
+					{$title}
+					{if $subtitle}{$subtitle.text}{/if}
+				{/template}
+			`,
+			},
+			templateName: "app.widgets.cards.list",
+			expected: map[string]interface{}{
+				"secondary": map[string]interface{}{
+					"title": "*",
+					"subtitle": map[string]interface{}{
+						"text": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "param blocks with complex bodies",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param list
+				* @param a
+				*/
+				{template .main}
+					{call .sub}
+						{param items}
+							{foreach $x in $list}
+								{$x.name}
+								{if $x.flag}{$a[$x.key].title}{/if}
+							{/foreach}
+						{/param}
+						{param other kind="text"}
+							{let $y: $a.b /}
+							{$y.c}
+							{call .inner data="$a.d"/}
+						{/param}
+					{/call}
+				{/template}
+
+				/**
+				* @param items
+				* @param other
+				*/
+				{template .sub}
+					{$items}{$other}
+				{/template}
+
+				/**
+				* @param e
+				*/
+				{template .inner}
+					{$e}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"list": map[string]interface{}{
+					"[]": map[string]interface{}{
+						"name": "*",
+						"flag": "e",
+						"key":  "*",
+					},
+				},
+				"a": map[string]interface{}{
+					"[?]": map[string]interface{}{
+						"title": "*",
+					},
+					"b": map[string]interface{}{
+						"c": "*",
+					},
+					"d": map[string]interface{}{
+						"e": "*",
+					},
+				},
+			},
+		},
 	}
 	testAnalyze(t, tests)
 }
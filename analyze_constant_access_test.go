@@ -1,6 +1,14 @@
 package soyusage_test
 
-import "testing"
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
 
 // TestAnalyzeConstantMapAccess executes a set of tests to verify the Analyze function's handling
 // of using constant values to access map entries.
@@ -150,6 +158,189 @@ func TestAnalyzeConstantMapAccess(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "handles msg with constant placeholders",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param suffix
+				*/
+				{template .main}
+					{let $bio}
+						{msg desc="bio key"}{'c_bio'}{/msg}
+					{/let}
+					{let $about}
+						{msg desc="about key"}c_{'about' |noAutoescape}{/msg}
+					{/let}
+					{let $other}
+						{msg desc="other key"}c_{$suffix}{/msg}
+					{/let}
+					{$profile[$bio]}
+					{$profile[$about]}
+					{$profile[$other].name}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"c_bio":   "*",
+					"c_about": "*",
+					"[?]": map[string]interface{}{
+						"name": "*",
+					},
+				},
+				"suffix": "*",
+			},
+		},
+		{
+			name: "folds string functions with constant arguments",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param name
+				*/
+				{template .main}
+					{let $key: 'C_Bio' /}
+					{let $long: strSub('c_aboutLong', 0, 7) /}
+					{$profile[strToAsciiLowerCase($key)]}
+					{$profile[strToAsciiUpperCase('c_') + 'x']}
+					{$profile[$long]}
+					{$profile[strSub('c_homeAbout', 2)]}
+					{$profile[strToAsciiLowerCase($name)].value}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"c_bio":     "*",
+					"C_x":       "*",
+					"c_about":   "*",
+					"homeAbout": "*",
+					"[?]": map[string]interface{}{
+						"value": "*",
+					},
+				},
+				"name": "*",
+			},
+		},
+		{
+			name: "folds concatenation of constant lets",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param c
+				*/
+				{template .main}
+					{let $constLet: 'mid' /}
+					{let $branch}{if $c}a{else}b{/if}{/let}
+					{let $key: 'prefix_' + $constLet + '_suffix' /}
+					{$profile['prefix_' + $constLet + '_suffix']}
+					{$profile[$key + '_' + $branch]}
+					{$profile['v' + 1.5]}
+					{$profile['is_' + true]}
+					{$profile['n_' + null].value}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"prefix_mid_suffix":   "*",
+					"prefix_mid_suffix_a": "*",
+					"prefix_mid_suffix_b": "*",
+					"v1.5":                "*",
+					"is_true":             "*",
+					"[?]": map[string]interface{}{
+						"value": "*",
+					},
+				},
+				"c": "e",
+			},
+		},
+		{
+			name: "handles branches with constants of different lengths",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param flag
+				*/
+				{template .main}
+					{let $k}
+						{if $flag}short{else}a_much_longer_constant{/if}
+					{/let}
+					{$profile[$k]}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"short":                  "*",
+					"a_much_longer_constant": "*",
+				},
+				"flag": "e",
+			},
+		},
+		{
+			name: "handles msg with plural and nested plural cases",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param count
+				* @param other
+				*/
+				{template .main}
+					{let $field}
+						{msg desc="field for count"}
+							{plural $count}
+								{case 1}c_single
+								{default}c_multiple
+							{/plural}
+						{/msg}
+					{/let}
+					{$profile[$field]}
+					{msg desc="summary"}
+						{plural $other.count}
+							{case 0}none
+							{case 1}
+								{plural $other.nested}
+									{case 1}{$other.single}
+									{default}{$other.nestedMany}
+								{/plural}
+							{default}{$other.many}
+						{/plural}
+					{/msg}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"c_single":   "*",
+					"c_multiple": "*",
+				},
+				"count": "*",
+				"other": map[string]interface{}{
+					"count":      "*",
+					"nested":     "*",
+					"single":     "*",
+					"nestedMany": "*",
+					"many":       "*",
+				},
+			},
+		},
 		{
 			name: "handles mapping from a switch statement",
 			templates: map[string]string{
@@ -215,6 +406,58 @@ func TestAnalyzeConstantMapAccess(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "handles mapping from concatenated lists",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{foreach $item in concatLists(['c_a'], list('c_b', 'c_c'))}
+						{$profile[$item]}
+					{/foreach}
+					{foreach $key in mapKeys(['c_d': 1])}
+						{$profile[$key]}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"c_a": "*",
+					"c_b": "*",
+					"c_c": "*",
+					"c_d": "*",
+				},
+			},
+		},
+		{
+			name: "handles keys built from a list of integers",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{foreach $n in [1, 2, 3]}
+						{$profile['item' + $n]}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"item1": "*",
+					"item2": "*",
+					"item3": "*",
+				},
+			},
+		},
 		{
 			name: "handles map literal inside list",
 			templates: map[string]string{
@@ -331,6 +574,31 @@ func TestAnalyzeConstantMapAccess(t *testing.T) {
 			`,
 			},
 			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"first":  "*",
+					"second": "*",
+				},
+			},
+		},
+		{
+			name: "handles lookup in map literal via keys",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{let $m: ['edu': 'c_education', 'aw': 'c_awards']/}
+					{let $keys: keys($m)/}
+					{foreach $abbr in $keys}
+						{$profile[$m[$abbr]]}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
 			expected: map[string]interface{}{
 				"profile": map[string]interface{}{
 					"c_education": "*",
@@ -338,6 +606,166 @@ func TestAnalyzeConstantMapAccess(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "handles constant lookup in map literal",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param a
+				*/
+				{template .main}
+					{let $m: ['edu': 'c_education', 'aw': 'c_awards', 'other': $a]/}
+					{$profile[$m['edu']]}
+					{$m.other.b}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": "*",
+				},
+				"profile": map[string]interface{}{
+					"c_education": "*",
+				},
+			},
+		},
+		{
+			name: "handles one binding used in multiple map accesses",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile1
+				* @param profile2
+				*/
+				{template .main}
+					{let $k: 'c_field'/}
+					{let $k2: $k/}
+					{$profile1[$k]}
+					{$profile2[$k]}
+					{if $profile2[$k2]}
+						{$profile1[$k2]}
+					{/if}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile1": map[string]interface{}{
+					"c_field": "*",
+				},
+				"profile2": map[string]interface{}{
+					"c_field": "*",
+				},
+			},
+		},
+		{
+			name: "handles integer arithmetic in a constant key",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param map
+				*/
+				{template .main}
+					{let $prefix: 'field'/}
+					{let $n: 2/}
+					{let $key: $prefix + ($n * 3)/}
+					{$map[$key]}
+					{$map[$prefix + ($n + 1)]}
+					{$map[$prefix + (($n * 5 - 1) % 4)]}
+					{$map[$prefix + (7 - $n) / 5]}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"map": map[string]interface{}{
+					"field6": "*",
+					"field3": "*",
+					"field1": "*",
+				},
+			},
+		},
+		{
+			name: "handles division by zero in a constant key",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{for $i in range(3)}
+						{$a[6 / $i]}
+					{/for}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"[6]": "*",
+					"[3]": "*",
+					"[?]": "*",
+				},
+			},
+		},
+		{
+			name: "handles concatenation with a non-constant value",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param map
+				* @param suffix
+				*/
+				{template .main}
+					{$map['field' + $suffix]}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"suffix": "*",
+				"map": map[string]interface{}{
+					"[?]": "*",
+				},
+			},
+		},
+		{
+			name: "handles whitespace-only let body as empty string",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param other
+				*/
+				{template .main}
+					{let $empty}   {/let}
+					{let $multiline}
+					{/let}
+					{$profile[$empty]}
+					{$other[$multiline].field}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"": "*",
+				},
+				"other": map[string]interface{}{
+					"": map[string]interface{}{
+						"field": "*",
+					},
+				},
+			},
+		},
 		{
 			name: "handles mapping from an if statement",
 			templates: map[string]string{
@@ -412,6 +840,472 @@ func TestAnalyzeConstantMapAccess(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "constants printed by a called template",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param category
+				*/
+				{template .main}
+					{let $key}{call .fieldKey data="all"/}{/let}
+					{$profile[$key]}
+				{/template}
+
+				/**
+				* @param category
+				*/
+				{template .fieldKey}
+					{switch $category}
+						{case 'auto'}
+							c_autoAbout
+						{case 'home'}
+							{msg desc="key"}c_homeAbout{/msg}
+						{default}
+							c_about
+					{/switch}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"category": "*",
+				"profile": map[string]interface{}{
+					"c_autoAbout": "*",
+					"c_homeAbout": "*",
+					"c_about":     "*",
+				},
+			},
+		},
+		{
+			name: "constants passed to a called template",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{let $key}c_{call .suffix}{param name: 'about' /}{/call}{/let}
+					{$profile[$key]}
+				{/template}
+
+				/**
+				* @param name
+				*/
+				{template .suffix}
+					{$name}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"c_about": "*",
+				},
+			},
+		},
+		{
+			name: "non-constant prints in a called template",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param field
+				*/
+				{template .main}
+					{let $key}{call .fieldKey data="all"/}{/let}
+					{$profile[$key]}
+				{/template}
+
+				/**
+				* @param field
+				*/
+				{template .fieldKey}
+					{if $field}{$field}{else}c_about{/if}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"field": "*",
+				"profile": map[string]interface{}{
+					"c_about": "*",
+					"[?]":     "*",
+				},
+			},
+		},
+		{
+			name: "recursive calls are not constant",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{let $key}{call .fieldKey/}{/let}
+					{$profile[$key]}
+				{/template}
+
+				{template .fieldKey}
+					c_{call .fieldKey/}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"[?]": "*",
+				},
+			},
+		},
+		{
+			name: "typed let bodies are constant",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{let $textField kind="text"}
+						c_lifeAbout
+					{/let}
+					{let $htmlField kind="html"}
+						{if $profile.home}c_homeAbout{else}c_autoAbout{/if}
+					{/let}
+					{let $printed kind="text"}{$profile.name}{/let}
+					{$profile[$textField]}
+					{$profile[$htmlField]}
+					{$printed}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"c_lifeAbout": "*",
+					"c_homeAbout": "*",
+					"c_autoAbout": "*",
+					"home":        "e",
+					"name":        "*",
+				},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
+
+// nestedBranchesTemplate builds a template where each variable is assigned
+// from the previous one in each branch of a conditional, so the values of
+// the final variable depend on every preceding branch.
+func nestedBranchesTemplate(depth int) string {
+	var b strings.Builder
+	b.WriteString("{namespace test}\n/**\n * @param profile\n")
+	for i := 1; i < depth; i++ {
+		fmt.Fprintf(&b, " * @param c%d\n", i)
+	}
+	b.WriteString(" */\n{template .main}\n{let $v0: 'field'/}\n")
+	for i := 1; i < depth; i++ {
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "{let $v%d: $c%d ? $v%d : $v%d/}\n", i, i, i-1, i-1)
+			continue
+		}
+		fmt.Fprintf(&b, "{let $v%d}{if $c%d}{$v%d}{else}{$v%d}{/if}{/let}\n", i, i, i-1, i-1)
+	}
+	fmt.Fprintf(&b, "{$profile[$v%d]}\n{/template}\n", depth-1)
+	return b.String()
+}
+
+func TestAnalyzeNestedBranches(t *testing.T) {
+	got := analyzeSource(t, nestedBranchesTemplate(40))
+	must.BeEqual(t, map[string]interface{}{
+		"field": "*",
+	}, mapUsage(got)["profile"])
+}
+
+func BenchmarkAnalyzeNestedBranches(b *testing.B) {
+	for _, depth := range []int{4, 8, 12, 16} {
+		registry, err := soy.NewBundle().AddTemplateString("test.soy", nestedBranchesTemplate(depth)).Compile()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := soyusage.AnalyzeTemplate("test.main", registry); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// letChainTemplate builds a template where each variable is assigned the previous one,
+// so a constant must be propagated through every assignment.
+func letChainTemplate(depth int) string {
+	var b strings.Builder
+	b.WriteString("{namespace test}\n/**\n * @param map\n */\n{template .main}\n{let $v1: 'key'/}\n")
+	for i := 2; i <= depth; i++ {
+		fmt.Fprintf(&b, "{let $v%d: $v%d/}\n", i, i-1)
+	}
+	fmt.Fprintf(&b, "{$map[$v%d]}\n{/template}\n", depth)
+	return b.String()
+}
+
+func TestAnalyzeLetChain(t *testing.T) {
+	for _, depth := range []int{50, 5000} {
+		t.Run(fmt.Sprintf("depth=%d", depth), func(t *testing.T) {
+			got := analyzeSource(t, letChainTemplate(depth))
+			must.BeEqual(t, map[string]interface{}{
+				"map": map[string]interface{}{
+					"key": "*",
+				},
+			}, mapUsage(got))
+		})
+	}
+}
+
+func TestAnalyzeConstantVariants(t *testing.T) {
+	const template = `
+		{namespace test}
+		/**
+		* @param profile
+		* @param category
+		* @param a
+		* @param b
+		*/
+		{template .main}
+			{let $field}
+				{switch $category}
+					{case 'auto'}
+						{if $a}c_auto{else}c_car{/if}_{if $b}about{else}bio{/if}
+					{default}
+						{if $a}c_home{else}c_house{/if}
+				{/switch}
+			{/let}
+			{$profile[$field]}
+		{/template}
+	`
+	var tests = []analyzeTest{
+		{
+			name: "combinations of branches are enumerated",
+			templates: map[string]string{
+				"test.soy": template,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"c_auto_about": "*",
+					"c_auto_bio":   "*",
+					"c_car_about":  "*",
+					"c_car_bio":    "*",
+					"c_home":       "*",
+					"c_house":      "*",
+				},
+				"category": "*",
+				"a":        "e",
+				"b":        "e",
+			},
+		},
+		{
+			name: "combinations beyond the limit are unknown",
+			templates: map[string]string{
+				"test.soy": template,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.WithMaxConstantVariants(3)},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"[?]":     "*",
+					"c_home":  "*",
+					"c_house": "*",
+				},
+				"category": "*",
+				"a":        "e",
+				"b":        "e",
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
+
+func TestAnalyzeConstantKeyLimit(t *testing.T) {
+	const rangedAccess = `
+		{namespace test}
+		/**
+		* @param profile
+		* @param other
+		*/
+		{template .main}
+			{foreach $i in range(4)}
+				{$profile['field' + $i]}
+			{/foreach}
+			{let $k}
+				{if $profile}a{else}a{/if}
+			{/let}
+			{$other[$k]}
+		{/template}
+	`
+	var tests = []analyzeTest{
+		{
+			name: "keys within the default limit are unaffected",
+			templates: map[string]string{
+				"test.soy": rangedAccess,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"field0": "*",
+					"field1": "*",
+					"field2": "*",
+					"field3": "*",
+				},
+				"other": map[string]interface{}{
+					"a": "*",
+				},
+			},
+		},
+		{
+			name: "keys beyond the limit are collapsed",
+			templates: map[string]string{
+				"test.soy": rangedAccess,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.MaxConstantKeys(2)},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"field0": "*",
+					"field1": "*",
+					"[?]":    "*",
+				},
+				"other": map[string]interface{}{
+					"a": "*",
+				},
+			},
+		},
+		{
+			name: "limit applies to keys from all expressions on the same map",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param m
+				*/
+				{template .main}
+					{let $a: 'a'/}
+					{let $b: 'b'/}
+					{let $c: 'c'/}
+					{$m[$a]}{$m[$a]}{$m[$b]}
+					{$m[$c].value}
+					{$m.field}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.MaxConstantKeys(2)},
+			expected: map[string]interface{}{
+				"m": map[string]interface{}{
+					"a":     "*",
+					"b":     "*",
+					"field": "*",
+					"[?]": map[string]interface{}{
+						"value": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "keys are kept in the order they are found",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param m
+				*/
+				{template .main}
+					{let $z: 'z'/}
+					{let $y: 'y'/}
+					{let $x: 'x'/}
+					{$m[$z]}{$m[$y]}{$m[$x]}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.MaxConstantKeys(2)},
+			expected: map[string]interface{}{
+				"m": map[string]interface{}{
+					"z":   "*",
+					"y":   "*",
+					"[?]": "*",
+				},
+			},
+		},
+		{
+			name: "large ranges are limited as they are enumerated",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param m
+				*/
+				{template .main}
+					{for $i in range(100000000)}
+						{$m['field' + $i]}
+					{/for}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.MaxConstantKeys(2)},
+			expected: map[string]interface{}{
+				"m": map[string]interface{}{
+					"field0": "*",
+					"field1": "*",
+					"[?]":    "*",
+				},
+			},
+		},
+		{
+			name: "limit can be removed",
+			templates: map[string]string{
+				"test.soy": rangedAccess,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.MaxConstantKeys(0)},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"field0": "*",
+					"field1": "*",
+					"field2": "*",
+					"field3": "*",
+				},
+				"other": map[string]interface{}{
+					"a": "*",
+				},
+			},
+		},
 	}
 	testAnalyze(t, tests)
+
+	registry, err := soy.NewBundle().AddTemplateString("test.soy", rangedAccess).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	_, err = soyusage.AnalyzeTemplate("test.main", registry,
+		soyusage.MaxConstantKeys(1),
+		soyusage.Warnings(func(w soyusage.Warning) {
+			warnings = append(warnings, w.String())
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, []string{
+		"test.soy:9:15 in template test.main: map profile has more than 1 constant keys (truncated-keys)",
+	}, warnings)
 }
@@ -0,0 +1,64 @@
+package soyusage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/robfig/soy/ast"
+)
+
+// analyzeCss records the class name referenced by a {css} command.
+// Where the command includes a prefix expression, any params in that
+// expression are recorded with UsageCSSReference, and the class name is
+// only listed in full if the prefix is constant.
+func analyzeCss(s *scope, node *ast.CssNode) error {
+	usage := Usage{
+		Type:     UsageCSSReference,
+		Template: s.templateName,
+		node:     node,
+	}
+	suffix := cssSuffix(node)
+	if node.Expr == nil {
+		s.css.getChildOrNew(Name(suffix)).addUsageToLeaves(usage)
+		return nil
+	}
+
+	if err := analyzeNode(s, UsageCSSReference, node.Expr); err != nil {
+		return wrapError(s, node, err)
+	}
+	prefixes, err := constantValues(s, node.Expr)
+	if err != nil {
+		return wrapError(s, node, err)
+	}
+	if len(prefixes) == 0 {
+		prefixes = []interface{}{nonConstant{}}
+	}
+	for _, prefix := range prefixes {
+		if _, isNonConstant := prefix.(nonConstant); isNonConstant {
+			s.css.getChildOrNew(MapIndex{}).getChildOrNew(Name(suffix)).addUsageToLeaves(usage)
+			continue
+		}
+		name := fmt.Sprintf("%v-%v", prefix, suffix)
+		s.css.getChildOrNew(Name(name)).addUsageToLeaves(usage)
+	}
+	return nil
+}
+
+// cssSuffix returns the class name given to a {css} command.
+//
+// The parser reads the function form, {css($prefix, 'name')}, as command
+// text, leaving the closing parenthesis and quotes around the name.
+func cssSuffix(node *ast.CssNode) string {
+	suffix := node.Suffix
+	if !strings.HasSuffix(suffix, ")") {
+		return suffix
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(suffix, ")"), "("))
+	if len(name) >= 2 && (name[0] == '\'' || name[0] == '"') && name[len(name)-1] == name[0] {
+		return name[1 : len(name)-1]
+	}
+	if strings.HasPrefix(suffix, "(") {
+		return name
+	}
+	return suffix
+}
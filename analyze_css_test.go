@@ -0,0 +1,167 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestAnalyzeCss(t *testing.T) {
+	var tests = []analyzeTest{
+		{
+			name: "literal class names are listed",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					<div class="{css foo} {css bar-baz}">{$a}</div>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": "*",
+				"$css": map[string]interface{}{
+					"foo":     "c",
+					"bar-baz": "c",
+				},
+			},
+		},
+		{
+			name: "variable prefixes are recorded",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param component
+				*/
+				{template .main}
+					<div class="{css $component.name, foo}"></div>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"component": map[string]interface{}{
+					"name": "c",
+				},
+				"$css": map[string]interface{}{
+					"[?]": map[string]interface{}{
+						"foo": "c",
+					},
+				},
+			},
+		},
+		{
+			name: "constant prefixes are resolved",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				{template .main}
+					{let $prefix: 'widget'/}
+					<div class="{css $prefix, foo}"></div>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"$css": map[string]interface{}{
+					"widget-foo": "c",
+				},
+			},
+		},
+		{
+			name: "class names in called templates are listed",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				{template .main}
+					{call .callee/}
+				{/template}
+
+				{template .callee}
+					<div class="{css inner}"></div>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"$css": map[string]interface{}{
+					"inner": "c",
+				},
+			},
+		},
+		{
+			name: "function form literal class names are listed",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				{template .main}
+					<div class="{css('foo')} {css('bar')}"></div>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"$css": map[string]interface{}{
+					"foo": "c",
+					"bar": "c",
+				},
+			},
+		},
+		{
+			name: "function form with a param prefix and literal name",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param base
+				* @param component
+				*/
+				{template .main}
+					<div class="{css($base, 'suffix')} {css($component.name, 'title')}"></div>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"base": "c",
+				"component": map[string]interface{}{
+					"name": "c",
+				},
+				"$css": map[string]interface{}{
+					"[?]": map[string]interface{}{
+						"suffix": "c",
+						"title":  "c",
+					},
+				},
+			},
+		},
+		{
+			name: "global prefixes are resolved",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				{template .main}
+					<div class="{css WIDGET_PREFIX, foo}"></div>
+				{/template}
+			`,
+			},
+			globals: data.Map{
+				"WIDGET_PREFIX": data.String("widget"),
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"$css": map[string]interface{}{
+					"widget-foo": "c",
+				},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
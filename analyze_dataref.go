@@ -1,6 +1,8 @@
 package soyusage
 
-import "github.com/robfig/soy/ast"
+import (
+	"github.com/robfig/soy/ast"
+)
 
 func recordDataRef(
 	s *scope,
@@ -16,6 +18,9 @@ func recordDataRef(
 		return nil, wrapError(s, node, err)
 	}
 
+	_, isVariable := s.variable(Name(node.Key))
+	elements := s.isListLiteral(Name(node.Key))
+
 	var out []*Param
 
 	for _, param := range params {
@@ -23,7 +28,7 @@ func recordDataRef(
 		if param.isConstant() {
 			continue
 		}
-		leaves, err := recordDataRefAccess(s, usageType, param, node.Access)
+		leaves, err := recordDataRefAccess(s, usageType, param, node.Access, elements)
 		if err != nil {
 			return nil, wrapError(s, node, err)
 		}
@@ -32,6 +37,7 @@ func recordDataRef(
 			leaf.addUsageToLeaves(Usage{
 				Template: s.templateName,
 				Type:     usageType,
+				Optional: isVariable && leaf.optional,
 				node:     node,
 			})
 		}
@@ -41,48 +47,249 @@ func recordDataRef(
 	return out, nil
 }
 
+// recordDataRefAccess follows a sequence of accesses from a param, returning the
+// params accessed. If elements is set, the param is an element of a list literal,
+// so an index into the list refers to the param itself.
 func recordDataRefAccess(s *scope,
 	usageType UsageType,
 	param *Param,
-	access []ast.Node) ([]*Param, error) {
+	access []ast.Node,
+	elements bool) ([]*Param, error) {
 	if len(access) == 0 {
 		return []*Param{param}, nil
 	}
 
 	head := access[0]
-	var names []interface{}
+	names, err := accessNames(s, head)
+	if err != nil {
+		return nil, wrapError(s, head, err)
+	}
+	expr, isExpr := head.(*ast.DataRefExprNode)
+	if isExpr {
+		err = analyzeNode(s, UsageFull, expr.Arg)
+		if err != nil {
+			return nil, wrapError(s, head, err)
+		}
+	}
+	var out []*Param
+	for _, n := range names {
+		var nextParams []*Param
+		switch paramName := n.(type) {
+		case string:
+			_, exists := param.Children[Name(paramName)]
+			if param.isMapLiteral() {
+				nextParams = param.entries[paramName]
+			} else if isExpr && !exists && param.keyLimitReached(s.config.MaxConstantKeys) {
+				// Keys beyond the limit are recorded as they are found, so
+				// the first keys in the order they were found are kept
+				param.markTruncated()
+				nextParams = []*Param{param.getChildOrNew(MapIndex{})}
+			} else {
+				child := param.getChildOrNew(Name(paramName))
+				if isExpr {
+					child.markKeyed()
+				}
+				nextParams = []*Param{child}
+			}
+		default:
+			if elements {
+				// Indexing into a list literal refers to one of its elements
+				nextParams = []*Param{param}
+			} else {
+				nextParams = indexParams(s, param, head, n)
+			}
+		}
+		for _, nextParam := range nextParams {
+			if nextParam.isConstant() {
+				continue
+			}
+			leaves, err := recordDataRefAccess(s, usageType, nextParam, access[1:], false)
+			if err != nil {
+				return nil, wrapError(s, head, err)
+			}
+			out = append(out, leaves...)
+		}
+	}
+	return out, nil
+}
+
+// indexParams returns the params accessed by a non-string key or index.
+//
+// A constant index accesses a single element of a list. A variable index into
+// a param declared as a list may access any element, so is treated as iterating
+// over the list. Otherwise, the param may be a map with unknown keys.
+func indexParams(s *scope, param *Param, head ast.Node, index interface{}) []*Param {
+	if param.isMapLiteral() {
+		if _, isIndex := index.(int); isIndex {
+			return []*Param{param}
+		}
+		return param.allEntries()
+	}
+	switch index := index.(type) {
+	case int:
+		param.markList(false)
+		return []*Param{param.getChildOrNew(ListIndex(index))}
+	case nonConstant:
+		if param.Type.Elem() != nil {
+			param.markList(true)
+			return []*Param{param}
+		}
+		if !indexesOwnKeys(s, head, param) {
+			s.reportUnknown(head, "cannot resolve map key expression %v", head)
+		}
+	}
+	return []*Param{param.getChildOrNew(MapIndex{})}
+}
+
+// indexesOwnKeys returns true iff an access indexes a param by one of its own
+// keys, such as $m[$k] in {foreach $k in keys($m)}, or $m[$keys[0]] after
+// {let $keys: keys($m)/}. Every key of the param is then accessed, rather
+// than unknown keys.
+func indexesOwnKeys(s *scope, head ast.Node, param *Param) bool {
+	expr, isExpr := head.(*ast.DataRefExprNode)
+	if !isExpr {
+		return false
+	}
+	return containsParam(mapKeyOf(s, expr.Arg), param)
+}
+
+// resolveDataRef finds the params a data ref may refer to without recording
+// any usage. Access into map literals is followed to the matching entries,
+// access into any other param resolves to the param itself.
+func resolveDataRef(s *scope, node *ast.DataRefNode) ([]*Param, error) {
+	return resolveDataRefAccess(s, node, false)
+}
+
+// resolveRecordedDataRef finds the params a data ref may refer to, as
+// resolveDataRef, but follows access into params other than map literals to
+// the children already recorded for that access, such as $m.labels.
+func resolveRecordedDataRef(s *scope, node *ast.DataRefNode) ([]*Param, error) {
+	return resolveDataRefAccess(s, node, true)
+}
+
+func resolveDataRefAccess(s *scope, node *ast.DataRefNode, children bool) ([]*Param, error) {
+	params, err := findParams(s, Name(node.Key))
+	if err != nil {
+		return nil, wrapError(s, node, err)
+	}
+	for _, head := range node.Access {
+		names, err := accessNames(s, head)
+		if err != nil {
+			return nil, wrapError(s, head, err)
+		}
+		var next []*Param
+		for _, param := range params {
+			if !param.isMapLiteral() {
+				if !children {
+					next = append(next, param)
+					continue
+				}
+				for _, n := range names {
+					if child := param.Children[accessIdentifier(n)]; child != nil {
+						next = append(next, child)
+					}
+				}
+				continue
+			}
+			for _, n := range names {
+				switch paramName := n.(type) {
+				case int:
+					next = append(next, param)
+				case nonConstant:
+					next = append(next, param.allEntries()...)
+				case string:
+					next = append(next, param.entries[paramName]...)
+				}
+			}
+		}
+		params = next
+	}
+	return params, nil
+}
+
+// accessIdentifier returns the identifier of the child of a param recorded
+// for a key or index returned by accessNames.
+func accessIdentifier(name interface{}) Identifier {
+	switch name := name.(type) {
+	case string:
+		return Name(name)
+	case int:
+		return ListIndex(name)
+	}
+	return MapIndex{}
+}
+
+// accessNames returns the possible keys or indices for a single access
+// within a data ref.
+func accessNames(s *scope, head ast.Node) ([]interface{}, error) {
 	switch access := head.(type) {
 	case *ast.DataRefKeyNode:
-		names = []interface{}{access.Key}
+		return []interface{}{access.Key}, nil
 	case *ast.DataRefIndexNode:
-		names = []interface{}{access.Index}
+		return []interface{}{access.Index}, nil
 	case *ast.DataRefExprNode:
 		constantValues, err := constantValues(s, access.Arg)
 		if err != nil {
 			return nil, wrapError(s, access, err)
 		}
-		names = append(names, constantValues...)
-		err = analyzeNode(s, UsageFull, access.Arg)
-		if err != nil {
-			return nil, wrapError(s, access, err)
+		return constantValues, nil
+	}
+	return nil, nil
+}
+
+// limitKeys warns of each map in a tree with constant keys beyond the configured
+// maximum, at the first usage of its unknown key ([?]) within the template, or
+// the template itself.
+//
+// Keys beyond the maximum are recorded as an unknown key as they are found. Keys
+// found separately, such as by the analyses of different calls, may together
+// exceed the maximum, so these are collapsed into the unknown key here. As the
+// order they were found in is not known, the keys are sorted and those after
+// the first keys in that order are collapsed.
+func limitKeys(s *scope, node ast.Node, params Params, path string) {
+	max := s.config.MaxConstantKeys
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		paramPath := joinUsagePath(path, name.String())
+		limitKeys(s, node, param.Children, paramPath)
+
+		var keys []Identifier
+		for _, childName := range sortedNames(param.Children) {
+			if _, isName := childName.(Name); isName && param.Children[childName].keyed {
+				keys = append(keys, childName)
+			}
+		}
+		if max > 0 && len(keys) > max {
+			unknown := param.getChildOrNew(MapIndex{})
+			for _, key := range keys[max:] {
+				unknown.merge(param.Children[key])
+				delete(param.Children, key)
+			}
+			param.truncated = true
+		}
+		if !param.truncated {
+			continue
 		}
+		position := firstUsageNode(param.Children[MapIndex{}], s.templateName)
+		if position == nil {
+			position = node
+		}
+		s.warn(position, WarningTruncatedKeys, "map %v has more than %d constant keys", paramPath, max)
 	}
-	var out []*Param
-	for _, n := range names {
-		var nextParam *Param
-		switch paramName := n.(type) {
-		case int:
-			nextParam = param
-		case nonConstant:
-			nextParam = param.getChildOrNew(MapIndex{})
-		case string:
-			nextParam = param.getChildOrNew(Name(paramName))
+}
+
+// firstUsageNode returns the node of the first usage within a template of a param
+// or any of its fields, or nil if there is none.
+func firstUsageNode(param *Param, templateName string) ast.Node {
+	for _, usage := range param.Usage {
+		if usage.Template == templateName && usage.node != nil {
+			return usage.node
 		}
-		leaves, err := recordDataRefAccess(s, usageType, nextParam, access[1:])
-		if err != nil {
-			return nil, wrapError(s, head, err)
+	}
+	for _, name := range sortedNames(param.Children) {
+		if node := firstUsageNode(param.Children[name], templateName); node != nil {
+			return node
 		}
-		out = append(out, leaves...)
 	}
-	return out, nil
+	return nil
 }
@@ -1,6 +1,11 @@
 package soyusage_test
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
 
 func TestAnalyzeForLoops(t *testing.T) {
 	var tests = []analyzeTest{
@@ -42,6 +47,728 @@ func TestAnalyzeForLoops(t *testing.T) {
 			`,
 			},
 			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"[0]": map[string]interface{}{
+						"b": "*",
+					},
+					"[1]": map[string]interface{}{
+						"b": "*",
+					},
+					"[2]": map[string]interface{}{
+						"b": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "foreach and length on the same list",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				*/
+				{template .main}
+					{if length($items) > 0}
+						{foreach $item in $items}
+							{$item.name}
+						{/foreach}
+					{/if}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"items": map[string]interface{}{
+					"name": "*",
+				},
+			},
+		},
+		{
+			name: "length after foreach on the same list",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				*/
+				{template .main}
+					{foreach $item in $items}
+						{$item.name}
+					{/foreach}
+					{length($items)} items
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"items": map[string]interface{}{
+					"name": "*",
+				},
+			},
+		},
+		{
+			name: "length assigned before foreach on the same list",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param list
+				* @param extra
+				*/
+				{template .main}
+					{let $count: length($list)/}
+					{foreach $item in $list}
+						{$item.name}
+					{/foreach}
+					{if $count > 5}
+						{$extra.field}
+					{/if}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"list": map[string]interface{}{
+					"name": "*",
+				},
+				"extra": map[string]interface{}{
+					"field": "*",
+				},
+			},
+		},
+		{
+			name: "for loop with a constant let bound",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{let $n: 3/}
+					{let $step: 2/}
+					{for $i in range(1, $n)}
+						{$profile['a' + $i]}
+					{/for}
+					{for $i in range(0, $n * 2, $step)}
+						{$profile['b' + $i]}
+					{/for}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"a1": "*",
+					"a2": "*",
+					"b0": "*",
+					"b2": "*",
+					"b4": "*",
+				},
+			},
+		},
+		{
+			name: "for loop with a param bound",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param n
+				*/
+				{template .main}
+					{let $start: 1/}
+					{for $i in range($start, $n)}
+						{$profile['a' + $i]}
+					{/for}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"n": "*",
+				"profile": map[string]interface{}{
+					"[?]": "*",
+				},
+			},
+		},
+		{
+			name: "for loop with an arithmetic param bound",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param n
+				*/
+				{template .main}
+					{for $i in range(1, $n - 1)}
+						{$profile['a' + $i]}
+					{/for}
+					{for $i in range($n)}
+						{$profile.list[$i].name}
+					{/for}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"n": "*",
+				"profile": map[string]interface{}{
+					"[?]": "*",
+					"list": map[string]interface{}{
+						"[?]": map[string]interface{}{
+							"name": "*",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "for loop with a negative or zero step",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{for $i in range(3, 0, -1)}
+						{$profile['a' + $i]}
+					{/for}
+					{for $i in range(0, 3, 0)}
+						{$profile['b' + $i]}
+					{/for}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"a1":  "*",
+					"a2":  "*",
+					"a3":  "*",
+					"[?]": "*",
+				},
+			},
+		},
+		{
+			// The parser does not support {foreach $item, $index in $list}, so the
+			// index is obtained with index($item)
+			name: "loop index used as a key is an unknown key",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param list
+				* @param labels
+				*/
+				{template .main}
+					{foreach $item in $list}
+						{let $index: index($item) /}
+						{$labels[$index]}: {$item.name}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"list": map[string]interface{}{
+					"name": "*",
+				},
+				"labels": map[string]interface{}{
+					"[?]": "*",
+				},
+			},
+		},
+		{
+			name: "foreach over a flattened list",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param nestedList
+				*/
+				{template .main}
+					{foreach $item in listFlat($nestedList, 1)}
+						{$item.name}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"nestedList": map[string]interface{}{
+					"[]": map[string]interface{}{
+						"name": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "foreach over keys of a param",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param labels
+				*/
+				{template .main}
+					{foreach $k in keys($profile)}
+						{$profile[$k]}
+					{/foreach}
+					{foreach $k in keys($labels)}
+						{$k}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"[?]": "*",
+				},
+				"labels": "k",
+			},
+		},
+		{
+			name: "keys of a param assigned to a variable",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param links
+				* @param labels
+				*/
+				{template .main}
+					{let $keys: keys($profile)/}
+					{foreach $k in $keys}
+						{$profile[$k].name}
+					{/foreach}
+					{let $linkKeys: keys($links)/}
+					{let $first: $linkKeys[0]/}
+					{$links[$first].url}
+					{$links[$linkKeys[1]].title}
+					{foreach $k in keys($labels.byId)}
+						{$labels.byId[$k]}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"[?]": map[string]interface{}{
+						"name": "*",
+					},
+				},
+				"links": map[string]interface{}{
+					"[?]": map[string]interface{}{
+						"url":   "*",
+						"title": "*",
+					},
+				},
+				"labels": map[string]interface{}{
+					"byId": map[string]interface{}{
+						"[?]": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "ifempty accesses a different param",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param empty
+				*/
+				{template .main}
+					{foreach $x in $a.items}
+						{$x.name}
+					{ifempty}
+						{$empty.message}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"items": map[string]interface{}{
+						"name": "*",
+					},
+				},
+				"empty": map[string]interface{}{
+					"message": "*",
+				},
+			},
+		},
+		{
+			name: "ifempty accesses the parent of the list",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{foreach $x in $a.items}
+						{$x.name}
+					{ifempty}
+						{$a.fallback}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"items": map[string]interface{}{
+						"name": "*",
+					},
+					"fallback": "*",
+				},
+			},
+		},
+		{
+			name: "ifempty uses the enclosing definition of the loop variable",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				*/
+				{template .main}
+					{let $x: $b /}
+					{foreach $x in $a}
+						{$x.name}
+					{ifempty}
+						{$x.fallback}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"name": "*",
+				},
+				"b": map[string]interface{}{
+					"fallback": "*",
+				},
+			},
+		},
+		{
+			name: "foreach over a slice with a param bound",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param list
+				* @param n
+				*/
+				{template .main}
+					{foreach $item in slice($list, 0, $n)}
+						{$item.name}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"list": map[string]interface{}{
+					"[]": map[string]interface{}{
+						"name": "*",
+					},
+				},
+				"n": "*",
+			},
+		},
+		{
+			name: "length alone gives meta usage",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				*/
+				{template .main}
+					{if length($items) > 0}
+						Has items
+					{/if}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"items": "m",
+			},
+		},
+		{
+			name: "foreach over a list accumulated in a loop",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param list
+				*/
+				{template .main}
+					{let $filtered: []/}
+					{foreach $item in $list}
+						{if $item.active}
+							{let $filtered: concat($filtered, [$item])/}
+						{/if}
+					{/foreach}
+					{foreach $item in $filtered}
+						{$item.name}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"list": map[string]interface{}{
+					"active": "e",
+					"name":   "*",
+				},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
+
+func TestAnalyzeLengthAndForeachUsage(t *testing.T) {
+	got := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param list
+		*/
+		{template .main}
+			{let $count: length($list)/}
+			{foreach $item in $list}
+				{$item.name}
+			{/foreach}
+			{$count}
+		{/template}
+	`)
+	var hasMeta bool
+	for _, usage := range got[soyusage.Name("list")].Usage {
+		hasMeta = hasMeta || usage.Type == soyusage.UsageMeta
+	}
+	must.BeEqual(t, true, hasMeta, "length of list should be recorded as meta usage")
+	must.BeEqual(t, 1, len(got[soyusage.Name("list")].Children[soyusage.Name("name")].Usage))
+}
+
+func TestAnalyzeListMarkers(t *testing.T) {
+	var tests = []analyzeTest{
+		{
+			name: "iterated params are lists",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param m
+				*/
+				{template .main}
+					{foreach $item in $a}
+						{$item.b}
+					{/foreach}
+					{$m.b}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"[]": map[string]interface{}{
+						"b": "*",
+					},
+				},
+				"m": map[string]interface{}{
+					"b": "*",
+				},
+			},
+		},
+		{
+			name: "index access marks a list",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				*/
+				{template .main}
+					{$items[0].name}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"items": map[string]interface{}{
+					"[0]": map[string]interface{}{
+						"name": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "iteration subsumes constant indexes",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				*/
+				{template .main}
+					{$items[0].name}
+					{$items[1].id}
+					{foreach $item in $items}{$item.label}{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"items": map[string]interface{}{
+					"[]": map[string]interface{}{
+						"name":  "*",
+						"id":    "*",
+						"label": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "variable index on an untyped list is an unknown key",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				* @param i
+				*/
+				{template .main}
+					{$items[0].name}
+					{$items[$i].id}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"items": map[string]interface{}{
+					"[0]": map[string]interface{}{
+						"name": "*",
+					},
+					"[]": map[string]interface{}{
+						"[?]": map[string]interface{}{
+							"id": "*",
+						},
+					},
+				},
+				"i": "*",
+			},
+		},
+		{
+			name: "list literals are not lists of params",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				*/
+				{template .main}
+					{foreach $x in [$a, $b]}{$x.name}{/foreach}
+					{let $l: [$a] /}
+					{$l[0].id}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"name": "*",
+					"id":   "*",
+				},
+				"b": map[string]interface{}{
+					"name": "*",
+				},
+			},
+		},
+		{
+			name: "nested lists and lists in called templates",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param groups
+				*/
+				{template .main}
+					{foreach $group in $groups}
+						{call .group}
+							{param group: $group/}
+						{/call}
+					{/foreach}
+				{/template}
+
+				/**
+				* @param group
+				*/
+				{template .group}
+					{$group.title}
+					{foreach $member in $group.members}
+						{$member.name}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			listMarkers:  true,
+			expected: map[string]interface{}{
+				"groups": map[string]interface{}{
+					"[]": map[string]interface{}{
+						"title": "*",
+						"members": map[string]interface{}{
+							"[]": map[string]interface{}{
+								"name": "*",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "markers are not rendered by default",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{foreach $item in $a}
+						{$item.b}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
 			expected: map[string]interface{}{
 				"a": map[string]interface{}{
 					"b": "*",
@@ -1,6 +1,10 @@
 package soyusage_test
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/theothertomelliott/soyusage"
+)
 
 // TestAnalyzeFunctions verifies behavior when analyzing function calls
 func TestAnalyzeFunctions(t *testing.T) {
@@ -41,12 +45,180 @@ func TestAnalyzeFunctions(t *testing.T) {
 			`,
 			},
 			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"[0]": map[string]interface{}{
+						"b": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "loop position functions do not affect usage",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				* @param others
+				*/
+				{template .main}
+					{foreach $item in $items}
+						{if isFirst($item)}first{/if}
+						{if not isLast($item)},{/if}
+						{index($item)}
+					{/foreach}
+					{foreach $other in $others}
+						{if isFirst($other)}{$other.name}{/if}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"items": map[string]interface{}{},
+				"others": map[string]interface{}{
+					"name": "*",
+				},
+			},
+		},
+		{
+			name: "index does not affect usage",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{foreach $item in $a}
+						{let $i: index($item) /}
+						{$i + 1}: {$item.b}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
 			expected: map[string]interface{}{
 				"a": map[string]interface{}{
 					"b": "*",
 				},
 			},
 		},
+		{
+			name: "null checks are existence checks",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{if isNonnull($a.b)}
+						{$a.b.c}
+					{/if}
+					{if isNull($a.d)}missing{/if}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": map[string]interface{}{
+						"c": "*",
+					},
+					"d": "e",
+				},
+			},
+		},
+		{
+			name: "checkNotNull passes its argument through",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{let $b: checkNotNull($a.b) /}
+					{$b.c}
+					{checkNotNull($a.d)}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": map[string]interface{}{
+						"c": "*",
+					},
+					"d": "*",
+				},
+			},
+		},
+		{
+			name: "collection builtins are handled as their equivalents",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				* @param c
+				*/
+				{template .main}
+					{listLen($a)}
+					{foreach $k in mapKeys($b)}{$k}{/foreach}
+					{foreach $x in concatLists($c, [1])}{$x.name}{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"a": "m",
+				"b": "k",
+				"c": map[string]interface{}{
+					"name": "*",
+				},
+			},
+		},
+		{
+			name: "map constructor is handled as a map literal",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param friend
+				* @param key
+				* @param other
+				*/
+				{template .main}
+					{let $m: map('name', $profile.name, 'friend', $friend) /}
+					{$m.name}
+					{$m.friend.email}
+					{let $n: map($key, $other) /}
+					{$n.x}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": "*",
+				},
+				"friend": map[string]interface{}{
+					"email": "*",
+				},
+				"key":   "*",
+				"other": "?",
+			},
+		},
 		{
 			name: "augmentMap adds to both maps",
 			templates: map[string]string{
@@ -100,6 +272,134 @@ func TestAnalyzeFunctions(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "known function in a let value",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{let $count: length($a.list)/}
+					{$count}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"list": "m",
+				},
+			},
+		},
+		{
+			name: "nested augmentMap adds to all maps",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				* @param c
+				* @param d
+				*/
+				{template .main}
+					{let $x: augmentMap(augmentMap($a, $b), $c)/}
+					{let $y: augmentMap($a, augmentMap($b, $d))/}
+					{$x.e}
+					{$y.f}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"e": "*",
+					"f": "*",
+				},
+				"b": map[string]interface{}{
+					"e": "*",
+					"f": "*",
+				},
+				"c": map[string]interface{}{
+					"e": "*",
+				},
+				"d": map[string]interface{}{
+					"f": "*",
+				},
+			},
+		},
+		{
+			name: "nested augmentMap as a function argument",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				* @param c
+				*/
+				{template .main}
+					{foreach $key in keys(augmentMap(augmentMap($a, $b), $c))}
+						{$key}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": "k",
+				"b": "k",
+				"c": "k",
+			},
+		},
+		{
+			name: "nested augmentMap as call data",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				* @param c
+				*/
+				{template .main}
+					{call .callee data="augmentMap(augmentMap($a, $b), $c)"/}
+				{/template}
+
+				/**
+				* @param title
+				* @param? subtitle
+				*/
+				{template .callee}
+					{$title}
+					{$subtitle?.text}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"title": "*",
+					"subtitle": map[string]interface{}{
+						"text": "*",
+					},
+				},
+				"b": map[string]interface{}{
+					"title": "*",
+					"subtitle": map[string]interface{}{
+						"text": "*",
+					},
+				},
+				"c": map[string]interface{}{
+					"title": "*",
+					"subtitle": map[string]interface{}{
+						"text": "*",
+					},
+				},
+			},
+		},
 	}
 	testAnalyze(t, tests)
 }
@@ -0,0 +1,70 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/soyusage"
+)
+
+// TestAnalyzeLogBlocks verifies that usage within {log} blocks is recorded unless ignored
+func TestAnalyzeLogBlocks(t *testing.T) {
+	const template = `
+		{namespace test}
+		/**
+		* @param profile
+		* @param debug
+		*/
+		{template .main}
+			{$profile.name}
+			{log}
+				{$profile.debugInfo} {$debug}
+			{/log}
+			{debugger}
+		{/template}
+	`
+	var tests = []analyzeTest{
+		{
+			name: "log blocks are analyzed by default",
+			templates: map[string]string{
+				"test.soy": template,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name":      "*",
+					"debugInfo": "*",
+				},
+				"debug": "*",
+			},
+		},
+		{
+			name: "log blocks are skipped when ignored",
+			templates: map[string]string{
+				"test.soy": template,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.IgnoreLogStatements(true)},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": "*",
+				},
+				"debug": map[string]interface{}{},
+			},
+		},
+		{
+			name: "log blocks are skipped when not included",
+			templates: map[string]string{
+				"test.soy": template,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.WithLogBlocksIncluded(false)},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": "*",
+				},
+				"debug": map[string]interface{}{},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
@@ -0,0 +1,74 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestAnalyzeOptionalTracking(t *testing.T) {
+	var templates = map[string]string{
+		"test.soy": `
+		{namespace test}
+		/**
+		* @param required
+		* @param? opt
+		*/
+		{template .main}
+			{let $x: $opt/}
+			{let $y: $required/}
+			{$x.field}
+			{$y.field}
+			{$opt.direct}
+			{call .callee}
+				{param p: $opt.sub/}
+			{/call}
+		{/template}
+
+		/**
+		* @param p
+		*/
+		{template .callee}
+			{$p.inner}
+		{/template}
+	`,
+	}
+	var tests = []analyzeTest{
+		{
+			name:         "optional tracking disabled",
+			templates:    templates,
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"required": map[string]interface{}{
+					"field": "*",
+				},
+				"opt": map[string]interface{}{
+					"field":  "*",
+					"direct": "*",
+					"sub": map[string]interface{}{
+						"inner": "*",
+					},
+				},
+			},
+		},
+		{
+			name:         "optional tracking enabled",
+			templates:    templates,
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.WithOptionalTracking(true)},
+			expected: map[string]interface{}{
+				"required": map[string]interface{}{
+					"field": "*",
+				},
+				"opt": map[string]interface{}{
+					"field":  "~optional~",
+					"direct": "*",
+					"sub": map[string]interface{}{
+						"inner": "~optional~",
+					},
+				},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
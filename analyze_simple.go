@@ -0,0 +1,70 @@
+package soyusage
+
+import "github.com/robfig/soy/ast"
+
+// isSimpleTemplate returns true iff a template body contains only raw text and
+// prints of declared params or their fields, accessed by name, such as
+// {$profile.name}. These can be analyzed without creating scopes or tracking
+// constant values, as there are no variables, branches or calls.
+func isSimpleTemplate(s *scope, body *ast.ListNode) bool {
+	if body == nil {
+		return false
+	}
+	for _, node := range body.Nodes {
+		switch v := node.(type) {
+		case *ast.RawTextNode:
+		case *ast.PrintNode:
+			if !isSimplePrint(s, v) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isSimplePrint returns true iff a print node only uses a declared param or a
+// field of one, as a whole.
+func isSimplePrint(s *scope, node *ast.PrintNode) bool {
+	for _, directive := range node.Directives {
+		// Custom directives use only some fields, and arguments are expressions
+		if _, isCustom := s.config.Directives[directive.Name]; isCustom || len(directive.Args) > 0 {
+			return false
+		}
+	}
+	ref, isRef := node.Arg.(*ast.DataRefNode)
+	if !isRef {
+		return false
+	}
+	if _, declared := s.parameters[Name(ref.Key)]; !declared {
+		return false
+	}
+	for _, access := range ref.Access {
+		if _, isKey := access.(*ast.DataRefKeyNode); !isKey {
+			return false
+		}
+	}
+	return true
+}
+
+// analyzeSimpleTemplate records the usage of a template body for which
+// isSimpleTemplate is true, giving the same result as analyzeNode.
+func analyzeSimpleTemplate(s *scope, body *ast.ListNode) {
+	for _, node := range body.Nodes {
+		print, isPrint := node.(*ast.PrintNode)
+		if !isPrint {
+			continue
+		}
+		ref := print.Arg.(*ast.DataRefNode)
+		param := s.parameters[Name(ref.Key)]
+		for _, access := range ref.Access {
+			param = param.getChildOrNew(Name(access.(*ast.DataRefKeyNode).Key))
+		}
+		param.addUsageToLeaves(Usage{
+			Template: s.templateName,
+			Type:     UsageFull,
+			node:     ref,
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package soyusage_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestAnalyzeFastPath(t *testing.T) {
+	var tests = []struct {
+		name     string
+		body     string
+		expected map[string]interface{}
+	}{
+		{
+			name: "direct access",
+			body: `
+				<h1>{$profile.name.first} {$profile.name.last}</h1>
+				{$profile.name.first}
+				{$title |escapeHtml}
+			`,
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": map[string]interface{}{
+						"first": "*",
+						"last":  "*",
+					},
+				},
+				"title": "*",
+			},
+		},
+		{
+			name: "param used as a whole and by field",
+			body: `{$profile}{$profile.name}{$title}`,
+			expected: map[string]interface{}{
+				"profile": "*",
+				"title":   "*",
+			},
+		},
+		{
+			name: "conditional is not simple",
+			body: `{if $title}{$profile.name}{/if}`,
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": "*",
+				},
+				"title": "e",
+			},
+		},
+		{
+			name: "directive arguments are not simple",
+			body: `{$profile.name |truncate:$title}`,
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": "*",
+				},
+				"title": "*",
+			},
+		},
+		{
+			name: "custom directive is not simple",
+			body: `{$profile |fullName}{$title}`,
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"first": "*",
+				},
+				"title": "*",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry, err := soy.NewBundle().AddTemplateString("test.soy", `
+				{namespace test}
+				/**
+				* @param profile
+				* @param title
+				*/
+				{template .main}
+					`+test.body+`
+				{/template}
+			`).Compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fast, err := soyusage.AnalyzeTemplate("test.main", registry, soyusage.Directive("fullName", "first"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			full, err := soyusage.AnalyzeTemplate("test.main", registry, soyusage.Directive("fullName", "first"), soyusage.FastPath(false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			must.BeEqual(t, test.expected, mapUsage(fast))
+			must.BeEqual(t, mapUsageFull(registry, full), mapUsageFull(registry, fast), "fast path result differs")
+		})
+	}
+}
+
+func BenchmarkAnalyzeFastPath(b *testing.B) {
+	registry, err := soy.NewBundle().AddTemplateString("test.soy", `
+		{namespace test}
+		/**
+		* @param profile
+		* @param title
+		*/
+		{template .main}
+			<h1>{$title}</h1>
+			<p>{$profile.name.first} {$profile.name.last}</p>
+			<p>{$profile.address.city}, {$profile.address.country}</p>
+		{/template}
+	`).Compile()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, fastPath := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fastPath=%v", fastPath), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := soyusage.AnalyzeTemplate("test.main", registry, soyusage.FastPath(fastPath)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package soyusage_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestAnalyzeStrict(t *testing.T) {
+	var tests = []analyzeTest{
+		{
+			name: "known usage is unaffected",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{let $key: 'b'/}
+					{if length($a.list) > 0}
+						{$a[$key]}
+					{/if}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b":    "*",
+					"list": "m",
+				},
+			},
+		},
+		{
+			name: "unknown functions are errors",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{myFunc($a.b)}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected:     map[string]interface{}{},
+			expectedErr: errors.New(`1 unknown usages:
+test.soy:7:14 in template test.main: unknown function myFunc($a.b)`),
+		},
+		{
+			name: "loop functions require a loop variable",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{if isFirst($a.b)}first{/if}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected:     map[string]interface{}{},
+			expectedErr: errors.New(`1 unknown usages:
+test.soy:7:18 in template test.main: isFirst($a.b) requires a loop variable`),
+		},
+		{
+			name: "keys of one param used to index another",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				* @param labels
+				*/
+				{template .main}
+					{let $keys: keys($profile)/}
+					{$labels[$keys[0]]}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected:     map[string]interface{}{},
+			expectedErr: errors.New(`1 unknown usages:
+test.soy:9:16 in template test.main: cannot resolve map key expression [$keys[0]]`),
+		},
+		{
+			name: "all unknown usages are returned",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				*/
+				{template .main}
+					{$a[$b]}
+					{call .callee data="myFunc($a)"/}
+				{/template}
+
+				{template .callee}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected:     map[string]interface{}{},
+			expectedErr: errors.New(`3 unknown usages:
+test.soy:8:11 in template test.main: cannot resolve map key expression [$b]
+test.soy:9:12 in template test.main: unknown function myFunc($a)
+test.soy:9:12 in template test.main: cannot resolve data expression myFunc($a)`),
+		},
+		{
+			name: "unknown functions in let values are errors",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{let $value: myFunc($a.b)/}
+					{$value}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected:     map[string]interface{}{},
+			expectedErr: errors.New(`1 unknown usages:
+test.soy:7:26 in template test.main: unknown function myFunc($a.b)`),
+		},
+	}
+	testAnalyze(t, tests)
+}
+
+func TestStrictErrorUnwrap(t *testing.T) {
+	bundle := soy.NewBundle().AddTemplateString("test.soy", `
+		{namespace test}
+		/**
+		* @param a
+		*/
+		{template .main}
+			{myFunc($a)}
+			{otherFunc($a)}
+		{/template}
+	`)
+	registry, err := bundle.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = soyusage.AnalyzeTemplate("test.main", registry, soyusage.Strict())
+	var strictErr *soyusage.StrictError
+	if !errors.As(err, &strictErr) {
+		t.Fatalf("expected a StrictError, got %v", err)
+	}
+	if len(strictErr.Unwrap()) != 2 {
+		t.Errorf("expected 2 errors, got %d", len(strictErr.Unwrap()))
+	}
+}
+
+func TestAnalyzeStrictMode(t *testing.T) {
+	var tests = []analyzeTest{
+		{
+			name: "constant access is unaffected",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{let $key: 'b'/}
+					{$a[$key]}
+					<div class="{css $a.prefix, foo}"></div>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.StrictMode()},
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b":      "*",
+					"prefix": "c",
+				},
+				"$css": map[string]interface{}{
+					"[?]": map[string]interface{}{
+						"foo": "c",
+					},
+				},
+			},
+		},
+		{
+			name: "unknown access paths are returned",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				*/
+				{template .main}
+					{$a.items[$b].name}
+					{call .callee}
+						{param c: $a.c /}
+					{/call}
+				{/template}
+
+				/**
+				* @param c
+				*/
+				{template .callee}
+					{myFunc($c.d)}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.StrictMode()},
+			expected:     map[string]interface{}{},
+			expectedErr: errors.New(`2 unknown accesses in template test.main:
+a.c.d
+a.items.[?]`),
+		},
+	}
+	testAnalyze(t, tests)
+}
+
+func TestUnknownAccessErrorPaths(t *testing.T) {
+	bundle := soy.NewBundle().AddTemplateString("test.soy", `
+		{namespace test}
+		/**
+		* @param a
+		* @param key
+		*/
+		{template .main}
+			{$a[$key]}
+		{/template}
+	`)
+	registry, err := bundle.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = soyusage.AnalyzeTemplate("test.main", registry, soyusage.StrictMode())
+	var accessErr *soyusage.UnknownAccessError
+	if !errors.As(err, &accessErr) {
+		t.Fatalf("expected an UnknownAccessError, got %v", err)
+	}
+	if len(accessErr.Paths) != 1 || accessErr.Paths[0] != "a.[?]" {
+		t.Errorf("expected the path a.[?], got %v", accessErr.Paths)
+	}
+}
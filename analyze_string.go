@@ -0,0 +1,122 @@
+package soyusage
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/robfig/soy/ast"
+)
+
+// stringFunctions folds pure string functions applied to constant arguments,
+// so their results may be used as constant map keys.
+var stringFunctions = map[string]func(args []interface{}) (interface{}, bool){
+	"strToAsciiLowerCase": func(args []interface{}) (interface{}, bool) {
+		str, ok := stringArg(args, 0, 1)
+		if !ok {
+			return nil, false
+		}
+		return strings.Map(func(r rune) rune {
+			if r >= 'A' && r <= 'Z' {
+				return r + ('a' - 'A')
+			}
+			return r
+		}, str), true
+	},
+	"strToAsciiUpperCase": func(args []interface{}) (interface{}, bool) {
+		str, ok := stringArg(args, 0, 1)
+		if !ok {
+			return nil, false
+		}
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' {
+				return r - ('a' - 'A')
+			}
+			return r
+		}, str), true
+	},
+	"strSub": func(args []interface{}) (interface{}, bool) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, false
+		}
+		str, ok := stringArg(args, 0, len(args))
+		if !ok || !utf8.ValidString(str) {
+			return nil, false
+		}
+		runes := []rune(str)
+		start, isInt := args[1].(int)
+		end := len(runes)
+		if len(args) == 3 {
+			end, ok = args[2].(int)
+			isInt = isInt && ok
+		}
+		if !isInt || start < 0 || end > len(runes) || start > end {
+			return nil, false
+		}
+		return string(runes[start:end]), true
+	},
+}
+
+// stringArg returns the string argument at index, if there are the expected
+// number of arguments. Constant numbers are converted as Soy would coerce them.
+func stringArg(args []interface{}, index, expected int) (string, bool) {
+	if len(args) != expected {
+		return "", false
+	}
+	switch v := args[index].(type) {
+	case string:
+		return v, true
+	case int:
+		str, _ := addConstants("", v)
+		return str.(string), true
+	}
+	return "", false
+}
+
+// functionConstants returns the possible results of a function given the constant
+// values of its arguments. If any argument may not be constant, or fn cannot be
+// applied to the values, the result is not constant.
+func functionConstants(s *scope, node *ast.FunctionNode, fn func(args []interface{}) (interface{}, bool)) ([]interface{}, error) {
+	var combinations = [][]interface{}{nil}
+	for _, arg := range node.Args {
+		values, err := constantValues(s, arg)
+		if err != nil {
+			return nil, wrapError(s, node, err)
+		}
+		if len(values) == 0 {
+			values = []interface{}{nonConstant{}}
+		}
+		var next [][]interface{}
+		for _, combination := range combinations {
+			for _, value := range values {
+				next = append(next, append(combination[:len(combination):len(combination)], value))
+			}
+		}
+		combinations = next
+	}
+	var (
+		out  []interface{}
+		seen = make(map[interface{}]bool)
+	)
+	for _, args := range combinations {
+		var value interface{} = nonConstant{}
+		if !containsNonConstant(args) {
+			if result, ok := fn(args); ok {
+				value = result
+			}
+		}
+		if !seen[value] {
+			seen[value] = true
+			out = append(out, value)
+		}
+	}
+	return out, nil
+}
+
+func containsNonConstant(values []interface{}) bool {
+	for _, value := range values {
+		if _, isNonConstant := value.(nonConstant); isNonConstant {
+			return true
+		}
+	}
+	return false
+}
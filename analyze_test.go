@@ -3,10 +3,11 @@ package soyusage_test
 import (
 	"encoding/json"
 	"fmt"
-	"sort"
 	"testing"
+	"testing/fstest"
 
 	"github.com/robfig/soy"
+	"github.com/robfig/soy/data"
 	"github.com/robfig/soy/template"
 	"github.com/theothertomelliott/must"
 	"github.com/theothertomelliott/soyusage"
@@ -98,7 +99,9 @@ func TestAnalyzeParamHierarchy(t *testing.T) {
 			templateName: "test.main",
 			expected: map[string]interface{}{
 				"a": map[string]interface{}{
-					"c": "*",
+					"[5]": map[string]interface{}{
+						"c": "*",
+					},
 				},
 			},
 		},
@@ -118,7 +121,9 @@ func TestAnalyzeParamHierarchy(t *testing.T) {
 			templateName: "test.main",
 			expected: map[string]interface{}{
 				"a": map[string]interface{}{
-					"c": "*",
+					"[5]": map[string]interface{}{
+						"c": "*",
+					},
 				},
 			},
 		},
@@ -162,6 +167,78 @@ func TestAnalyzeParamHierarchy(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "let defaulting an optional param",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param m
+				*/
+				{template .main}
+					{call .other}
+						{param m: $m /}
+					{/call}
+				{/template}
+
+				/**
+				* @param? name
+				* @param m
+				*/
+				{template .other}
+					{if not isNonnull($name)}
+						{let $name: 'default' /}
+						{$m[$name].title}
+					{/if}
+					{$m[$name].id}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"m": map[string]interface{}{
+					"default": map[string]interface{}{
+						"title": "*",
+					},
+					"[?]": map[string]interface{}{
+						"id": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "switch and case expressions are recorded",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param c
+				*/
+				{template .main}
+					{switch $a.b}
+						{case $c.d}
+							first
+						{case 'x', $c.e}
+							second
+						{default}
+							{$a.fallback}
+					{/switch}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b":        "*",
+					"fallback": "*",
+				},
+				"c": map[string]interface{}{
+					"d": "*",
+					"e": "*",
+				},
+			},
+		},
 		{
 			name: "supports concatenation in let",
 			templates: map[string]string{
@@ -269,12 +346,367 @@ func TestAnalyzeParamHierarchy(t *testing.T) {
 	testAnalyze(t, tests)
 }
 
+func TestAnalyzePrintDirectives(t *testing.T) {
+	var tests = []analyzeTest{
+		{
+			name: "directive arguments are recorded",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param text
+				*/
+				{template .main}
+					{$text |truncate:$a.maxLen,$a.ellipsis}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"text": "*",
+				"a": map[string]interface{}{
+					"maxLen":   "*",
+					"ellipsis": "*",
+				},
+			},
+		},
+		{
+			name: "directive arguments in param blocks are recorded",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{call .callee}
+						{param text}{$a.text |truncate:$a.maxLen}{/param}
+					{/call}
+				{/template}
+
+				/**
+				* @param text
+				*/
+				{template .callee}
+					{$text}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"text":   "*",
+					"maxLen": "*",
+				},
+			},
+		},
+		{
+			name: "directive arguments in let bodies",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param profile
+				*/
+				{template .main}
+					{let $key}{'c_about' |truncate:$a.maxLen}{/let}
+					{let $other}{'C_HOME' |changeNewlineToBr}{/let}
+					{$profile[$key]}
+					{$profile[$other]}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"maxLen": "*",
+				},
+				"profile": map[string]interface{}{
+					"[?]":    "*",
+					"C_HOME": "*",
+				},
+			},
+		},
+		{
+			name: "custom directives use their registered fields",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param user
+				* @param other
+				*/
+				{template .main}
+					{$user.name |fullName}
+					{$user.avatar |hidden}
+					{$other |unregistered}
+					{$user.bio |changeNewlineToBr |fullName}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options: []soyusage.Option{
+				soyusage.Directive("fullName", "first", "last"),
+				soyusage.Directive("hidden"),
+			},
+			expected: map[string]interface{}{
+				"user": map[string]interface{}{
+					"name": map[string]interface{}{
+						"first": "*",
+						"last":  "*",
+					},
+					"avatar": map[string]interface{}{},
+					"bio":    "*",
+				},
+				"other": "*",
+			},
+		},
+		{
+			name: "custom directives with nested fields",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				*/
+				{template .main}
+					{$a ?: $b |address}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options: []soyusage.Option{
+				soyusage.Directive("address", "street.line1", "city"),
+			},
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"street": map[string]interface{}{
+						"line1": "*",
+					},
+					"city": "*",
+				},
+				"b": map[string]interface{}{
+					"street": map[string]interface{}{
+						"line1": "*",
+					},
+					"city": "*",
+				},
+			},
+		},
+		{
+			name: "custom directives in let bodies are not constant",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{let $key}{'c_about' |fieldName}{/let}
+					{$profile[$key]}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options: []soyusage.Option{
+				soyusage.Directive("fieldName"),
+			},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"[?]": "*",
+				},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
+
+func TestAnalyzeSpecialCharacters(t *testing.T) {
+	var tests = []analyzeTest{
+		{
+			name: "literal braces around prints",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param profile
+				*/
+				{template .main}
+					{lb}{$profile.name}{rb}{sp}{lb}{rb}{nil}{\n}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": "*",
+				},
+			},
+		},
+		{
+			name: "literal braces in a constant key",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param labels
+				*/
+				{template .main}
+					{let $key kind="text"}{lb}title{rb}{/let}
+					{$labels[$key]}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.Option{soyusage.Strict()},
+			expected: map[string]interface{}{
+				"labels": map[string]interface{}{
+					"{title}": "*",
+				},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
+
+func TestAnalyzeShadowing(t *testing.T) {
+	var tests = []analyzeTest{
+		{
+			name: "param shadowed by let",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param name
+				* @param profile
+				*/
+				{template .main}
+					{if $profile.enabled}
+						{let $name: $profile.displayName /}
+						{$name.first}
+					{/if}
+					{$name.last}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"name": map[string]interface{}{
+					"last": "*",
+				},
+				"profile": map[string]interface{}{
+					"enabled": "e",
+					"displayName": map[string]interface{}{
+						"first": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "let shadowed by inner let",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				*/
+				{template .main}
+					{let $x: $a /}
+					{foreach $item in $b.items}
+						{let $x: $item /}
+						{$x.inner}
+					{/foreach}
+					{$x.outer}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"outer": "*",
+				},
+				"b": map[string]interface{}{
+					"items": map[string]interface{}{
+						"inner": "*",
+					},
+				},
+			},
+		},
+		{
+			name: "loop variable shadowing let",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param list
+				*/
+				{template .main}
+					{let $x: $a /}
+					{foreach $x in $list}
+						{$x.item}
+					{/foreach}
+					{$x.outer}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"outer": "*",
+				},
+				"list": map[string]interface{}{
+					"item": "*",
+				},
+			},
+		},
+		{
+			name: "loop variable shadowing param",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				* @param list
+				*/
+				{template .main}
+					{foreach $a in $list}
+						{$a.item}
+					{/foreach}
+					{$a.outer}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"outer": "*",
+				},
+				"list": map[string]interface{}{
+					"item": "*",
+				},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
+
 type analyzeTest struct {
 	name         string
 	templates    map[string]string
 	templateName string
-	expected     map[string]interface{}
-	expectedErr  error
+	// globals are added to the bundle before compiling
+	globals     data.Map
+	options     []soyusage.Option
+	expected    map[string]interface{}
+	expectedErr error
+	// listMarkers renders the children of list params under "[]" in the expected result
+	listMarkers bool
 }
 
 func testAnalyze(t *testing.T, tests []analyzeTest) {
@@ -283,6 +715,9 @@ func testAnalyze(t *testing.T, tests []analyzeTest) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Helper()
 			bundle := soy.NewBundle()
+			if test.globals != nil {
+				bundle = bundle.AddGlobalsMap(test.globals)
+			}
 			for name, content := range test.templates {
 				bundle = bundle.AddTemplateString(name, content)
 			}
@@ -290,8 +725,17 @@ func testAnalyze(t *testing.T, tests []analyzeTest) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			got, err := soyusage.AnalyzeTemplate(test.templateName, registry)
-			must.BeEqual(t, test.expected, mapUsage(got))
+			got, err := soyusage.AnalyzeTemplate(test.templateName, registry, test.options...)
+
+			// Memoization must not change the result
+			unmemoized, _ := soyusage.AnalyzeTemplate(test.templateName, registry, append(test.options, soyusage.Memoize(false))...)
+			must.BeEqual(t, mapUsageFull(registry, unmemoized), mapUsageFull(registry, got), "memoized result differs")
+
+			if test.listMarkers {
+				must.BeEqual(t, test.expected, mapUsageWithLists(got))
+			} else {
+				must.BeEqual(t, test.expected, mapUsage(got))
+			}
 			must.BeEqualErrors(t, test.expectedErr, err)
 			if t.Failed() {
 				t.Log(jsonSprint(mapUsageFull(registry, got)))
@@ -308,42 +752,45 @@ func jsonSprint(value interface{}) string {
 	return string(out)
 }
 
-func mapUsage(params soyusage.Params) map[string]interface{} {
-	var out = make(map[string]interface{})
-	for name, param := range params {
-		var mappedParam interface{} = mapUsage(param.Children)
-		sort.Slice(param.Usage, func(i int, j int) bool {
-			var order = map[soyusage.UsageType]int{
-				soyusage.UsageUnknown: 10,
-				soyusage.UsageFull:    9,
-				soyusage.UsageMeta:    7,
-				soyusage.UsageExists:  6,
-			}
-			return order[param.Usage[i].Type] < order[param.Usage[j].Type]
-		})
-		for _, usage := range param.Usage {
-			var newValue string
-			switch usage.Type {
-			case soyusage.UsageMeta:
-				if len(param.Children) == 0 {
-					newValue = "m"
-				}
-			case soyusage.UsageExists:
-				if len(param.Children) == 0 {
-					newValue = "e"
-				}
-			case soyusage.UsageFull:
-				newValue = "*"
-			case soyusage.UsageUnknown:
-				newValue = "?"
-			}
-			if newValue != "" {
-				mappedParam = newValue
-			}
-		}
-		out[name.String()] = mappedParam
+// analyzeSource compiles a single file of templates and analyzes its test.main template.
+func analyzeSource(t *testing.T, src string) soyusage.Params {
+	t.Helper()
+	registry, err := soy.NewBundle().AddTemplateString("test.soy", src).Compile()
+	if err != nil {
+		t.Fatal(err)
 	}
-	return out
+	params, err := soyusage.AnalyzeTemplate("test.main", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+// analyzeTypedSource analyzes test.main as analyzeSource does, loading the file
+// with LoadFS so params may be declared with types.
+func analyzeTypedSource(t *testing.T, src string) soyusage.Params {
+	t.Helper()
+	registry, err := soyusage.LoadFS(fstest.MapFS{
+		"test.soy": &fstest.MapFile{Data: []byte(src)},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := soyusage.AnalyzeTemplate("test.main", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+// mapUsage renders params in the form used for expected results.
+func mapUsage(params soyusage.Params) map[string]interface{} {
+	return params.ToMap(soyusage.MapOptions{})
+}
+
+// mapUsageWithLists renders params as mapUsage, with the children of list params under "[]".
+func mapUsageWithLists(params soyusage.Params) map[string]interface{} {
+	return params.ToMap(soyusage.MapOptions{WrapLists: true})
 }
 
 func mapUsageFull(registry *template.Registry, params soyusage.Params) map[string]interface{} {
@@ -368,6 +815,10 @@ func mapUsageFull(registry *template.Registry, params soyusage.Params) map[strin
 				usageValue["Type"] = "Exists"
 			case soyusage.UsageReference:
 				usageValue["Type"] = "Reference"
+			case soyusage.UsageKeys:
+				usageValue["Type"] = "Keys"
+			case soyusage.UsageCSSReference:
+				usageValue["Type"] = "CSSReference"
 			default:
 				usageValue["Type"] = fmt.Sprint(usage.Type)
 			}
@@ -380,6 +831,9 @@ func mapUsageFull(registry *template.Registry, params soyusage.Params) map[strin
 			usageList = append(usageList, usageValue)
 		}
 		paramOut["Usage"] = usageList
+		if param.IsList {
+			paramOut["IsList"] = true
+		}
 		out[name.String()] = paramOut
 	}
 	return out
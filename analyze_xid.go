@@ -0,0 +1,43 @@
+package soyusage
+
+import (
+	"fmt"
+
+	"github.com/robfig/soy/ast"
+)
+
+// analyzeXid records the identifier referenced by a call to the xid function.
+// Params used to build the identifier are recorded with UsageXIDReference, and
+// the identifier is only listed if it is constant.
+//
+// The {xid} command is not supported by the soy parser, so only the function
+// form, {xid('some.id')}, is analyzed.
+func analyzeXid(s *scope, node *ast.FunctionNode) error {
+	if err := analyzeNode(s, UsageXIDReference, node.Args...); err != nil {
+		return wrapError(s, node, err)
+	}
+	usage := Usage{
+		Type:     UsageXIDReference,
+		Template: s.templateName,
+		node:     node,
+	}
+	var ids []interface{}
+	for _, arg := range node.Args {
+		values, err := constantValues(s, arg)
+		if err != nil {
+			return wrapError(s, node, err)
+		}
+		ids = append(ids, values...)
+	}
+	if len(ids) == 0 {
+		ids = []interface{}{nonConstant{}}
+	}
+	for _, id := range ids {
+		if _, isNonConstant := id.(nonConstant); isNonConstant {
+			s.xid.getChildOrNew(MapIndex{}).addUsageToLeaves(usage)
+			continue
+		}
+		s.xid.getChildOrNew(Name(fmt.Sprint(id))).addUsageToLeaves(usage)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+func TestAnalyzeXid(t *testing.T) {
+	var tests = []analyzeTest{
+		{
+			name: "literal ids are listed",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					<div data-handler="{xid('app.onClick')}">{$a}</div>
+					<div data-handler="{xid('app.onHover')}"></div>
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"a": "*",
+				"$xid": map[string]interface{}{
+					"app.onClick": "x",
+					"app.onHover": "x",
+				},
+			},
+		},
+		{
+			name: "constant ids from variables are listed",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param primary
+				*/
+				{template .main}
+					{let $id}{if $primary}app.primary{else}app.secondary{/if}{/let}
+					{xid($id)}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"primary": "e",
+				"$xid": map[string]interface{}{
+					"app.primary":   "x",
+					"app.secondary": "x",
+				},
+			},
+		},
+		{
+			name: "ids from params are unknown",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param handler
+				*/
+				{template .main}
+					{xid($handler.name)}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"handler": map[string]interface{}{
+					"name": "x",
+				},
+				"$xid": map[string]interface{}{
+					"[?]": "x",
+				},
+			},
+		},
+		{
+			name: "global ids are listed",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				{template .main}
+					<div data-handler="{xid(CLICK_HANDLER)}"></div>
+				{/template}
+			`,
+			},
+			globals: data.Map{
+				"CLICK_HANDLER": data.String("app.onClick"),
+			},
+			templateName: "test.main",
+			expected: map[string]interface{}{
+				"$xid": map[string]interface{}{
+					"app.onClick": "x",
+				},
+			},
+		},
+	}
+	testAnalyze(t, tests)
+}
@@ -0,0 +1,197 @@
+package soyusage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/parsepasses"
+	"github.com/robfig/soy/template"
+)
+
+// Analyzer holds a set of parsed soy files and the analysis of their templates,
+// so templates can be re-analyzed as the files change, such as in an editor.
+//
+// The analysis of each template is cached until a file it depends on changes.
+// Updating a file parses only that file, though the registry of templates is
+// rebuilt from every file. It only invalidates the analysis of the templates the
+// file defines and the templates that call them, directly or indirectly.
+// An Analyzer is safe for concurrent use.
+type Analyzer struct {
+	// OnAnalyze, if set, is called with the name of each template analyzed,
+	// rather than taken from the cache
+	OnAnalyze func(templateName string)
+
+	lock     sync.Mutex
+	config   Config
+	files    map[string]*ast.SoyFileNode
+	registry *template.Registry
+	graph    Graph
+	memo     *memo
+	results  map[string]Params
+}
+
+// NewAnalyzer parses a set of soy files, keyed by file name, to be analyzed with
+// the given options. Templates are analyzed when their usage is first requested.
+// Any globals the templates use are given with the Globals option.
+func NewAnalyzer(files map[string]string, options ...Option) (*Analyzer, error) {
+	a := &Analyzer{
+		config:  newConfig(options...),
+		files:   make(map[string]*ast.SoyFileNode),
+		results: make(map[string]Params),
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tree, err := parseFile(name, files[name], a.config.Globals)
+		if err != nil {
+			return nil, err
+		}
+		a.files[name] = tree
+	}
+	registry, err := buildRegistry(a.files)
+	if err != nil {
+		return nil, err
+	}
+	a.registry = registry
+	a.graph = newGraph(registry)
+	a.memo = newMemo()
+	return a, nil
+}
+
+// UpdateFile replaces the content of a file, or adds it if there is no file with
+// that name. The cached analysis of the templates defined in the file, before
+// and after the update, is discarded along with that of their callers.
+//
+// If the file cannot be parsed, an error is returned and the Analyzer is unchanged.
+func (a *Analyzer) UpdateFile(name string, src string) error {
+	tree, err := parseFile(name, src, a.config.Globals)
+	if err != nil {
+		return err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var files = make(map[string]*ast.SoyFileNode, len(a.files)+1)
+	for fileName, fileTree := range a.files {
+		files[fileName] = fileTree
+	}
+	files[name] = tree
+	registry, err := buildRegistry(files)
+	if err != nil {
+		return err
+	}
+	graph := newGraph(registry)
+
+	var changed []string
+	if previous, exists := a.files[name]; exists {
+		changed = append(changed, fileTemplates(previous)...)
+	}
+	changed = append(changed, fileTemplates(tree)...)
+	for _, templateName := range changed {
+		a.invalidate(templateName, a.graph)
+		a.invalidate(templateName, graph)
+	}
+
+	a.files = files
+	a.registry = registry
+	a.graph = graph
+	return nil
+}
+
+// invalidate discards the analysis of a template and of all templates that
+// call it, directly or indirectly, in a call graph, along with their memoized traces.
+func (a *Analyzer) invalidate(templateName string, graph Graph) {
+	var (
+		visited = make(map[string]bool)
+		visit   func(name string)
+	)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		delete(a.results, name)
+		a.memo.invalidate(name)
+		for _, caller := range graph.Callers(name) {
+			visit(caller)
+		}
+	}
+	visit(templateName)
+}
+
+// Usage returns the parameter tree for a template, as would be returned by
+// AnalyzeTemplate, analyzing the template if there is no cached analysis.
+// Failed analyses are not cached.
+func (a *Analyzer) Usage(templateName string) (Params, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if params, cached := a.results[templateName]; cached {
+		return params, nil
+	}
+	if a.OnAnalyze != nil {
+		a.OnAnalyze(templateName)
+	}
+	params, err := analyzeTemplate(templateName, a.registry, a.config, a.memo)
+	if err != nil {
+		return nil, err
+	}
+	a.results[templateName] = params
+	return params, nil
+}
+
+// parseFile parses a single soy file, applying the passes the bundle applies to
+// each file on compilation that do not depend on other files. The names of params
+// declared with types are corrected, so data refs to them can be checked.
+func parseFile(name string, src string, globals data.Map) (*ast.SoyFileNode, error) {
+	tree, err := parse.SoyFile(name, src)
+	if err != nil {
+		return nil, err
+	}
+	trimDocParamNames(tree)
+	var registry template.Registry
+	if err := registry.Add(tree); err != nil {
+		return nil, err
+	}
+	if err := parsepasses.SetGlobals(registry, globals); err != nil {
+		return nil, err
+	}
+	parsepasses.ProcessMessages(registry)
+	return tree, nil
+}
+
+// buildRegistry combines parsed files into a registry, checking the data
+// references of every template as a bundle does on compilation.
+func buildRegistry(files map[string]*ast.SoyFileNode) (*template.Registry, error) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var registry template.Registry
+	for _, name := range names {
+		if err := registry.Add(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := parsepasses.CheckDataRefs(registry); err != nil {
+		return nil, err
+	}
+	return &registry, nil
+}
+
+// fileTemplates lists the names of the templates defined in a parsed file.
+func fileTemplates(tree *ast.SoyFileNode) []string {
+	var out []string
+	for _, node := range tree.Body {
+		if t, isTemplate := node.(*ast.TemplateNode); isTemplate {
+			out = append(out, t.Name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,199 @@
+package soyusage_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+var analyzerFiles = map[string]string{
+	"main.soy": `
+		{namespace test}
+		/**
+		* @param profile
+		*/
+		{template .main}
+			{call test.link data="$profile"/}
+		{/template}
+	`,
+	"link.soy": `
+		{namespace test}
+		/**
+		* @param url
+		*/
+		{template .link}
+			<a href="{$url}">link</a>
+		{/template}
+	`,
+	"other.soy": `
+		{namespace test}
+		/**
+		* @param title
+		*/
+		{template .other}
+			{$title}
+		{/template}
+	`,
+}
+
+// newCountingAnalyzer creates an Analyzer that records the templates it analyzes.
+func newCountingAnalyzer(t *testing.T, files map[string]string) (*soyusage.Analyzer, *[]string) {
+	analyzer, err := soyusage.NewAnalyzer(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var analyzed []string
+	analyzer.OnAnalyze = func(templateName string) {
+		analyzed = append(analyzed, templateName)
+	}
+	return analyzer, &analyzed
+}
+
+// usageOf requests the usage of each template, returning their usage maps.
+func usageOf(t *testing.T, analyzer *soyusage.Analyzer, templateNames ...string) map[string]interface{} {
+	var out = make(map[string]interface{})
+	for _, name := range templateNames {
+		params, err := analyzer.Usage(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[name] = mapUsage(params)
+	}
+	return out
+}
+
+func TestAnalyzerUpdateFile(t *testing.T) {
+	analyzer, analyzed := newCountingAnalyzer(t, analyzerFiles)
+
+	usageOf(t, analyzer, "test.main", "test.link", "test.other")
+	usageOf(t, analyzer, "test.main", "test.link", "test.other")
+	must.BeEqual(t, []string{"test.main", "test.link", "test.other"}, *analyzed)
+
+	err := analyzer.UpdateFile("link.soy", `
+		{namespace test}
+		/**
+		* @param url
+		* @param label
+		*/
+		{template .link}
+			<a href="{$url}">{$label}</a>
+		{/template}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*analyzed = nil
+	usage := usageOf(t, analyzer, "test.main", "test.link", "test.other")
+	sort.Strings(*analyzed)
+	must.BeEqual(t, []string{"test.link", "test.main"}, *analyzed)
+	must.BeEqual(t, map[string]interface{}{
+		"test.main": map[string]interface{}{
+			"profile": map[string]interface{}{
+				"url":   "*",
+				"label": "*",
+			},
+		},
+		"test.link": map[string]interface{}{
+			"url":   "*",
+			"label": "*",
+		},
+		"test.other": map[string]interface{}{
+			"title": "*",
+		},
+	}, usage)
+}
+
+func TestAnalyzerAddFile(t *testing.T) {
+	files := map[string]string{
+		"main.soy": analyzerFiles["main.soy"],
+		"link.soy": analyzerFiles["link.soy"],
+	}
+	analyzer, analyzed := newCountingAnalyzer(t, files)
+
+	if _, err := analyzer.Usage("test.other"); err == nil {
+		t.Error("expected an error for a template in a file not yet added")
+	}
+	usageOf(t, analyzer, "test.main", "test.link")
+
+	if err := analyzer.UpdateFile("other.soy", analyzerFiles["other.soy"]); err != nil {
+		t.Fatal(err)
+	}
+	*analyzed = nil
+	usage := usageOf(t, analyzer, "test.main", "test.link", "test.other")
+	must.BeEqual(t, []string{"test.other"}, *analyzed)
+	must.BeEqual(t, map[string]interface{}{
+		"title": "*",
+	}, usage["test.other"])
+}
+
+func TestAnalyzerUpdateFileError(t *testing.T) {
+	analyzer, analyzed := newCountingAnalyzer(t, analyzerFiles)
+	usageOf(t, analyzer, "test.main", "test.link", "test.other")
+
+	if err := analyzer.UpdateFile("link.soy", `{namespace test}{template .link}{/for}`); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+	*analyzed = nil
+	usage := usageOf(t, analyzer, "test.main", "test.link", "test.other")
+	if len(*analyzed) > 0 {
+		t.Errorf("expected no templates to be analyzed, got %v", *analyzed)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"url": "*",
+	}, usage["test.link"])
+}
+
+func TestAnalyzerGlobals(t *testing.T) {
+	files := map[string]string{
+		"main.soy": `
+			{namespace test}
+			/**
+			* @param profile
+			*/
+			{template .main}
+				{$profile[test.FIELD]}
+			{/template}
+		`,
+	}
+	if _, err := soyusage.NewAnalyzer(files); err == nil {
+		t.Error("expected an error for an undefined global")
+	}
+	analyzer, err := soyusage.NewAnalyzer(files, soyusage.Globals(data.Map{
+		"test.FIELD": data.String("name"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"test.main": map[string]interface{}{
+			"profile": map[string]interface{}{
+				"name": "*",
+			},
+		},
+	}, usageOf(t, analyzer, "test.main"))
+}
+
+func TestAnalyzerDeclaredTypes(t *testing.T) {
+	analyzer, err := soyusage.NewAnalyzer(map[string]string{
+		"main.soy": `
+			{namespace test}
+			/**
+			* @param profile: [name: string]
+			*/
+			{template .main}
+				{$profile.name}
+			{/template}
+		`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := analyzer.Usage("test.main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, "string", params[soyusage.Name("profile")].Children[soyusage.Name("name")].Type.String())
+}
@@ -0,0 +1,188 @@
+package soyusage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// AnalyzeBundle compiles a bundle and analyzes every template within it.
+// See AnalyzeRegistry for details.
+func AnalyzeBundle(bundle *soy.Bundle, options ...Option) (map[string]Params, error) {
+	registry, err := bundle.Compile()
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeRegistry(registry, options...)
+}
+
+// AnalyzeRegistry analyzes every template in a registry, returning the parameter
+// tree for each template keyed by its fully-qualified name.
+//
+// Templates are analyzed in dependency order, with called templates analyzed before
+// their callers. The analysis of each template is memoized, so a caller passing its
+// own params on to a called template, such as with data="all", is built from the
+// result already recorded for that template rather than walking it again. Calls
+// binding params of a different shape, such as constants or fields of a param, are
+// analyzed once per distinct shape and shared between callers. The result for each
+// template is the same as would be returned by AnalyzeTemplate.
+//
+// For a reverse index of the templates accessing each field, pass the results,
+// converted with ToMap, to InvertUsage. Declared params that a template never uses
+// are reported to the WarningHandler as WarningUnusedParam.
+//
+// If Parallelism is set, templates in independent subtrees of the call graph are
+// analyzed concurrently, with each template analyzed once the templates it calls
+// have been. The result is the same regardless of parallelism, but warnings may be
+// reported in any order.
+func AnalyzeRegistry(registry *template.Registry, options ...Option) (map[string]Params, error) {
+	var (
+		config        = newConfig(options...)
+		memo          = newMemo()
+		templateNames = dependencyOrder(registry)
+		results       = make([]Params, len(templateNames))
+		errs          = make([]error, len(templateNames))
+		workers       = config.Parallelism
+	)
+	if workers < 1 {
+		workers = 1
+	}
+	if handler := config.WarningHandler; handler != nil && workers > 1 {
+		var lock sync.Mutex
+		config.WarningHandler = func(w Warning) {
+			lock.Lock()
+			defer lock.Unlock()
+			handler(w)
+		}
+	}
+
+	var (
+		deps, dependents = dependencies(registry, templateNames)
+		ready            = make(chan int, len(templateNames))
+		remaining        = len(templateNames)
+		lock             sync.Mutex
+		wg               sync.WaitGroup
+	)
+	// A template is only analyzed once the templates it calls have been, so
+	// their analysis is memoized for it to reuse. Independent subtrees of the
+	// call graph are analyzed concurrently.
+	for index := range templateNames {
+		if deps[index] == 0 {
+			ready <- index
+		}
+	}
+	if remaining == 0 {
+		close(ready)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range ready {
+				results[index], errs[index] = analyzeTemplate(templateNames[index], registry, config, memo)
+
+				lock.Lock()
+				for _, dependent := range dependents[index] {
+					deps[dependent]--
+					if deps[dependent] == 0 {
+						ready <- dependent
+					}
+				}
+				remaining--
+				if remaining == 0 {
+					close(ready)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var out = make(map[string]Params)
+	for index, templateName := range templateNames {
+		if errs[index] != nil {
+			return nil, errs[index]
+		}
+		out[templateName] = results[index]
+	}
+	return out, nil
+}
+
+// dependencyOrder lists the templates in a registry such that called templates
+// appear before their callers. Templates within a cycle are listed in the order
+// they are first reached.
+func dependencyOrder(registry *template.Registry) []string {
+	var names []string
+	for _, t := range registry.Templates {
+		names = append(names, t.Node.Name)
+	}
+	sort.Strings(names)
+
+	var (
+		out     []string
+		visited = make(map[string]bool)
+		visit   func(name string)
+	)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		t, found := registry.Template(name)
+		if !found {
+			return
+		}
+		for _, callee := range calledTemplates(t.Node) {
+			visit(callee)
+		}
+		out = append(out, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return out
+}
+
+// dependencies counts, for each template in dependency order, the templates it
+// calls that appear before it, and lists the templates that call each template
+// from after it. Calls back to a template earlier in a cycle are not counted, so
+// every template is eventually ready to be analyzed.
+func dependencies(registry *template.Registry, templateNames []string) ([]int, [][]int) {
+	var (
+		indices    = make(map[string]int)
+		deps       = make([]int, len(templateNames))
+		dependents = make([][]int, len(templateNames))
+	)
+	for index, name := range templateNames {
+		indices[name] = index
+	}
+	for index, name := range templateNames {
+		t, _ := registry.Template(name)
+		for _, callee := range calledTemplates(t.Node) {
+			if calleeIndex, found := indices[callee]; found && calleeIndex < index {
+				deps[index]++
+				dependents[calleeIndex] = append(dependents[calleeIndex], index)
+			}
+		}
+	}
+	return deps, dependents
+}
+
+// calledTemplates returns the names of all templates called from within a node,
+// in the order they are called.
+func calledTemplates(node ast.Node) []string {
+	var (
+		out  []string
+		seen = make(map[string]bool)
+	)
+	walkNodes(node, func(node ast.Node) {
+		if call, isCall := node.(*ast.CallNode); isCall && !seen[call.Name] {
+			seen[call.Name] = true
+			out = append(out, call.Name)
+		}
+	})
+	return out
+}
@@ -0,0 +1,195 @@
+package soyusage_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/template"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestAnalyzeBundleMatchesAnalyzeTemplate(t *testing.T) {
+	bundle := soy.NewBundle().AddTemplateString("test.soy", `
+		{namespace test}
+		/**
+		* @param data
+		* @param key
+		*/
+		{template .main}
+			{call .left}
+				{param data: $data.left/}
+				{param key: 'leftKey'/}
+			{/call}
+			{call .right data="all"/}
+		{/template}
+
+		/**
+		* @param data
+		* @param key
+		*/
+		{template .left}
+			{call .bottom data="all"/}
+		{/template}
+
+		/**
+		* @param data
+		* @param? key
+		*/
+		{template .right}
+			{$data.right}
+			{call .bottom}
+				{param data: $data/}
+				{param key: $key ?: 'defaultKey'/}
+			{/call}
+		{/template}
+
+		/**
+		* @param data
+		* @param key
+		*/
+		{template .bottom}
+			{$data[$key]}
+			{$data.bottom}
+		{/template}
+	`)
+	got, err := soyusage.AnalyzeBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := bundle.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, tmpl := range registry.Templates {
+		names = append(names, tmpl.Node.Name)
+	}
+	must.BeEqual(t, len(names), len(got))
+	for _, name := range names {
+		expected, err := soyusage.AnalyzeTemplate(name, registry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		must.BeEqual(t, mapUsage(expected), mapUsage(got[name]), name)
+	}
+
+	must.BeEqual(t, map[string]interface{}{
+		"data": map[string]interface{}{
+			"left": map[string]interface{}{
+				"leftKey": "*",
+				"bottom":  "*",
+			},
+			"right":      "*",
+			"[?]":        "*",
+			"defaultKey": "*",
+			"bottom":     "*",
+		},
+		"key": "*",
+	}, mapUsage(got["test.main"]))
+}
+
+func TestAnalyzeRegistryParallelMatchesSequential(t *testing.T) {
+	registry := sharedPartialRegistry(t, 20)
+	sequential, err := soyusage.AnalyzeRegistry(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 8} {
+		parallel, err := soyusage.AnalyzeRegistry(registry, soyusage.Parallelism(workers))
+		if err != nil {
+			t.Fatal(err)
+		}
+		must.BeEqual(t, len(sequential), len(parallel))
+		for name, params := range sequential {
+			must.BeEqual(t, mapUsageFull(registry, params), mapUsageFull(registry, parallel[name]), name)
+		}
+	}
+}
+
+// independentTreesRegistry creates a registry with a number of pages, each calling
+// its own chain of partials, so the call graph is made up of independent subtrees.
+func independentTreesRegistry(tb testing.TB, pages int) *template.Registry {
+	var src strings.Builder
+	src.WriteString("{namespace test}\n")
+	for i := 0; i < pages; i++ {
+		fmt.Fprintf(&src, `
+/**
+* @param site
+* @param page
+*/
+{template .page%[1]d}
+	{$page.title}
+	{foreach $section in $page.sections}
+		{call .section%[1]d}
+			{param section: $section/}
+			{param site: $site/}
+		{/call}
+	{/foreach}
+{/template}
+
+/**
+* @param site
+* @param section
+*/
+{template .section%[1]d}
+	{$section.heading%[1]d}
+	{foreach $link in $section.links}
+		{call .link%[1]d}
+			{param link: $link/}
+			{param labels: $site.labels/}
+		{/call}
+	{/foreach}
+{/template}
+
+/**
+* @param link
+* @param labels
+*/
+{template .link%[1]d}
+	<a href="{$link.url}">{$labels[$link.key]}</a>
+	{if $link.icon}{$link.icon.src%[1]d}{/if}
+{/template}
+`, i)
+	}
+	registry, err := soy.NewBundle().AddTemplateString("test.soy", src.String()).Compile()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return registry
+}
+
+func TestAnalyzeRegistryParallelIndependentTrees(t *testing.T) {
+	registry := independentTreesRegistry(t, 20)
+	sequential, err := soyusage.AnalyzeRegistry(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := soyusage.AnalyzeRegistry(registry, soyusage.Parallelism(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, len(sequential), len(parallel))
+	for name, params := range sequential {
+		must.BeEqual(t, mapUsageFull(registry, params), mapUsageFull(registry, parallel[name]), name)
+	}
+}
+
+// BenchmarkAnalyzeRegistryParallel measures the scaling of analysis across
+// independent subtrees of the call graph, which should be close to linear up to
+// the number of available cores.
+func BenchmarkAnalyzeRegistryParallel(b *testing.B) {
+	registry := independentTreesRegistry(b, 200)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("parallelism=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := soyusage.AnalyzeRegistry(registry, soyusage.Parallelism(workers)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
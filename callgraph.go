@@ -0,0 +1,157 @@
+package soyusage
+
+import (
+	"sort"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/template"
+)
+
+// Graph describes the calls between templates, by fully-qualified template name.
+//
+// Calls are found anywhere within a template, including within {let} and {param}
+// blocks. Calls to templates that are not in the bundle are included, as a callee
+// with no calls of its own. The soy parser does not support {delcall}, so there
+// are no calls to deltemplates.
+type Graph struct {
+	templates []string
+	callees   map[string][]string
+	callers   map[string][]string
+}
+
+// CallGraph compiles a bundle and returns the graph of calls between its templates.
+func CallGraph(bundle *soy.Bundle) (Graph, error) {
+	registry, err := bundle.Compile()
+	if err != nil {
+		return Graph{}, err
+	}
+	return newGraph(registry), nil
+}
+
+func newGraph(registry *template.Registry) Graph {
+	g := Graph{
+		callees: make(map[string][]string),
+		callers: make(map[string][]string),
+	}
+	for _, t := range registry.Templates {
+		g.templates = append(g.templates, t.Node.Name)
+	}
+	sort.Strings(g.templates)
+	for _, name := range g.templates {
+		t, _ := registry.Template(name)
+		callees := calledTemplates(t.Node)
+		sort.Strings(callees)
+		g.callees[name] = callees
+		for _, callee := range callees {
+			g.callers[callee] = append(g.callers[callee], name)
+		}
+	}
+	return g
+}
+
+// Templates lists the names of all templates in the graph, sorted by name.
+func (g Graph) Templates() []string {
+	return g.templates
+}
+
+// Callees lists the templates called directly by the named template, sorted by name.
+func (g Graph) Callees(name string) []string {
+	return g.callees[name]
+}
+
+// Callers lists the templates that directly call the named template, sorted by name.
+func (g Graph) Callers(name string) []string {
+	return g.callers[name]
+}
+
+// ReachableFrom lists the templates that may be called, directly or indirectly,
+// when rendering the entry template, sorted by name. The entry template is only
+// included if it may call itself.
+func (g Graph) ReachableFrom(entry string) []string {
+	var (
+		out     []string
+		visited = make(map[string]bool)
+		visit   func(name string)
+	)
+	visit = func(name string) {
+		for _, callee := range g.callees[name] {
+			if visited[callee] {
+				continue
+			}
+			visited[callee] = true
+			out = append(out, callee)
+			visit(callee)
+		}
+	}
+	visit(entry)
+	sort.Strings(out)
+	return out
+}
+
+// Cycles lists each set of templates that call one another recursively,
+// including templates that call themselves. Each cycle is sorted by name,
+// and the cycles are sorted by their first template.
+func (g Graph) Cycles() [][]string {
+	// Tarjan's algorithm finds the strongly connected components of the graph
+	var (
+		out     [][]string
+		index   = make(map[string]int)
+		lowLink = make(map[string]int)
+		onStack = make(map[string]bool)
+		stack   []string
+		connect func(name string)
+	)
+	connect = func(name string) {
+		index[name] = len(index)
+		lowLink[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, callee := range g.callees[name] {
+			if _, visited := index[callee]; !visited {
+				connect(callee)
+				if lowLink[callee] < lowLink[name] {
+					lowLink[name] = lowLink[callee]
+				}
+			} else if onStack[callee] && index[callee] < lowLink[name] {
+				lowLink[name] = index[callee]
+			}
+		}
+		if lowLink[name] != index[name] {
+			return
+		}
+
+		var component []string
+		for {
+			member := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[member] = false
+			component = append(component, member)
+			if member == name {
+				break
+			}
+		}
+		if len(component) > 1 || g.callsItself(name) {
+			sort.Strings(component)
+			out = append(out, component)
+		}
+	}
+	for _, name := range g.templates {
+		if _, visited := index[name]; !visited {
+			connect(name)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i][0] < out[j][0]
+	})
+	return out
+}
+
+func (g Graph) callsItself(name string) bool {
+	for _, callee := range g.callees[name] {
+		if callee == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestCallGraph(t *testing.T) {
+	graph, err := soyusage.CallGraph(soy.NewBundle().AddTemplateString("test.soy", `
+		{namespace test}
+		{template .main}
+			{let $content}{call .header/}{/let}
+			{call .layout}
+				{param body}{call .card/}{/param}
+			{/call}
+			{$content}
+		{/template}
+
+		{template .other}
+			{call .card/}
+		{/template}
+
+		/**
+		* @param body
+		*/
+		{template .layout}
+			{$body}
+			{call .footer/}
+		{/template}
+
+		{template .header}
+		{/template}
+
+		{template .card}
+			{call .list/}
+		{/template}
+
+		{template .list}
+			{call .item/}
+		{/template}
+
+		{template .item}
+			{call .list/}
+		{/template}
+
+		{template .footer}
+			{call .footer/}
+		{/template}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, []string{"test.card", "test.header", "test.layout"}, graph.Callees("test.main"))
+	must.BeEqual(t, []string{"test.main", "test.other"}, graph.Callers("test.card"))
+	must.BeEqual(t, []string(nil), graph.Callers("test.main"))
+	must.BeEqual(t, []string{
+		"test.card",
+		"test.footer",
+		"test.header",
+		"test.item",
+		"test.layout",
+		"test.list",
+	}, graph.ReachableFrom("test.main"))
+	must.BeEqual(t, []string{"test.item", "test.list"}, graph.ReachableFrom("test.list"))
+	must.BeEqual(t, []string(nil), graph.ReachableFrom("test.header"))
+	must.BeEqual(t, [][]string{
+		{"test.footer"},
+		{"test.item", "test.list"},
+	}, graph.Cycles())
+	must.BeEqual(t, 8, len(graph.Templates()))
+}
+
+func TestCallGraphCompileError(t *testing.T) {
+	_, err := soyusage.CallGraph(soy.NewBundle().AddTemplateString("test.soy", `
+		{namespace test}
+		{template .main}
+	`))
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,427 @@
+// Command soyusage analyzes the usage of parameters in a directory of soy templates.
+//
+// Usage:
+//
+//	soyusage analyze -dir ./templates -template test.main [-format json|yaml|paths]
+//	soyusage analyze -dir ./templates -all [-format json|yaml|paths]
+//	soyusage diff -dir ./templates -template test.main -golden usage.yaml [-update]
+//	soyusage filter -dir ./templates -template test.main -data payload.json [-keep-unknown=false]
+//
+// Every .soy file under the directory is compiled into a single bundle. Globals
+// may be provided as a JSON object with -globals. The analysis is written to
+// stdout in the chosen format, and any failure to compile or analyze the
+// templates is described on stderr with a nonzero exit code.
+//
+// The diff command compares the analysis of a template with a golden file in
+// the yaml format, listing any added, removed or changed paths and exiting with
+// a nonzero code if there are differences. With -update, the golden file is
+// rewritten with the current analysis instead.
+//
+// The filter command removes the values a template does not use from a JSON
+// object of its params, writing the result to stdout and the size of the data
+// before and after filtering to stderr. Maps accessed with unknown keys keep
+// all of their entries unless -keep-unknown=false is given. Injected data ($ij)
+// is not included in the analysis, so cannot be filtered, and giving it with
+// -ij is an error.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/template"
+	"github.com/theothertomelliott/soyusage"
+)
+
+const (
+	// exitFailure is returned when the templates cannot be compiled or analyzed,
+	// or their usage differs from a golden file
+	exitFailure = 1
+	// exitUsage is returned for invalid arguments
+	exitUsage = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+const usageText = `usage: soyusage <command> [flags]
+
+Commands:
+  analyze   analyze templates and write their parameter usage
+  diff      compare the parameter usage of a template with a golden file
+  filter    remove the data a template does not use from a JSON payload
+
+Run soyusage <command> -h for the flags of a command.
+`
+
+// run executes the command given by args, excluding the program name,
+// and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usageText)
+		return exitUsage
+	}
+	switch args[0] {
+	case "analyze":
+		return runAnalyze(args[1:], stdout, stderr)
+	case "diff":
+		return runDiff(args[1:], stdout, stderr)
+	case "filter":
+		return runFilter(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usageText)
+		return 0
+	}
+	fmt.Fprintf(stderr, "soyusage: unknown command %q\n\n%v", args[0], usageText)
+	return exitUsage
+}
+
+// analysisFlags are the flags shared by commands that analyze templates.
+type analysisFlags struct {
+	dir     string
+	globals string
+	strict  bool
+}
+
+func (a *analysisFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&a.dir, "dir", ".", "directory containing .soy files, searched recursively")
+	flags.StringVar(&a.globals, "globals", "", "JSON file containing an object of soy globals")
+	flags.BoolVar(&a.strict, "strict", false, "fail if the usage of any param cannot be determined")
+}
+
+// load compiles every .soy file under the directory, with the globals from
+// a JSON file if one is given.
+func (a *analysisFlags) load() (*template.Registry, error) {
+	var options []soyusage.Option
+	if a.globals != "" {
+		globals, err := readJSONObject(a.globals)
+		if err != nil {
+			return nil, fmt.Errorf("reading globals: %v", err)
+		}
+		options = append(options, soyusage.Globals(globals))
+	}
+	return soyusage.LoadDir(a.dir, options...)
+}
+
+func (a *analysisFlags) options() []soyusage.Option {
+	var options []soyusage.Option
+	if a.strict {
+		options = append(options, soyusage.Strict())
+	}
+	return options
+}
+
+// analyzeTemplate compiles the templates and analyzes one of them, describing
+// any failure on stderr.
+func (a *analysisFlags) analyzeTemplate(templateName string, stderr io.Writer) (soyusage.Params, bool) {
+	registry, err := a.load()
+	if err != nil {
+		fmt.Fprintf(stderr, "soyusage: %v\n", err)
+		return nil, false
+	}
+	params, err := soyusage.AnalyzeTemplate(templateName, registry, a.options()...)
+	if err != nil {
+		reportError(stderr, err)
+		return nil, false
+	}
+	return params, true
+}
+
+func runAnalyze(args []string, stdout, stderr io.Writer) int {
+	var (
+		analysis     analysisFlags
+		flags        = flag.NewFlagSet("analyze", flag.ContinueOnError)
+		templateName = flags.String("template", "", "fully-qualified name of the template to analyze, such as test.main")
+		all          = flags.Bool("all", false, "analyze every template")
+		format       = flags.String("format", "json", "output format: json, yaml or paths")
+	)
+	analysis.register(flags)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if (*templateName == "") == !*all {
+		fmt.Fprintln(stderr, "soyusage: exactly one of -template or -all is required")
+		return exitUsage
+	}
+	if !isFormat(*format) {
+		fmt.Fprintf(stderr, "soyusage: unknown format %q\n", *format)
+		return exitUsage
+	}
+
+	var results map[string]soyusage.Params
+	if *all {
+		registry, err := analysis.load()
+		if err != nil {
+			fmt.Fprintf(stderr, "soyusage: %v\n", err)
+			return exitFailure
+		}
+		if results, err = soyusage.AnalyzeRegistry(registry, analysis.options()...); err != nil {
+			reportError(stderr, err)
+			return exitFailure
+		}
+	} else {
+		params, ok := analysis.analyzeTemplate(*templateName, stderr)
+		if !ok {
+			return exitFailure
+		}
+		results = map[string]soyusage.Params{*templateName: params}
+	}
+	if err := writeResults(stdout, results, *format, *all); err != nil {
+		fmt.Fprintf(stderr, "soyusage: %v\n", err)
+		return exitFailure
+	}
+	return 0
+}
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	var (
+		analysis     analysisFlags
+		flags        = flag.NewFlagSet("diff", flag.ContinueOnError)
+		templateName = flags.String("template", "", "fully-qualified name of the template to analyze, such as test.main")
+		golden       = flags.String("golden", "", "file containing the expected usage, in the yaml format")
+		update       = flags.Bool("update", false, "rewrite the golden file with the current usage")
+	)
+	analysis.register(flags)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *templateName == "" || *golden == "" {
+		fmt.Fprintln(stderr, "soyusage: -template and -golden are required")
+		return exitUsage
+	}
+
+	params, ok := analysis.analyzeTemplate(*templateName, stderr)
+	if !ok {
+		return exitFailure
+	}
+	if *update {
+		var buf bytes.Buffer
+		if err := soyusage.WriteYAML(&buf, params); err != nil {
+			fmt.Fprintf(stderr, "soyusage: %v\n", err)
+			return exitFailure
+		}
+		if err := ioutil.WriteFile(*golden, buf.Bytes(), 0644); err != nil {
+			fmt.Fprintf(stderr, "soyusage: %v\n", err)
+			return exitFailure
+		}
+		return 0
+	}
+
+	f, err := os.Open(*golden)
+	if err != nil {
+		fmt.Fprintf(stderr, "soyusage: %v\n", err)
+		return exitFailure
+	}
+	defer f.Close()
+	expected, err := soyusage.ReadYAML(f)
+	if err != nil {
+		fmt.Fprintf(stderr, "soyusage: reading %v: %v\n", *golden, err)
+		return exitFailure
+	}
+	changes := soyusage.Diff(expected, params)
+	if changes.Empty() {
+		return 0
+	}
+	fmt.Fprintln(stdout, changes)
+	fmt.Fprintf(stderr, "soyusage: usage of %v differs from %v, run with -update to accept the changes\n", *templateName, *golden)
+	return exitFailure
+}
+
+func runFilter(args []string, stdout, stderr io.Writer) int {
+	var (
+		analysis     analysisFlags
+		flags        = flag.NewFlagSet("filter", flag.ContinueOnError)
+		templateName = flags.String("template", "", "fully-qualified name of the template to analyze, such as test.main")
+		dataFile     = flags.String("data", "", "JSON file containing an object of the template's params")
+		keepUnknown  = flags.Bool("keep-unknown", true, "keep every entry of maps accessed with unknown keys")
+		ijFile       = flags.String("ij", "", "JSON file containing injected data; not supported, as $ij is not analyzed")
+	)
+	analysis.register(flags)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *templateName == "" || *dataFile == "" {
+		fmt.Fprintln(stderr, "soyusage: -template and -data are required")
+		return exitUsage
+	}
+	if *ijFile != "" {
+		fmt.Fprintln(stderr, "soyusage: -ij is not supported, as usage of injected data ($ij) is not analyzed")
+		return exitUsage
+	}
+
+	params, ok := analysis.analyzeTemplate(*templateName, stderr)
+	if !ok {
+		return exitFailure
+	}
+	in, err := readJSONObject(*dataFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "soyusage: reading %v: %v\n", *dataFile, err)
+		return exitFailure
+	}
+	out := soyusage.Extract(in, params, soyusage.ExtractUnknownKeys(*keepUnknown))
+	before, err := json.Marshal(in)
+	if err != nil {
+		fmt.Fprintf(stderr, "soyusage: %v\n", err)
+		return exitFailure
+	}
+	after, err := json.Marshal(out)
+	if err != nil {
+		fmt.Fprintf(stderr, "soyusage: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "%s\n", after)
+	fmt.Fprintf(stderr, "soyusage: %d bytes before filtering, %d bytes after\n", len(before), len(after))
+	return 0
+}
+
+// readJSONObject reads a JSON object as soy data. Whole numbers are read as
+// integers, so they may be used as list indices.
+func readJSONObject(filename string) (data.Map, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var values map[string]interface{}
+	decoder := json.NewDecoder(f)
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	var out = make(data.Map)
+	for name, value := range values {
+		out[name] = data.New(jsonValue(value))
+	}
+	return out, nil
+}
+
+// jsonValue replaces the numbers within a decoded JSON value with integers
+// or floats.
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = jsonValue(item)
+		}
+	case []interface{}:
+		for index, item := range value {
+			value[index] = jsonValue(item)
+		}
+	}
+	return value
+}
+
+// reportError describes a failed analysis, with the location and expression
+// of each construct that caused it where known.
+func reportError(w io.Writer, err error) {
+	switch err := err.(type) {
+	case *soyusage.AnalysisError:
+		fmt.Fprintf(w, "soyusage: %v\n", err)
+		if err.Expression != "" {
+			fmt.Fprintf(w, "\t%v\n", err.Expression)
+		}
+	case *soyusage.StrictError:
+		for _, e := range err.Errors {
+			reportError(w, e)
+		}
+	case *soyusage.UnknownAccessError:
+		fmt.Fprintf(w, "soyusage: unknown access in template %v:\n", err.Template)
+		for _, path := range err.Paths {
+			fmt.Fprintf(w, "\t%v\n", path)
+		}
+	default:
+		fmt.Fprintf(w, "soyusage: %v\n", err)
+	}
+}
+
+var formats = []string{"json", "yaml", "paths"}
+
+func isFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResults writes the analysis of one or more templates in the given format.
+//
+// The json format is the usage map for the template, as produced by
+// soyusage.Params.ToMap, or an object of usage maps keyed by template name
+// where all templates are written. The yaml format is a document for each
+// template as written by soyusage.WriteYAML, preceded by a comment naming
+// the template where all templates are written. The paths format lists the
+// paths given by soyusage.FlattenUsage, prefixed with the template name
+// where all templates are written.
+func writeResults(w io.Writer, results map[string]soyusage.Params, format string, all bool) error {
+	var names []string
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	switch format {
+	case "json":
+		var out interface{}
+		if all {
+			usage := make(map[string]interface{})
+			for name, params := range results {
+				usage[name] = params.ToMap(soyusage.MapOptions{})
+			}
+			out = usage
+		} else {
+			out = results[names[0]].ToMap(soyusage.MapOptions{})
+		}
+		encoded, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", encoded)
+		return err
+	case "yaml":
+		for index, name := range names {
+			if all {
+				if index > 0 {
+					fmt.Fprintln(w, "---")
+				}
+				fmt.Fprintf(w, "# %v\n", name)
+			}
+			if err := soyusage.WriteYAML(w, results[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "paths":
+		var lines []string
+		for _, name := range names {
+			for _, path := range soyusage.FlattenUsage(results[name].ToMap(soyusage.MapOptions{})) {
+				if all {
+					path = name + " " + path
+				}
+				lines = append(lines, path+"\n")
+			}
+		}
+		_, err := io.WriteString(w, strings.Join(lines, ""))
+		return err
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates a temporary directory containing the given files, keyed
+// by their path relative to the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "soyusage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var testTemplates = map[string]string{
+	"test.soy": `
+		{namespace test}
+		/**
+		* @param profile
+		* @param items
+		*/
+		{template .main}
+			{$profile.name}
+			{foreach $item in $items}{$item.label}{/foreach}
+			{call test.link data="$profile"/}
+		{/template}
+	`,
+	"sub/link.soy": `
+		{namespace test}
+		/**
+		* @param url
+		*/
+		{template .link}
+			<a href="{$url}">link</a>
+		{/template}
+	`,
+	"README.md": "not a template",
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, testTemplates)
+	defer os.RemoveAll(dir)
+	failing := writeFiles(t, map[string]string{
+		"test.soy": `
+			{namespace test}
+			/**
+			* @param a
+			*/
+			{template .main}
+				{myFunc($a.b)}
+			{/template}
+		`,
+	})
+	defer os.RemoveAll(failing)
+	withGlobals := writeFiles(t, map[string]string{
+		"globals.json": `{"test.KEY": "name", "test.INDEX": 1}`,
+		"globals.soy": `
+			{namespace test}
+			/**
+			* @param a
+			*/
+			{template .globals}
+				{$a[test.KEY]}{$a.list[test.INDEX]}
+			{/template}
+		`,
+	})
+	defer os.RemoveAll(withGlobals)
+
+	var tests = []struct {
+		name         string
+		args         []string
+		expectedCode int
+		expectedOut  string
+		// expectedErr is a substring of the expected stderr
+		expectedErr string
+	}{
+		{
+			name: "analyze one template as json",
+			args: []string{"analyze", "-dir", dir, "-template", "test.main"},
+			expectedOut: `{
+  "items": {
+    "label": "*"
+  },
+  "profile": {
+    "name": "*",
+    "url": "*"
+  }
+}
+`,
+		},
+		{
+			name: "analyze one template as yaml",
+			args: []string{"analyze", "-dir", dir, "-template", "test.main", "-format", "yaml"},
+			expectedOut: `items:
+  "[]":
+    label: full
+profile:
+  name: full
+  url: full
+`,
+		},
+		{
+			name: "analyze all templates as paths",
+			args: []string{"analyze", "-dir", dir, "-all", "-format", "paths"},
+			expectedOut: `test.link url
+test.main items.label
+test.main profile.name
+test.main profile.url
+`,
+		},
+		{
+			name: "analyze all templates as yaml",
+			args: []string{"analyze", "-dir", dir, "-all", "-format", "yaml"},
+			expectedOut: `# test.link
+url: full
+---
+# test.main
+items:
+  "[]":
+    label: full
+profile:
+  name: full
+  url: full
+`,
+		},
+		{
+			name:        "globals from json",
+			args:        []string{"analyze", "-dir", withGlobals, "-template", "test.globals", "-globals", filepath.Join(withGlobals, "globals.json"), "-format", "paths"},
+			expectedOut: "a.list.[1]\na.name\n",
+		},
+		{
+			name:         "strict analysis failure",
+			args:         []string{"analyze", "-dir", failing, "-template", "test.main", "-strict"},
+			expectedCode: exitFailure,
+			expectedErr:  "test.soy:7:13 in template test.main: unknown function myFunc($a.b)\n\tmyFunc($a.b)\n",
+		},
+		{
+			name:         "template not found",
+			args:         []string{"analyze", "-dir", dir, "-template", "test.missing"},
+			expectedCode: exitFailure,
+			expectedErr:  "template not found: test.missing",
+		},
+		{
+			name:         "missing directory",
+			args:         []string{"analyze", "-dir", filepath.Join(dir, "missing"), "-all"},
+			expectedCode: exitFailure,
+			expectedErr:  "no such file or directory",
+		},
+		{
+			name:         "template and all",
+			args:         []string{"analyze", "-dir", dir, "-all", "-template", "test.main"},
+			expectedCode: exitUsage,
+			expectedErr:  "exactly one of -template or -all is required",
+		},
+		{
+			name:         "unknown format",
+			args:         []string{"analyze", "-dir", dir, "-all", "-format", "xml"},
+			expectedCode: exitUsage,
+			expectedErr:  `unknown format "xml"`,
+		},
+		{
+			name:         "unknown command",
+			args:         []string{"analyse"},
+			expectedCode: exitUsage,
+			expectedErr:  `unknown command "analyse"`,
+		},
+		{
+			name:         "no command",
+			expectedCode: exitUsage,
+			expectedErr:  "usage: soyusage <command> [flags]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(test.args, &stdout, &stderr)
+			if code != test.expectedCode {
+				t.Errorf("expected exit code %d, got %d: %v", test.expectedCode, code, stderr.String())
+			}
+			if stdout.String() != test.expectedOut {
+				t.Errorf("expected output:\n%v\ngot:\n%v", test.expectedOut, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), test.expectedErr) {
+				t.Errorf("expected stderr to contain %q, got %q", test.expectedErr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir := writeFiles(t, testTemplates)
+	defer os.RemoveAll(dir)
+	golden := filepath.Join(dir, "usage.yaml")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"diff", "-dir", dir, "-template", "test.main", "-golden", golden}
+	if code := run(args, &stdout, &stderr); code != exitFailure {
+		t.Errorf("expected a missing golden file to fail, got exit code %d", code)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run(append(args, "-update"), &stdout, &stderr); code != 0 {
+		t.Fatalf("expected update to succeed, got exit code %d: %v", code, stderr.String())
+	}
+	written, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedGolden := `items:
+  "[]":
+    label: full
+profile:
+  name: full
+  url: full
+`
+	if string(written) != expectedGolden {
+		t.Errorf("expected golden file:\n%v\ngot:\n%v", expectedGolden, string(written))
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Errorf("expected no differences, got exit code %d: %v%v", code, stdout.String(), stderr.String())
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("expected no output, got %q", stdout.String())
+	}
+
+	modified := `items:
+  "[]":
+    label: full
+    icon: exists
+profile:
+  name: exists
+  url: full
+`
+	if err := ioutil.WriteFile(golden, []byte(modified), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := run(args, &stdout, &stderr); code != exitFailure {
+		t.Errorf("expected differences to fail, got exit code %d", code)
+	}
+	expectedOut := `- items.icon (exists)
+~ profile.name (exists -> full)
+`
+	if stdout.String() != expectedOut {
+		t.Errorf("expected output:\n%v\ngot:\n%v", expectedOut, stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "run with -update") {
+		t.Errorf("expected stderr to suggest -update, got %q", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"diff", "-dir", dir, "-template", "test.main"}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected a missing golden flag to be a usage error, got exit code %d", code)
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"test.soy": `
+			{namespace test}
+			/**
+			* @param profile
+			* @param labels
+			* @param key
+			*/
+			{template .main}
+				{$profile.name}
+				{$labels[$key].text}
+				{$labels.fixed.text}
+			{/template}
+		`,
+		"payload.json": `{
+			"profile": {"name": "Name", "email": "name@example.com"},
+			"labels": {
+				"fixed": {"text": "Fixed", "lang": "en"},
+				"other": {"text": "Other", "lang": "fr"}
+			},
+			"key": "other",
+			"unused": [1, 2, 3]
+		}`,
+	})
+	defer os.RemoveAll(dir)
+	payload := filepath.Join(dir, "payload.json")
+
+	var tests = []struct {
+		name         string
+		args         []string
+		expectedCode int
+		expectedOut  string
+		expectedErr  string
+	}{
+		{
+			name:        "filter payload",
+			args:        []string{"filter", "-dir", dir, "-template", "test.main", "-data", payload},
+			expectedOut: `{"key":"other","labels":{"fixed":{"text":"Fixed"},"other":{"text":"Other"}},"profile":{"name":"Name"}}` + "\n",
+			expectedErr: "soyusage: 170 bytes before filtering, 102 bytes after\n",
+		},
+		{
+			name:        "filter payload without unknown keys",
+			args:        []string{"filter", "-dir", dir, "-template", "test.main", "-data", payload, "-keep-unknown=false"},
+			expectedOut: `{"key":"other","labels":{"fixed":{"text":"Fixed"}},"profile":{"name":"Name"}}` + "\n",
+			expectedErr: "soyusage: 170 bytes before filtering, 77 bytes after\n",
+		},
+		{
+			name:         "missing payload",
+			args:         []string{"filter", "-dir", dir, "-template", "test.main", "-data", filepath.Join(dir, "missing.json")},
+			expectedCode: exitFailure,
+			expectedErr:  "no such file or directory",
+		},
+		{
+			name:         "missing data flag",
+			args:         []string{"filter", "-dir", dir, "-template", "test.main"},
+			expectedCode: exitUsage,
+			expectedErr:  "-template and -data are required",
+		},
+		{
+			name:         "injected data",
+			args:         []string{"filter", "-dir", dir, "-template", "test.main", "-data", payload, "-ij", payload},
+			expectedCode: exitUsage,
+			expectedErr:  "-ij is not supported",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(test.args, &stdout, &stderr)
+			if code != test.expectedCode {
+				t.Errorf("expected exit code %d, got %d: %v", test.expectedCode, code, stderr.String())
+			}
+			if stdout.String() != test.expectedOut {
+				t.Errorf("expected output:\n%v\ngot:\n%v", test.expectedOut, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), test.expectedErr) {
+				t.Errorf("expected stderr to contain %q, got %q", test.expectedErr, stderr.String())
+			}
+		})
+	}
+}
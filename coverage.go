@@ -0,0 +1,37 @@
+package soyusage
+
+// Coverage calculates the fraction of leaf params in an analysis result with
+// known usage, as a value between 0 and 1.
+//
+// A leaf is considered unknown if it has UsageUnknown, or is accessed through
+// a map index that could not be determined ([?]). A result with no leaves has
+// full coverage.
+func Coverage(params Params) float64 {
+	known, total := countCoverage(params, false)
+	if total == 0 {
+		return 1
+	}
+	return float64(known) / float64(total)
+}
+
+func countCoverage(params Params, underMapIndex bool) (known int, total int) {
+	for name, param := range params {
+		unknown := underMapIndex || name == (MapIndex{})
+		if len(param.Children) > 0 {
+			childKnown, childTotal := countCoverage(param.Children, unknown)
+			known += childKnown
+			total += childTotal
+			continue
+		}
+		for _, usage := range param.Usage {
+			if usage.Type == UsageUnknown {
+				unknown = true
+			}
+		}
+		if !unknown {
+			known++
+		}
+		total++
+	}
+	return known, total
+}
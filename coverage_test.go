@@ -0,0 +1,63 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestCoverage(t *testing.T) {
+	var tests = []struct {
+		name     string
+		template string
+		expected float64
+	}{
+		{
+			name: "no params",
+			template: `
+				{namespace test}
+				{template .main}
+					Hello
+				{/template}
+			`,
+			expected: 1,
+		},
+		{
+			name: "all known",
+			template: `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{$a.b}
+					{if $a.c}{/if}
+				{/template}
+			`,
+			expected: 1,
+		},
+		{
+			name: "unknown function and map index",
+			template: `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				*/
+				{template .main}
+					{$a.known}
+					{myFunc($a.func)}
+					{$a[$b].d}
+				{/template}
+			`,
+			expected: 0.5,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := analyzeSource(t, test.template)
+			must.BeEqual(t, test.expected, soyusage.Coverage(params))
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package soyusage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Changes describes the differences between two parameter trees, as found by Diff.
+// Each list is sorted by path.
+type Changes struct {
+	// Added lists the leaves only present in the new tree
+	Added []UsageChange
+	// Removed lists the leaves only present in the old tree
+	Removed []UsageChange
+	// Changed lists the leaves present in both trees with different types of usage
+	Changed []UsageChange
+	// Widened lists the maps that are accessed with unknown keys ([?]) in the
+	// new tree, but not the old
+	Widened []UsageChange
+	// Narrowed lists the maps that are accessed with unknown keys in the old
+	// tree, but not the new
+	Narrowed []UsageChange
+}
+
+// UsageChange describes a change at a dotted path, such as "profile.name".
+type UsageChange struct {
+	Path string
+	// Old lists the distinct types of usage in the old tree, in order
+	Old []UsageType
+	// New lists the distinct types of usage in the new tree, in order
+	New []UsageType
+	// OldOptional is true if all full usage in the old tree is of an optional value
+	OldOptional bool
+	// NewOptional is true if all full usage in the new tree is of an optional value
+	NewOptional bool
+}
+
+// Diff compares two parameter trees by the dotted path to each leaf.
+//
+// A map that becomes accessed with unknown keys is reported as a single widening
+// change, rather than as the removal of constant keys it no longer needs, or the
+// addition of the fields accessed under unknown keys. Narrowing is the reverse.
+// References, where a param is passed on to be used elsewhere, are not compared.
+func Diff(old, new Params) Changes {
+	var changes Changes
+	diffParams(&changes, old, new, nil, make(map[*Param]bool))
+	return changes
+}
+
+// Empty returns true iff there are no changes.
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 &&
+		len(c.Removed) == 0 &&
+		len(c.Changed) == 0 &&
+		len(c.Widened) == 0 &&
+		len(c.Narrowed) == 0
+}
+
+// String lists the changes with a line for each, sorted by path. Lines are
+// prefixed with "+" for added leaves, "-" for removed leaves, "~" for changed
+// usage, such as "~ profile.avatar (exists -> full)", and "*" for widening or
+// narrowing. Full usage of an optional value is described as optional.
+func (c Changes) String() string {
+	if c.Empty() {
+		return "no changes"
+	}
+	type line struct {
+		path string
+		text string
+	}
+	var lines []line
+	for _, change := range c.Added {
+		lines = append(lines, line{change.Path, fmt.Sprintf("+ %v (%v)", change.Path, usageKinds(change.New, change.NewOptional))})
+	}
+	for _, change := range c.Removed {
+		lines = append(lines, line{change.Path, fmt.Sprintf("- %v (%v)", change.Path, usageKinds(change.Old, change.OldOptional))})
+	}
+	for _, change := range c.Changed {
+		lines = append(lines, line{change.Path, fmt.Sprintf("~ %v (%v -> %v)", change.Path, usageKinds(change.Old, change.OldOptional), usageKinds(change.New, change.NewOptional))})
+	}
+	for _, change := range c.Widened {
+		lines = append(lines, line{change.Path, fmt.Sprintf("* %v widened to unknown keys", change.Path)})
+	}
+	for _, change := range c.Narrowed {
+		lines = append(lines, line{change.Path, fmt.Sprintf("* %v narrowed to constant keys", change.Path)})
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].path < lines[j].path
+	})
+	var out []string
+	for _, l := range lines {
+		out = append(out, l.text)
+	}
+	return strings.Join(out, "\n")
+}
+
+func usageKinds(usageTypes []UsageType, optional bool) string {
+	if len(usageTypes) == 0 {
+		return "no usage"
+	}
+	var names []string
+	for _, usageType := range usageTypes {
+		if usageType == UsageFull && optional {
+			names = append(names, "optional")
+			continue
+		}
+		names = append(names, usageType.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+func diffParams(changes *Changes, old, new Params, parent []string, visiting map[*Param]bool) {
+	var names = make(Params)
+	for name := range old {
+		names[name] = nil
+	}
+	for name := range new {
+		names[name] = nil
+	}
+	for _, name := range sortedNames(names) {
+		var (
+			oldParam = old[name]
+			newParam = new[name]
+			path     = append(parent[:len(parent):len(parent)], name.String())
+		)
+		if visiting[oldParam] || visiting[newParam] {
+			continue
+		}
+		switch {
+		case oldParam == nil:
+			diffLeaves(&changes.Added, newParam, path, false, visiting)
+		case newParam == nil:
+			diffLeaves(&changes.Removed, oldParam, path, true, visiting)
+		case len(oldParam.Children) == 0 && len(newParam.Children) == 0:
+			change := UsageChange{
+				Path:        strings.Join(path, "."),
+				Old:         comparedUsageTypes(oldParam),
+				New:         comparedUsageTypes(newParam),
+				OldOptional: isOptionalUsage(oldParam),
+				NewOptional: isOptionalUsage(newParam),
+			}
+			if !equalUsageTypes(change.Old, change.New) || change.OldOptional != change.NewOptional {
+				changes.Changed = append(changes.Changed, change)
+			}
+		case len(oldParam.Children) == 0 || len(newParam.Children) == 0:
+			diffLeaves(&changes.Removed, oldParam, path, true, visiting)
+			diffLeaves(&changes.Added, newParam, path, false, visiting)
+		default:
+			visiting[oldParam] = true
+			visiting[newParam] = true
+			diffChildren(changes, oldParam.Children, newParam.Children, path, visiting)
+			delete(visiting, oldParam)
+			delete(visiting, newParam)
+		}
+	}
+}
+
+// diffChildren compares the children of a map, reporting a change of access
+// with unknown keys once, in place of the constant keys it covers.
+func diffChildren(changes *Changes, old, new Params, path []string, visiting map[*Param]bool) {
+	_, oldUnknown := old[MapIndex{}]
+	_, newUnknown := new[MapIndex{}]
+	if oldUnknown == newUnknown {
+		diffParams(changes, old, new, path, visiting)
+		return
+	}
+	var (
+		oldCompared = make(Params)
+		newCompared = make(Params)
+		change      = UsageChange{Path: strings.Join(path, ".")}
+	)
+	for name, param := range old {
+		if _, isIndex := name.(MapIndex); !isIndex && (!newUnknown || new[name] != nil) {
+			oldCompared[name] = param
+		}
+	}
+	for name, param := range new {
+		if _, isIndex := name.(MapIndex); !isIndex && (!oldUnknown || old[name] != nil) {
+			newCompared[name] = param
+		}
+	}
+	if newUnknown {
+		changes.Widened = append(changes.Widened, change)
+	} else {
+		changes.Narrowed = append(changes.Narrowed, change)
+	}
+	diffParams(changes, oldCompared, newCompared, path, visiting)
+}
+
+// diffLeaves lists every leaf of a param that is only present in one tree.
+func diffLeaves(list *[]UsageChange, param *Param, path []string, isOld bool, visiting map[*Param]bool) {
+	if len(param.Children) == 0 {
+		change := UsageChange{Path: strings.Join(path, ".")}
+		if isOld {
+			change.Old, change.OldOptional = comparedUsageTypes(param), isOptionalUsage(param)
+		} else {
+			change.New, change.NewOptional = comparedUsageTypes(param), isOptionalUsage(param)
+		}
+		*list = append(*list, change)
+		return
+	}
+	visiting[param] = true
+	for _, name := range sortedNames(param.Children) {
+		child := param.Children[name]
+		if !visiting[child] {
+			diffLeaves(list, child, append(path[:len(path):len(path)], name.String()), isOld, visiting)
+		}
+	}
+	delete(visiting, param)
+}
+
+// comparedUsageTypes returns the distinct types of usage of a param, in order,
+// other than references.
+func comparedUsageTypes(param *Param) []UsageType {
+	var out []UsageType
+	for _, usageType := range usageTypes(param) {
+		if usageType != UsageReference {
+			out = append(out, usageType)
+		}
+	}
+	return out
+}
+
+// isOptionalUsage returns true iff a param has full usage, all of which is of an
+// optional value.
+func isOptionalUsage(param *Param) bool {
+	var full bool
+	for _, usage := range param.Usage {
+		if usage.Type == UsageFull {
+			if !usage.Optional {
+				return false
+			}
+			full = true
+		}
+	}
+	return full
+}
+
+func equalUsageTypes(a, b []UsageType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+// diffTemplate is a template using the profile and key params in body.
+func diffTemplate(body string) string {
+	return `
+		{namespace test}
+		/**
+		* @param profile
+		* @param key
+		*/
+		{template .main}
+			` + body + `
+		{/template}
+	`
+}
+
+func TestDiff(t *testing.T) {
+	old := analyzeSource(t, diffTemplate(`
+		{$key}
+		{$profile.name}
+		{$profile.age}
+		{if $profile.avatar}shown{/if}
+		{$profile.fields.first}
+		{$profile.fields.second.label}
+	`))
+	new := analyzeSource(t, diffTemplate(`
+		{$key}
+		{$profile.name}
+		{$profile.bio}
+		{$profile.avatar}
+		{$profile.fields[$key].label}
+	`))
+	changes := soyusage.Diff(old, new)
+	must.BeEqual(t, soyusage.Changes{
+		Added: []soyusage.UsageChange{
+			{Path: "profile.bio", New: []soyusage.UsageType{soyusage.UsageFull}},
+		},
+		Removed: []soyusage.UsageChange{
+			{Path: "profile.age", Old: []soyusage.UsageType{soyusage.UsageFull}},
+		},
+		Changed: []soyusage.UsageChange{
+			{
+				Path: "profile.avatar",
+				Old:  []soyusage.UsageType{soyusage.UsageExists},
+				New:  []soyusage.UsageType{soyusage.UsageFull},
+			},
+		},
+		Widened: []soyusage.UsageChange{
+			{Path: "profile.fields"},
+		},
+	}, changes)
+	must.BeEqual(t, false, changes.Empty())
+	must.BeEqual(t, `- profile.age (full)
+~ profile.avatar (exists -> full)
++ profile.bio (full)
+* profile.fields widened to unknown keys`, changes.String())
+
+	reverse := soyusage.Diff(new, old)
+	must.BeEqual(t, []soyusage.UsageChange{{Path: "profile.fields"}}, reverse.Narrowed)
+	must.BeEqual(t, []soyusage.UsageChange{
+		{Path: "profile.age", New: []soyusage.UsageType{soyusage.UsageFull}},
+	}, reverse.Added)
+}
+
+func TestDiffLeafBecomesMap(t *testing.T) {
+	changes := soyusage.Diff(
+		analyzeSource(t, diffTemplate(`{$key}{$profile}`)),
+		analyzeSource(t, diffTemplate(`{$key}{$profile.name}`)),
+	)
+	must.BeEqual(t, `- profile (full)
++ profile.name (full)`, changes.String())
+}
+
+func TestDiffEmpty(t *testing.T) {
+	params := analyzeSource(t, diffTemplate(`{$key}{$profile.fields[$key]}`))
+	changes := soyusage.Diff(params, params)
+	must.BeEqual(t, true, changes.Empty())
+	must.BeEqual(t, "no changes", changes.String())
+}
@@ -5,4 +5,11 @@
 // The AST for a template is walked, and a tree of parameters is constructed
 // defining the root parameters and sub-fields of these parameters, along with
 // where and how they are used.
+//
+// Only the commands supported by the soy parser can be analyzed. Commands from
+// newer versions of soy, such as {element} and {velog}, fail to compile as prints
+// of the command name, so templates using them cannot be analyzed. Nor does the
+// parser have a command to skip rendering a block, such as {skip}; a block of the
+// form {skip}...{/skip} fails to compile, so there are no skipped accesses to
+// exclude from the analysis.
 package soyusage
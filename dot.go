@@ -0,0 +1,203 @@
+package soyusage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ToDOT renders a parameter tree as a Graphviz DOT digraph, as written by
+// WriteDOT with the root node labeled with the template name and leaf nodes
+// styled by their usage.
+func ToDOT(templateName string, params Params) string {
+	var buf bytes.Buffer
+	// Writes to a bytes.Buffer don't fail
+	_ = WriteDOT(&buf, params, DOTOptions{
+		Name:   templateName,
+		Styles: true,
+	})
+	return buf.String()
+}
+
+func dotStyle(param *Param, unknown bool) string {
+	if unknown {
+		return "dashed"
+	}
+	conditional := len(param.Usage) > 0
+	for _, usage := range param.Usage {
+		if usage.Type == UsageUnknown {
+			return "dashed"
+		}
+		if usage.Type != UsageExists && !usage.Optional {
+			conditional = false
+		}
+	}
+	if conditional {
+		return "dotted"
+	}
+	return "solid"
+}
+
+// DOTOptions configures the output of WriteDOT.
+type DOTOptions struct {
+	// Name labels the root node, such as with the name of the analyzed template.
+	// Defaults to "params".
+	Name string
+	// MaxDepth collapses params with children below this depth into a single
+	// node, labeled with the number of leaves it contains. Params are at depth 1.
+	// A value less than 1 shows the whole tree.
+	MaxDepth int
+	// TemplateLabels labels the edge to each leaf with the templates where
+	// it was used.
+	TemplateLabels bool
+	// Styles styles leaf nodes by their usage: solid for known usage, dashed for
+	// unknown usage, including any field of a map accessed with an unknown key,
+	// and dotted for conditional usage, such as existence checks or optional access.
+	Styles bool
+}
+
+// dotColors are the colors of leaf nodes for each type of usage
+var dotColors = map[UsageType]string{
+	UsageFull:         "black",
+	UsageUnknown:      "red",
+	UsageMeta:         "gray",
+	UsageExists:       "blue",
+	UsageReference:    "black",
+	UsageCSSReference: "purple",
+	UsageKeys:         "darkgreen",
+	UsageXIDReference: "orange",
+}
+
+// dotPrecedence orders types of usage, such that a leaf with several types
+// of usage is colored by the one listed first
+var dotPrecedence = []UsageType{
+	UsageUnknown,
+	UsageFull,
+	UsageReference,
+	UsageMeta,
+	UsageKeys,
+	UsageCSSReference,
+	UsageXIDReference,
+	UsageExists,
+}
+
+// WriteDOT writes a parameter tree to w as a Graphviz DOT digraph.
+//
+// Each param and field is a node, labeled with its name, beneath a root node.
+// Leaf nodes are colored by their usage: black for full usage, red for unknown
+// usage, blue for existence checks, gray for meta usage, dark green for usage of
+// keys, purple for CSS references and orange for xid references.
+func WriteDOT(w io.Writer, usage Params, opts DOTOptions) error {
+	var (
+		buf    bytes.Buffer
+		nextID int
+		name   = opts.Name
+	)
+	if name == "" {
+		name = "params"
+	}
+	buf.WriteString("digraph usage {\n")
+	buf.WriteString("\tnode [shape=box];\n")
+	fmt.Fprintf(&buf, "\tn%d [label=%s, shape=ellipse];\n", nextID, strconv.Quote(name))
+	writeDOTTree(&buf, &nextID, nextID, usage, 1, false, opts)
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeDOTTree(buf *bytes.Buffer, nextID *int, parentID int, params Params, depth int, unknown bool, opts DOTOptions) {
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		*nextID++
+		id := *nextID
+		var (
+			label     = name.String()
+			attrs     string
+			collapsed = opts.MaxDepth > 0 && depth >= opts.MaxDepth && len(param.Children) > 0
+			underKey  = unknown || name == (MapIndex{})
+		)
+		switch {
+		case collapsed:
+			label = fmt.Sprintf("%v (%d)", label, countLeaves(param))
+			attrs = ", shape=folder"
+		case len(param.Children) == 0:
+			attrs = fmt.Sprintf(", color=%v", dotColor(param))
+			if opts.Styles {
+				attrs += fmt.Sprintf(", style=%v", dotStyle(param, underKey))
+			}
+		}
+		fmt.Fprintf(buf, "\tn%d [label=%s%s];\n", id, strconv.Quote(label), attrs)
+		if opts.TemplateLabels && (collapsed || len(param.Children) == 0) {
+			if templates := usageTemplates(param); len(templates) > 0 {
+				fmt.Fprintf(buf, "\tn%d -> n%d [label=%s];\n", parentID, id, strconv.Quote(strings.Join(templates, ", ")))
+				continue
+			}
+		}
+		fmt.Fprintf(buf, "\tn%d -> n%d;\n", parentID, id)
+		if !collapsed {
+			writeDOTTree(buf, nextID, id, param.Children, depth+1, underKey, opts)
+		}
+	}
+}
+
+func dotColor(param *Param) string {
+	for _, usageType := range dotPrecedence {
+		for _, usage := range param.Usage {
+			if usage.Type == usageType {
+				return dotColors[usageType]
+			}
+		}
+	}
+	return "black"
+}
+
+// countLeaves returns the number of params with no children within a param.
+func countLeaves(param *Param) int {
+	if len(param.Children) == 0 {
+		return 1
+	}
+	var count int
+	for _, child := range param.Children {
+		count += countLeaves(child)
+	}
+	return count
+}
+
+// usageTemplates returns the sorted names of the templates where a param or its
+// children were used.
+func usageTemplates(param *Param) []string {
+	var (
+		out  []string
+		seen = make(map[string]bool)
+		add  func(param *Param)
+	)
+	add = func(param *Param) {
+		for _, usage := range param.Usage {
+			if usage.Template != "" && !seen[usage.Template] {
+				seen[usage.Template] = true
+				out = append(out, usage.Template)
+			}
+		}
+		for _, child := range param.Children {
+			add(child)
+		}
+	}
+	add(param)
+	sort.Strings(out)
+	return out
+}
+
+// sortedNames returns the identifiers in a set of params in a stable order
+func sortedNames(params Params) []Identifier {
+	var names []Identifier
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].String() < names[j].String()
+	})
+	return names
+}
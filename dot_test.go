@@ -0,0 +1,127 @@
+package soyusage_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestToDOT(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param a
+		* @param b
+		*/
+		{template .main}
+			{$a.known}
+			{myFunc($a.unknown)}
+			{if $a.exists}{/if}
+			{$b[$a.known].c}
+		{/template}
+	`)
+	must.BeEqual(t, `digraph usage {
+	node [shape=box];
+	n0 [label="test.main", shape=ellipse];
+	n1 [label="a"];
+	n0 -> n1;
+	n2 [label="exists", color=blue, style=dotted];
+	n1 -> n2;
+	n3 [label="known", color=black, style=solid];
+	n1 -> n3;
+	n4 [label="unknown", color=red, style=dashed];
+	n1 -> n4;
+	n5 [label="b"];
+	n0 -> n5;
+	n6 [label="[?]"];
+	n5 -> n6;
+	n7 [label="c", color=black, style=dashed];
+	n6 -> n7;
+}
+`, soyusage.ToDOT("test.main", params))
+}
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// constantAccessFixture is the combined constant and variable values fixture
+// from the constant access tests, with the profile passed to a second template.
+const constantAccessFixture = `
+	{namespace test}
+	/**
+	* @param profile
+	* @param locale
+	* @param alternative
+	*/
+	{template .main}
+		{let $textField}
+			{if $locale == 'en'}
+				c_lifeAbout
+			{else}
+				{$alternative}
+			{/if}
+		{/let}
+		{$profile[$textField]}
+		{call .details}
+			{param profile: $profile /}
+		{/call}
+	{/template}
+
+	/**
+	* @param profile
+	*/
+	{template .details}
+		{if $profile.photo}{$profile.photo.url}{/if}
+		{if $profile.nickname}shown{/if}
+		{length($profile.friends)}
+		{myFunc($profile.location)}
+	{/template}
+`
+
+func TestWriteDOT(t *testing.T) {
+	params := analyzeSource(t, constantAccessFixture)
+	var tests = []struct {
+		name   string
+		golden string
+		opts   soyusage.DOTOptions
+	}{
+		{
+			name:   "full tree",
+			golden: "constant_access.dot",
+			opts: soyusage.DOTOptions{
+				Name:           "test.main",
+				TemplateLabels: true,
+			},
+		},
+		{
+			name:   "collapsed",
+			golden: "constant_access_collapsed.dot",
+			opts: soyusage.DOTOptions{
+				MaxDepth: 1,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := soyusage.WriteDOT(&buf, params, test.opts); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", test.golden)
+			if *updateGolden {
+				if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			must.BeEqual(t, string(expected), buf.String())
+		})
+	}
+}
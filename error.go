@@ -2,68 +2,119 @@ package soyusage
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/robfig/soy/ast"
-	"github.com/robfig/soy/template"
 )
 
-var _ error = &usageError{}
+var _ error = &AnalysisError{}
+var _ error = &StrictError{}
+var _ error = &UnknownAccessError{}
 
-type usageError struct {
-	message string
-	cause   error
-
-	node     ast.Node
-	template string
-	registry *template.Registry
+// AnalysisError describes a failure to analyze a template, and the location
+// in the template where it occurred.
+type AnalysisError struct {
+	// Template is the name of the template being analyzed
+	Template string
+	// File is the soy file containing the template
+	File string
+	// Line is the line number of the failing node within File
+	Line int
+	// Col is the column of the failing node within Line
+	Col int
+	// Pos is the position of the failing node within File
+	Pos ast.Pos
+	// Expression is the string form of the failing node
+	Expression string
+	// Err is the underlying cause of this error
+	Err error
 }
 
-func newErrorf(s *scope, node ast.Node, message string, args ...interface{}) *usageError {
-	return &usageError{
-		message: fmt.Sprintf(message, args...),
-
-		node:     node,
-		template: s.templateName,
-		registry: s.registry,
-	}
+func newErrorf(s *scope, node ast.Node, message string, args ...interface{}) *AnalysisError {
+	return newAnalysisError(s, node, fmt.Errorf(message, args...))
 }
 
-func wrapError(s *scope, node ast.Node, err error) *usageError {
+// wrapError wraps an error with the position of the current node.
+// AnalysisErrors are returned unchanged, so the position of the node
+// closest to the failure is retained.
+func wrapError(s *scope, node ast.Node, err error) error {
 	if err == nil {
 		return nil
 	}
-	return &usageError{
-		cause: err,
+	if _, isAnalysisError := err.(*AnalysisError); isAnalysisError {
+		return err
+	}
+	if _, isStrictError := err.(*StrictError); isStrictError {
+		return err
+	}
+	return newAnalysisError(s, node, err)
+}
 
-		node:     node,
-		template: s.templateName,
-		registry: s.registry,
+func newAnalysisError(s *scope, node ast.Node, err error) *AnalysisError {
+	out := &AnalysisError{
+		Template: s.templateName,
+		Err:      err,
+	}
+	position := node
+	if s.attribute != nil {
+		position = s.attribute
 	}
+	if node != nil {
+		out.Pos = position.Position()
+		out.Expression = node.String()
+	}
+	if s.registry != nil {
+		out.File = s.registry.Filename(s.templateName)
+		if node != nil {
+			out.Line = s.registry.LineNumber(s.templateName, position)
+			out.Col = s.registry.ColNumber(s.templateName, position)
+		}
+	}
+	return out
 }
 
-func (u *usageError) Error() string {
-	if u.cause != nil {
-		return fmt.Sprintf("%v\n%v", u.cause.Error(), u.posText())
+func (e *AnalysisError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("in template %v: %v", e.Template, e.Err)
 	}
-	return fmt.Sprintf("%v (%v)", u.message, u.posText())
+	return fmt.Sprintf("%v:%d:%d in template %v: %v", e.File, e.Line, e.Col, e.Template, e.Err)
+}
+
+// Unwrap returns the underlying cause of this error.
+func (e *AnalysisError) Unwrap() error {
+	return e.Err
+}
+
+// StrictError is returned by a strict analysis when the usage of one or more
+// parameters could not be determined.
+type StrictError struct {
+	// Errors describes each construct with unknown usage
+	Errors []error
 }
 
-func (u *usageError) posText() string {
-	var shortNode = fmt.Sprint(u.node)
-	if len(shortNode) > 10 {
-		shortNode = shortNode[:10]
+func (e *StrictError) Error() string {
+	var messages []string
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
 	}
-	return fmt.Sprintf("%s, line %d, col %d near %q", u.filename(), u.row(), u.col(), shortNode)
+	return fmt.Sprintf("%d unknown usages:\n%v", len(e.Errors), strings.Join(messages, "\n"))
 }
 
-func (u *usageError) filename() string {
-	return u.registry.Filename(u.template)
+// Unwrap returns the errors for each construct with unknown usage.
+func (e *StrictError) Unwrap() []error {
+	return e.Errors
 }
 
-func (u *usageError) col() int {
-	return u.registry.ColNumber(u.template, u.node)
+// UnknownAccessError is returned by an analysis in strict mode when the
+// result contains unknown access.
+type UnknownAccessError struct {
+	// Template is the name of the analyzed template
+	Template string
+	// Paths lists the dot-separated paths to each unknown map key ([?]) or
+	// param with unknown usage, in a stable order
+	Paths []string
 }
 
-func (u *usageError) row() int {
-	return u.registry.LineNumber(u.template, u.node)
+func (e *UnknownAccessError) Error() string {
+	return fmt.Sprintf("%d unknown accesses in template %v:\n%v", len(e.Paths), e.Template, strings.Join(e.Paths, "\n"))
 }
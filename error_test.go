@@ -0,0 +1,51 @@
+package soyusage_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestAnalysisError(t *testing.T) {
+	registry, err := soy.NewBundle().AddTemplateString("test.soy", `
+{namespace test}
+/**
+* @param profile
+* @param x
+*/
+{template .main}
+	{$profile[$x.key]}
+{/template}
+`).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("template not found", func(t *testing.T) {
+		_, err := soyusage.AnalyzeTemplate("test.missing", registry)
+		var analysisErr *soyusage.AnalysisError
+		if !errors.As(err, &analysisErr) {
+			t.Fatalf("expected an AnalysisError, got %v", err)
+		}
+		must.BeEqual(t, "test.missing", analysisErr.Template)
+		must.BeEqual(t, "in template test.missing: template not found: test.missing", err.Error())
+	})
+
+	t.Run("position is populated", func(t *testing.T) {
+		_, err := soyusage.AnalyzeTemplate("test.main", registry, soyusage.Strict())
+		var analysisErr *soyusage.AnalysisError
+		if !errors.As(err, &analysisErr) {
+			t.Fatalf("expected an AnalysisError, got %v", err)
+		}
+		must.BeEqual(t, "test.main", analysisErr.Template)
+		must.BeEqual(t, "test.soy", analysisErr.File)
+		must.BeEqual(t, 8, analysisErr.Line)
+		must.BeEqual(t, 13, analysisErr.Col)
+		must.BeEqual(t, "[$x.key]", analysisErr.Expression)
+		must.BeEqual(t, "test.soy:8:13 in template test.main: cannot resolve map key expression [$x.key]", analysisErr.Error())
+		must.BeEqual(t, "cannot resolve map key expression [$x.key]", errors.Unwrap(analysisErr).Error())
+	})
+}
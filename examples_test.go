@@ -2,8 +2,10 @@ package soyusage_test
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/robfig/soy"
+	"github.com/robfig/soy/soyhtml"
 	"github.com/theothertomelliott/soyusage"
 )
 
@@ -42,3 +44,36 @@ func ExampleAnalyzeTemplate() {
 	// Output: $a.b: Full usage
 	// $a.c: Unknown usage
 }
+
+func ExampleAnalyzeTemplate_sharedRegistry() {
+	bundle := soy.NewBundle()
+	bundle = bundle.AddTemplateString(
+		"example.soy",
+		`
+{namespace example}
+/**
+* @param a
+*/
+{template .main}
+	{$a.b}
+{/template}
+		`,
+	)
+	// Compile the bundle once, and use the same registry for rendering and analysis
+	registry, _ := bundle.Compile()
+	tofu := soyhtml.NewTofu(registry)
+	tree, _ := soyusage.AnalyzeTemplate("example.main", registry)
+
+	data := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": "Hello",
+			"c": "unused",
+		},
+	}
+	tofu.Render(os.Stdout, "example.main", data)
+	fmt.Println()
+	fmt.Println(len(tree[soyusage.Name("a")].Children))
+
+	// Output: Hello
+	// 1
+}
@@ -4,9 +4,33 @@ import (
 	"github.com/robfig/soy/data"
 )
 
+// ExtractOption configures the data returned by Extract.
+type ExtractOption func(*extractConfig)
+
+type extractConfig struct {
+	dropUnknownKeys bool
+}
+
+// ExtractUnknownKeys sets whether every entry of a map accessed with unknown
+// keys ([?]) is kept, which is the default. Otherwise, only the entries for
+// constant keys are kept, which may remove data the template uses.
+func ExtractUnknownKeys(keep bool) ExtractOption {
+	return func(c *extractConfig) {
+		c.dropUnknownKeys = !keep
+	}
+}
+
 // Extract returns a version of the input data containing only
 // the values specified in the provided usage analysis.
-func Extract(in data.Value, params Params) data.Value {
+func Extract(in data.Value, params Params, opts ...ExtractOption) data.Value {
+	var cfg extractConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return extractValue(in, params, cfg)
+}
+
+func extractValue(in data.Value, params Params, cfg extractConfig) data.Value {
 	var (
 		out          = make(data.Map)
 		inMap, isMap = in.(data.Map)
@@ -18,14 +42,17 @@ func Extract(in data.Value, params Params) data.Value {
 	for paramName, param := range params {
 		inValue := inMap[paramName.String()]
 		if (MapIndex{}) == paramName {
-			values := extractMap(param, inMap)
+			if cfg.dropUnknownKeys {
+				continue
+			}
+			values := extractMap(param, inMap, cfg)
 			for name, value := range values {
 				out[name] = value
 			}
 		}
 
 		var outVal data.Value
-		outVal = extractParam(param, inValue)
+		outVal = extractParam(param, inValue, cfg)
 		if outVal != nil {
 			out[paramName.String()] = outVal
 		}
@@ -33,7 +60,7 @@ func Extract(in data.Value, params Params) data.Value {
 	return out
 }
 
-func extractMap(param *Param, in data.Value) data.Map {
+func extractMap(param *Param, in data.Value, cfg extractConfig) data.Map {
 	var (
 		out          = make(data.Map)
 		inMap, isMap = in.(data.Map)
@@ -42,39 +69,92 @@ func extractMap(param *Param, in data.Value) data.Map {
 		return nil
 	}
 	for name, value := range inMap {
-		out[name] = Extract(value, param.Children)
+		out[name] = extractParam(param, value, cfg)
 	}
 	return out
 }
 
-func extractParam(param *Param, in data.Value) data.Value {
+func extractParam(param *Param, in data.Value, cfg extractConfig) data.Value {
 	if in == nil {
 		return nil
 	}
 	if listValue, isList := in.(data.List); isList {
+		if indexes, onlyIndexes := indexedElements(param); onlyIndexes {
+			return extractIndexes(indexes, listValue, cfg)
+		}
 		var outList data.List
 		for _, value := range listValue {
-			outList = append(outList, extractParam(param, value))
+			outList = append(outList, extractParam(param, value, cfg))
 		}
 		return outList
 	}
 	var (
 		isFull   bool
 		isExists bool
+		isKeys   bool
 	)
 	for _, usage := range param.Usage {
 		switch usage.Type {
-		case UsageFull, UsageUnknown, UsageMeta:
+		case UsageFull, UsageUnknown, UsageMeta, UsageCSSReference, UsageXIDReference:
 			isFull = true
 		case UsageExists:
 			isExists = true
+		case UsageKeys:
+			isKeys = true
 		}
 	}
 	if isFull {
 		return in
 	}
+	if inMap, isMap := in.(data.Map); isMap && isKeys {
+		// Keep every key, with null values for any that are not otherwise used
+		out := extractValue(inMap, param.Children, cfg).(data.Map)
+		for key := range inMap {
+			if _, exists := out[key]; !exists {
+				out[key] = data.Null{}
+			}
+		}
+		return out
+	}
 	if isExists && len(param.Children) == 0 {
 		return data.String("")
 	}
-	return Extract(in, param.Children)
+	return extractValue(in, param.Children, cfg)
+}
+
+// indexedElements returns the elements of a list param accessed by constant index,
+// and whether these are the only elements used.
+func indexedElements(param *Param) (map[int]*Param, bool) {
+	if !param.IsList || param.iterated || len(param.Usage) > 0 || len(param.Children) == 0 {
+		return nil, false
+	}
+	var indexes = make(map[int]*Param)
+	for name, child := range param.Children {
+		index, isIndex := name.(ListIndex)
+		if !isIndex {
+			return nil, false
+		}
+		indexes[int(index)] = child
+	}
+	return indexes, true
+}
+
+// extractIndexes returns a list containing only the elements at the given indexes,
+// with any other elements before them replaced by null so indexes are unchanged.
+func extractIndexes(indexes map[int]*Param, in data.List, cfg extractConfig) data.List {
+	var last = -1
+	for index := range indexes {
+		if index > last && index < len(in) {
+			last = index
+		}
+	}
+	var out = make(data.List, last+1)
+	for index := range out {
+		if element, used := indexes[index]; used {
+			out[index] = extractParam(element, in[index], cfg)
+		} else {
+			out[index] = data.Null{}
+		}
+	}
+	return out
 }
@@ -139,6 +139,72 @@ func TestExtract(t *testing.T) {
 				},
 			}),
 		},
+		{
+			name: "unknown map index used in full",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param map
+				* @param index
+				*/
+				{template .main}
+					{$map[$index] | json}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			in: data.New(map[string]interface{}{
+				"map": map[string]interface{}{
+					"a": map[string]interface{}{
+						"value": 1,
+					},
+				},
+			}),
+			expected: data.New(map[string]interface{}{
+				"map": map[string]interface{}{
+					"a": map[string]interface{}{
+						"value": 1,
+					},
+				},
+			}),
+		},
+		{
+			name: "unknown map index dropped",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param map
+				* @param index
+				*/
+				{template .main}
+					{$map[$index].value}
+					{$map.known.value}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			options:      []soyusage.ExtractOption{soyusage.ExtractUnknownKeys(false)},
+			in: data.New(map[string]interface{}{
+				"map": map[string]interface{}{
+					"known": map[string]interface{}{
+						"value":  1,
+						"unused": "ignore1",
+					},
+					"other": map[string]interface{}{
+						"value": 2,
+					},
+				},
+			}),
+			expected: data.New(map[string]interface{}{
+				"map": map[string]interface{}{
+					"known": map[string]interface{}{
+						"value": 1,
+					},
+				},
+			}),
+		},
 		{
 			name: "removes unused parameters",
 			templates: map[string]string{
@@ -339,6 +405,93 @@ func TestExtract(t *testing.T) {
 				"alternative": "alt",
 			}),
 		},
+		{
+			name: "keeps keys without values",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param labels
+				*/
+				{template .main}
+					{foreach $k in keys($labels)}
+						{$k}
+					{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			in: data.New(map[string]interface{}{
+				"labels": map[string]interface{}{
+					"a": "value a",
+					"b": map[string]interface{}{"c": "value c"},
+				},
+			}),
+			expected: data.New(map[string]interface{}{
+				"labels": map[string]interface{}{
+					"a": nil,
+					"b": nil,
+				},
+			}),
+		},
+		{
+			name: "keeps only indexed list elements",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				*/
+				{template .main}
+					{$items[0].name} {$items[2].name}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			in: data.New(map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"name": "a", "x": 1},
+					map[string]interface{}{"name": "b", "x": 2},
+					map[string]interface{}{"name": "c", "x": 3},
+					map[string]interface{}{"name": "d", "x": 4},
+				},
+			}),
+			expected: data.New(map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"name": "a"},
+					nil,
+					map[string]interface{}{"name": "c"},
+				},
+			}),
+		},
+		{
+			name: "keeps all list elements when iterated",
+			templates: map[string]string{
+				"test.soy": `
+				{namespace test}
+				/**
+				* @param items
+				*/
+				{template .main}
+					{$items[0].x}
+					{foreach $item in $items}{$item.name}{/foreach}
+				{/template}
+			`,
+			},
+			templateName: "test.main",
+			in: data.New(map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"name": "a", "x": 1, "y": 1},
+					map[string]interface{}{"name": "b", "x": 2, "y": 2},
+				},
+			}),
+			expected: data.New(map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"name": "a", "x": 1},
+					map[string]interface{}{"name": "b", "x": 2},
+				},
+			}),
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -357,7 +510,7 @@ func TestExtract(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			got := soyusage.Extract(test.in.(data.Map), params)
+			got := soyusage.Extract(test.in.(data.Map), params, test.options...)
 			must.BeEqual(t, test.expected.(data.Map), got)
 			if t.Failed() {
 				t.Log(jsonSprint(mapUsage(params)))
@@ -373,4 +526,5 @@ type extractTest struct {
 	in             data.Value
 	expected       data.Value
 	recursionDepth int
+	options        []soyusage.ExtractOption
 }
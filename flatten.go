@@ -0,0 +1,49 @@
+package soyusage
+
+import "sort"
+
+// FlattenUsage converts a usage map into a sorted list of dotted paths, one for each leaf.
+//
+// The usage map is in the form produced by Params.ToMap with the default options.
+// It nests a map for each param with children, keyed by the names of those
+// children, such as "[?]" for an unknown key. Leaves are strings describing the
+// usage: "e" for an existence check, "~optional~" for an optional usage, "*" for
+// full usage and "?" for unknown usage. Paths to leaves that are only accessed
+// conditionally, by an existence check or optional usage, are suffixed with "?".
+//
+// For example, {"profile": {"name": "*", "[?]": "e"}} is flattened to
+// ["profile.[?]?", "profile.name"].
+func FlattenUsage(usage map[string]interface{}) []string {
+	var out []string
+	flattenUsage(usage, "", &out)
+	sort.Strings(out)
+	return out
+}
+
+func flattenUsage(usage map[string]interface{}, prefix string, out *[]string) {
+	for name, value := range usage {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if children, isMap := value.(map[string]interface{}); isMap && len(children) > 0 {
+			flattenUsage(children, path, out)
+			continue
+		}
+		if isConditionalUsage(value) {
+			path += "?"
+		}
+		*out = append(*out, path)
+	}
+}
+
+// isConditionalUsage returns true iff a leaf of a usage map describes access
+// that only happens conditionally.
+func isConditionalUsage(value interface{}) bool {
+	usage, _ := value.(string)
+	switch usage {
+	case "e", "~optional~":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestFlattenUsage(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param profile
+		* @param category
+		* @param key
+		*/
+		{template .main}
+			{$profile.c_autoAbout}
+			{$profile.c_homeAbout}
+			{if $profile.fields[$key]}shown{/if}
+			{$category}
+		{/template}
+	`)
+	must.BeEqual(t, []string{
+		"category",
+		"key",
+		"profile.c_autoAbout",
+		"profile.c_homeAbout",
+		"profile.fields.[?]?",
+	}, soyusage.FlattenUsage(mapUsage(params)))
+}
+
+func TestFlattenUsageMap(t *testing.T) {
+	must.BeEqual(t, []string{
+		"a.[?]",
+		"a.b?",
+		"a.c",
+		"d",
+		"e?",
+	}, soyusage.FlattenUsage(map[string]interface{}{
+		"a": map[string]interface{}{
+			"[?]": "?",
+			"b":   "~optional~",
+			"c":   "*",
+		},
+		"d": map[string]interface{}{},
+		"e": "e",
+	}))
+}
@@ -1,6 +1,6 @@
 module github.com/theothertomelliott/soyusage
 
-go 1.12
+go 1.16
 
 require (
 	github.com/fsnotify/fsnotify v1.4.7 // indirect
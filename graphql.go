@@ -0,0 +1,203 @@
+package soyusage
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// UnknownKeyStrategy determines how ToGraphQLSelection handles maps accessed
+// with unknown keys ([?]).
+type UnknownKeyStrategy int
+
+const (
+	// UnknownKeysError returns an error for any map accessed with unknown keys
+	UnknownKeysError UnknownKeyStrategy = iota
+	// UnknownKeysOmit selects only the constant keys of the map
+	UnknownKeysOmit
+	// UnknownKeysExpand selects the known fields listed for the map in
+	// GQLOptions.KnownFields, each with the fields used from unknown keys
+	UnknownKeysExpand
+)
+
+// GQLOptions configures the selection set generated by ToGraphQLSelection.
+type GQLOptions struct {
+	// UnknownKeys is the strategy for maps accessed with unknown keys
+	UnknownKeys UnknownKeyStrategy
+	// KnownFields lists the possible keys of maps accessed with unknown keys,
+	// by the dotted path to the map as given by FlattenUsage, such as
+	// "profile.fields". Used by UnknownKeysExpand.
+	KnownFields map[string][]string
+	// FieldNames maps keys that are not valid GraphQL names, such as
+	// "c_life-about", to the field selected for them
+	FieldNames map[string]string
+	// OmitInvalidNames omits keys that are not valid GraphQL names and are not
+	// in FieldNames, rather than returning an error
+	OmitInvalidNames bool
+}
+
+var gqlName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// gqlSelection is a selection set, keyed by field name. Leaf fields have a nil selection.
+type gqlSelection map[string]gqlSelection
+
+// ToGraphQLSelection renders a parameter tree as a GraphQL selection set, with
+// nested selections for fields with children and a bare name for each leaf.
+//
+// Lists are selected as their elements. Fields whose selection would be empty,
+// such as maps only accessed with omitted unknown keys, are left out. A param
+// that contains itself is not selected again within itself.
+func ToGraphQLSelection(usage Params, opts GQLOptions) (string, error) {
+	selection, err := gqlSelect(usage, "", opts, make(map[*Param]bool))
+	if err != nil {
+		return "", err
+	}
+	if len(selection) == 0 {
+		return "", fmt.Errorf("no fields to select")
+	}
+	var buf bytes.Buffer
+	writeGQLSelection(&buf, selection, 0)
+	buf.WriteString("\n")
+	return buf.String(), nil
+}
+
+// gqlSelect builds the selection set for a set of fields, at the given dotted path.
+func gqlSelect(params Params, path string, opts GQLOptions, visiting map[*Param]bool) (gqlSelection, error) {
+	var selection = make(gqlSelection)
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		if visiting[param] {
+			continue
+		}
+		switch name.(type) {
+		case Name:
+			field, ok := opts.FieldNames[name.String()]
+			if !ok {
+				field = name.String()
+			}
+			if !gqlName.MatchString(field) {
+				if opts.OmitInvalidNames {
+					continue
+				}
+				return nil, fmt.Errorf("%v: not a valid GraphQL name", joinUsagePath(path, name.String()))
+			}
+			child, err := gqlSelectParam(param, joinUsagePath(path, name.String()), opts, visiting)
+			if err != nil {
+				return nil, err
+			}
+			if child != nil && len(child) == 0 {
+				continue
+			}
+			selection[field] = mergeGQLSelection(selection[field], child)
+		case MapIndex:
+			mapPath := path
+			switch opts.UnknownKeys {
+			case UnknownKeysOmit:
+				continue
+			case UnknownKeysExpand:
+				known, ok := opts.KnownFields[mapPath]
+				if !ok {
+					return nil, fmt.Errorf("%v: no known fields for unknown keys", mapPath)
+				}
+				child, err := gqlSelectParam(param, joinUsagePath(path, name.String()), opts, visiting)
+				if err != nil {
+					return nil, err
+				}
+				if child != nil && len(child) == 0 {
+					continue
+				}
+				for _, field := range known {
+					if !gqlName.MatchString(field) {
+						return nil, fmt.Errorf("%v: known field %q is not a valid GraphQL name", mapPath, field)
+					}
+					selection[field] = mergeGQLSelection(selection[field], child)
+				}
+			default:
+				return nil, fmt.Errorf("%v: accessed with unknown keys", mapPath)
+			}
+		}
+	}
+	return selection, nil
+}
+
+// gqlSelectParam builds the selection set for a single param, which is nil
+// for a leaf. Children of list elements accessed by index are selected with
+// the children of the list itself.
+func gqlSelectParam(param *Param, path string, opts GQLOptions, visiting map[*Param]bool) (gqlSelection, error) {
+	var (
+		selection gqlSelection
+		isLeaf    = true
+	)
+	visiting[param] = true
+	defer delete(visiting, param)
+	for _, name := range sortedNames(param.Children) {
+		child := param.Children[name]
+		children := Params{name: child}
+		if _, isIndex := name.(ListIndex); isIndex {
+			if len(child.Children) == 0 {
+				continue
+			}
+			children = child.Children
+		}
+		isLeaf = false
+		childSelection, err := gqlSelect(children, path, opts, visiting)
+		if err != nil {
+			return nil, err
+		}
+		selection = mergeGQLSelection(selection, childSelection)
+	}
+	if isLeaf {
+		return nil, nil
+	}
+	if selection == nil {
+		selection = make(gqlSelection)
+	}
+	return selection, nil
+}
+
+// mergeGQLSelection combines two selections of the same field. A field
+// selected as both a leaf and an object is selected as an object.
+func mergeGQLSelection(a, b gqlSelection) gqlSelection {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	var out = make(gqlSelection)
+	for field, selection := range a {
+		out[field] = selection
+	}
+	for field, selection := range b {
+		out[field] = mergeGQLSelection(out[field], selection)
+	}
+	return out
+}
+
+func writeGQLSelection(buf *bytes.Buffer, selection gqlSelection, depth int) {
+	var fields []string
+	for field := range selection {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	indent := strings.Repeat("  ", depth+1)
+	buf.WriteString("{\n")
+	for _, field := range fields {
+		fmt.Fprintf(buf, "%v%v", indent, field)
+		if selection[field] != nil {
+			buf.WriteString(" ")
+			writeGQLSelection(buf, selection[field], depth+1)
+		}
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(buf, "%v}", strings.Repeat("  ", depth))
+}
+
+func joinUsagePath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,103 @@
+package soyusage_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestToGraphQLSelection(t *testing.T) {
+	params := analyzeSource(t, constantAccessFixture)
+	var tests = []struct {
+		name   string
+		golden string
+		opts   soyusage.GQLOptions
+	}{
+		{
+			name:   "expand unknown keys",
+			golden: "constant_access.graphql",
+			opts: soyusage.GQLOptions{
+				UnknownKeys: soyusage.UnknownKeysExpand,
+				KnownFields: map[string][]string{
+					"profile": {"c_lifeAbout", "c_workAbout"},
+				},
+			},
+		},
+		{
+			name:   "omit unknown keys",
+			golden: "constant_access_omitted.graphql",
+			opts: soyusage.GQLOptions{
+				UnknownKeys: soyusage.UnknownKeysOmit,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := soyusage.ToGraphQLSelection(params, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", test.golden)
+			if *updateGolden {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			must.BeEqual(t, string(expected), got)
+		})
+	}
+
+	t.Run("error on unknown keys", func(t *testing.T) {
+		_, err := soyusage.ToGraphQLSelection(params, soyusage.GQLOptions{})
+		must.BeEqual(t, "profile: accessed with unknown keys", err.Error())
+	})
+	t.Run("expand without known fields", func(t *testing.T) {
+		_, err := soyusage.ToGraphQLSelection(params, soyusage.GQLOptions{
+			UnknownKeys: soyusage.UnknownKeysExpand,
+		})
+		must.BeEqual(t, "profile: no known fields for unknown keys", err.Error())
+	})
+}
+
+func TestToGraphQLSelectionInvalidNames(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param profile
+		*/
+		{template .main}
+			{$profile.name}
+			{$profile['c_life-about']}
+			{foreach $link in $profile.links}
+				{$link['link-url']}
+			{/foreach}
+		{/template}
+	`)
+
+	_, err := soyusage.ToGraphQLSelection(params, soyusage.GQLOptions{})
+	must.BeEqual(t, "profile.c_life-about: not a valid GraphQL name", err.Error())
+
+	got, err := soyusage.ToGraphQLSelection(params, soyusage.GQLOptions{
+		FieldNames: map[string]string{
+			"c_life-about": "cLifeAbout",
+		},
+		OmitInvalidNames: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, `{
+  profile {
+    cLifeAbout
+    name
+  }
+}
+`, got)
+}
@@ -0,0 +1,146 @@
+package soyusage
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/template"
+)
+
+// NewHandler returns an http.Handler serving the analysis of templates from a set
+// of soy files, keyed by file name.
+//
+// A GET request specifies the template to analyze with the template query parameter,
+// such as /?template=test.main. A POST request with an application/json body of the
+// form {"template": "test.main", "format": "json-schema"} may also choose the output
+// format. Formats are:
+//
+//	json: the parameter tree, with the usage types and fields of each param (default)
+//	json-schema: a JSON Schema describing the data required by the template
+//	dot: the parameter tree as a Graphviz DOT digraph
+//
+// A template that is not found results in a 404 response.
+func NewHandler(templates map[string]string) http.Handler {
+	var names []string
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bundle := soy.NewBundle()
+	for _, name := range names {
+		bundle = bundle.AddTemplateString(name, templates[name])
+	}
+	registry, err := bundle.Compile()
+	return &handler{
+		registry: registry,
+		err:      err,
+	}
+}
+
+type handler struct {
+	registry *template.Registry
+	// err is set if the templates could not be compiled
+	err error
+}
+
+type handlerRequest struct {
+	Template string `json:"template"`
+	Format   string `json:"format"`
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request handlerRequest
+	switch r.Method {
+	case http.MethodGet:
+		request.Template = r.URL.Query().Get("template")
+		request.Format = r.URL.Query().Get("format")
+	case http.MethodPost:
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			http.Error(w, "request body must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.err != nil {
+		http.Error(w, fmt.Sprintf("compiling templates: %v", h.err), http.StatusInternalServerError)
+		return
+	}
+	if request.Template == "" {
+		http.Error(w, "template must be specified", http.StatusBadRequest)
+		return
+	}
+	if _, found := h.registry.Template(request.Template); !found {
+		http.Error(w, fmt.Sprintf("template not found: %s", request.Template), http.StatusNotFound)
+		return
+	}
+	params, err := AnalyzeTemplate(request.Template, h.registry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch request.Format {
+	case "", "json":
+		writeJSON(w, encodeParams(params, make(map[*Param]bool)))
+	case "json-schema":
+		writeJSON(w, jsonSchema(params, SchemaOptions{RequireFullUsage: true}))
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		fmt.Fprint(w, ToDOT(request.Template, params))
+	default:
+		http.Error(w, fmt.Sprintf("unknown format: %s", request.Format), http.StatusBadRequest)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	out, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// encodedParam is the JSON representation of a param served by NewHandler.
+type encodedParam struct {
+	Usage    []string                 `json:"usage,omitempty"`
+	IsList   bool                     `json:"list,omitempty"`
+	Children map[string]*encodedParam `json:"children,omitempty"`
+}
+
+// encodeParams converts params to their JSON representation.
+// A param that contains itself is not encoded again within itself.
+func encodeParams(params Params, visiting map[*Param]bool) map[string]*encodedParam {
+	var out = make(map[string]*encodedParam)
+	for name, param := range params {
+		if visiting[param] {
+			continue
+		}
+		encoded := &encodedParam{
+			IsList: param.IsList,
+		}
+		for _, usageType := range usageTypes(param) {
+			encoded.Usage = append(encoded.Usage, usageType.String())
+		}
+		if len(param.Children) > 0 {
+			visiting[param] = true
+			encoded.Children = encodeParams(param.Children, visiting)
+			delete(visiting, param)
+		}
+		out[name.String()] = encoded
+	}
+	return out
+}
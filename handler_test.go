@@ -0,0 +1,144 @@
+package soyusage_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestHandler(t *testing.T) {
+	handler := soyusage.NewHandler(map[string]string{
+		"test.soy": `
+			{namespace test}
+			/**
+			* @param profile
+			* @param items
+			*/
+			{template .main}
+				{$profile.name}
+				{if $profile.nickname}{$profile.nickname}{/if}
+				{foreach $item in $items}{$item.label}{/foreach}
+			{/template}
+		`,
+	})
+	var tests = []struct {
+		name           string
+		method         string
+		target         string
+		contentType    string
+		body           string
+		expectedStatus int
+		expected       map[string]interface{}
+	}{
+		{
+			name:           "get analysis as json",
+			method:         http.MethodGet,
+			target:         "/?template=test.main",
+			expectedStatus: http.StatusOK,
+			expected: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"children": map[string]interface{}{
+						"name": map[string]interface{}{
+							"usage": []interface{}{"full"},
+						},
+						"nickname": map[string]interface{}{
+							"usage": []interface{}{"full", "exists"},
+						},
+					},
+				},
+				"items": map[string]interface{}{
+					"list":  true,
+					"usage": []interface{}{"reference"},
+					"children": map[string]interface{}{
+						"label": map[string]interface{}{
+							"usage": []interface{}{"full"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:           "post for json schema",
+			method:         http.MethodPost,
+			target:         "/",
+			contentType:    "application/json",
+			body:           `{"template": "test.main", "format": "json-schema"}`,
+			expectedStatus: http.StatusOK,
+			expected: map[string]interface{}{
+				"$schema": "http://json-schema.org/draft-07/schema#",
+				"type":    "object",
+				"properties": map[string]interface{}{
+					"profile": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"name":     map[string]interface{}{},
+							"nickname": map[string]interface{}{},
+						},
+						"required": []interface{}{"name"},
+					},
+					"items": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"label": map[string]interface{}{},
+							},
+							"required": []interface{}{"label"},
+						},
+					},
+				},
+				"required": []interface{}{"items", "profile"},
+			},
+		},
+		{
+			name:           "template not found",
+			method:         http.MethodGet,
+			target:         "/?template=test.missing",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "template not specified",
+			method:         http.MethodGet,
+			target:         "/",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown format",
+			method:         http.MethodGet,
+			target:         "/?template=test.main&format=xml",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "post without json body",
+			method:         http.MethodPost,
+			target:         "/",
+			contentType:    "text/plain",
+			body:           "test.main",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			if test.contentType != "" {
+				request.Header.Set("Content-Type", test.contentType)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			must.BeEqual(t, test.expectedStatus, recorder.Code)
+			if test.expected == nil {
+				return
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			must.BeEqual(t, test.expected, got)
+		})
+	}
+}
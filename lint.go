@@ -0,0 +1,98 @@
+package soyusage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintRule checks a parameter tree, returning a diagnostic for each problem found.
+type LintRule func(params Params) []LintDiagnostic
+
+// LintDiagnostic describes a problem found by a LintRule.
+type LintDiagnostic struct {
+	// Rule names the rule that produced this diagnostic
+	Rule string
+	// Message describes the problem
+	Message string
+	// Paths lists the params involved, as dot-separated paths
+	Paths []string
+}
+
+func (d LintDiagnostic) String() string {
+	return fmt.Sprintf("%v: %v", d.Rule, d.Message)
+}
+
+// Lint applies a set of rules to a parameter tree, returning all diagnostics
+// in the order of the rules.
+func Lint(params Params, rules ...LintRule) []LintDiagnostic {
+	var out []LintDiagnostic
+	for _, rule := range rules {
+		out = append(out, rule(params)...)
+	}
+	return out
+}
+
+// MaxUnknownAccess creates a rule that reports when more than n map accesses
+// with unknown keys ([?]) appear in a parameter tree.
+func MaxUnknownAccess(n int) LintRule {
+	return func(params Params) []LintDiagnostic {
+		paths := unknownPaths(params, nil, isUnknownKey)
+		if len(paths) <= n {
+			return nil
+		}
+		return []LintDiagnostic{
+			{
+				Rule:    "max-unknown-access",
+				Message: fmt.Sprintf("found %d unknown map accesses, maximum is %d", len(paths), n),
+				Paths:   paths,
+			},
+		}
+	}
+}
+
+// NoUnknownAccess creates a rule that reports any map accesses with unknown
+// keys ([?]) in a parameter tree.
+func NoUnknownAccess() LintRule {
+	return MaxUnknownAccess(0)
+}
+
+// unknownPaths lists the paths to all params for which isUnknown returns true,
+// in a stable order. The class names and identifiers listed for {css} commands
+// and the xid function are not data, so are not included.
+func unknownPaths(params Params, parent []string, isUnknown func(name Identifier, param *Param) bool) []string {
+	var out []string
+	for _, name := range sortedNames(params) {
+		switch name.(type) {
+		case CSSNames, XIDNames:
+			continue
+		}
+		var (
+			param = params[name]
+			path  = append(append([]string{}, parent...), name.String())
+		)
+		if isUnknown(name, param) {
+			out = append(out, strings.Join(path, "."))
+		}
+		out = append(out, unknownPaths(param.Children, path, isUnknown)...)
+	}
+	return out
+}
+
+// isUnknownKey returns true for map accesses with unknown keys.
+func isUnknownKey(name Identifier, _ *Param) bool {
+	return name == (MapIndex{})
+}
+
+// isUnknownAccess returns true for map accesses with unknown keys, and params
+// with UsageUnknown.
+func isUnknownAccess(name Identifier, param *Param) bool {
+	if isUnknownKey(name, param) {
+		return true
+	}
+	for _, usage := range param.Usage {
+		if usage.Type == UsageUnknown {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestLint(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param a
+		* @param b
+		* @param key
+		*/
+		{template .main}
+			{$a[$key].c}
+			{$b[$key][$key]}
+			{$b.known}
+			<div class="{css $b.known, foo}"></div>
+		{/template}
+	`)
+	// The unknown class name is not data, so is not an unknown map access
+	must.BeEqual(t, map[string]interface{}{
+		"[?]": map[string]interface{}{"foo": "c"},
+	}, mapUsage(params)["$css"])
+
+	var tests = []struct {
+		name     string
+		rules    []soyusage.LintRule
+		expected []soyusage.LintDiagnostic
+	}{
+		{
+			name: "no rules",
+		},
+		{
+			name:  "within maximum",
+			rules: []soyusage.LintRule{soyusage.MaxUnknownAccess(3)},
+		},
+		{
+			name:  "exceeds maximum",
+			rules: []soyusage.LintRule{soyusage.MaxUnknownAccess(2)},
+			expected: []soyusage.LintDiagnostic{
+				{
+					Rule:    "max-unknown-access",
+					Message: "found 3 unknown map accesses, maximum is 2",
+					Paths:   []string{"a.[?]", "b.[?]", "b.[?].[?]"},
+				},
+			},
+		},
+		{
+			name:  "no unknown access",
+			rules: []soyusage.LintRule{soyusage.NoUnknownAccess()},
+			expected: []soyusage.LintDiagnostic{
+				{
+					Rule:    "max-unknown-access",
+					Message: "found 3 unknown map accesses, maximum is 0",
+					Paths:   []string{"a.[?]", "b.[?]", "b.[?].[?]"},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			must.BeEqual(t, test.expected, soyusage.Lint(params, test.rules...))
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package soyusage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// LoadDir compiles every .soy file under a directory, searched recursively,
+// into a registry for analysis. Files are named by their path, including the
+// directory, so errors and analysis results identify the file they refer to.
+//
+// The files are compiled as by a soy.Bundle, except that params may be declared
+// with types, such as "@param profile: map<string, Bar>", see ParamType.
+//
+// Of the options, only Globals applies to loading, giving the values of any
+// globals the templates use.
+func LoadDir(dir string, options ...Option) (*template.Registry, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return loadFS(os.DirFS(dir), "*.soy", filepath.ToSlash(dir), newConfig(options...))
+}
+
+// LoadFS compiles the .soy files in a file system, such as an embed.FS, into a
+// registry for analysis. Files are named by their path within the file system.
+//
+// A file is loaded if its path matches glob, in the syntax of path.Match, or
+// where glob contains no "/", if its base name matches glob. So "*.soy" loads
+// every .soy file and "templates/*.soy" only those in the templates directory.
+// An empty glob is the same as "*.soy". Files without the .soy extension are
+// skipped, even if they match. Options are as for LoadDir.
+func LoadFS(fsys fs.FS, glob string, options ...Option) (*template.Registry, error) {
+	if glob == "" {
+		glob = "*.soy"
+	}
+	return loadFS(fsys, glob, "", newConfig(options...))
+}
+
+func loadFS(fsys fs.FS, glob string, prefix string, config Config) (*template.Registry, error) {
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %v", glob, err)
+	}
+	var files = make(map[string]*ast.SoyFileNode)
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path.Ext(name) != ".soy" || !matchesGlob(glob, name) {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if prefix != "" {
+			name = path.Join(prefix, name)
+		}
+		tree, err := parseFile(name, string(content), config.Globals)
+		if err != nil {
+			return err
+		}
+		files[name] = tree
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buildRegistry(files)
+}
+
+func matchesGlob(glob string, name string) bool {
+	if matched, _ := path.Match(glob, name); matched {
+		return true
+	}
+	if strings.Contains(glob, "/") {
+		return false
+	}
+	matched, _ := path.Match(glob, path.Base(name))
+	return matched
+}
@@ -0,0 +1,155 @@
+package soyusage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/robfig/soy/data"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+var loaderTemplates = map[string]string{
+	"main.soy": `
+		{namespace test}
+		/**
+		* @param profile
+		*/
+		{template .main}
+			{call test.link data="$profile"/}
+		{/template}
+	`,
+	"shared/link.soy": `
+		{namespace test}
+		/**
+		* @param url
+		*/
+		{template .link}
+			<a href="{$url}">link</a>
+		{/template}
+	`,
+	"README.md": "not a template",
+}
+
+func TestLoadFS(t *testing.T) {
+	var fsys = make(fstest.MapFS)
+	for name, content := range loaderTemplates {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	registry, err := soyusage.LoadFS(fsys, "*.soy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, "shared/link.soy", registry.Filename("test.link"))
+	params, err := soyusage.AnalyzeTemplate("test.main", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"profile": map[string]interface{}{
+			"url": "*",
+		},
+	}, mapUsage(params))
+
+	// Only files matching the glob are loaded
+	registry, err = soyusage.LoadFS(fsys, "shared/*.soy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found := registry.Template("test.main")
+	must.BeEqual(t, false, found)
+	_, found = registry.Template("test.link")
+	must.BeEqual(t, true, found)
+
+	if _, err := soyusage.LoadFS(fsys, "[invalid"); err == nil {
+		t.Error("expected an error for an invalid glob")
+	}
+}
+
+func TestLoadFSParseError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"valid.soy": &fstest.MapFile{Data: []byte(loaderTemplates["shared/link.soy"])},
+		"broken/invalid.soy": &fstest.MapFile{Data: []byte(`
+			{namespace test}
+			{template .broken}
+				{if}
+			{/template}
+		`)},
+	}
+	_, err := soyusage.LoadFS(fsys, "")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "broken/invalid.soy") {
+		t.Errorf("expected the error to name the file, got: %v", err)
+	}
+}
+
+func TestLoadFSGlobals(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.soy": &fstest.MapFile{Data: []byte(`
+			{namespace test}
+			/**
+			* @param profile
+			*/
+			{template .main}
+				{$profile[test.FIELD]}
+			{/template}
+		`)},
+	}
+	if _, err := soyusage.LoadFS(fsys, ""); err == nil {
+		t.Error("expected an error for an undefined global")
+	}
+	registry, err := soyusage.LoadFS(fsys, "", soyusage.Globals(data.Map{
+		"test.FIELD": data.String("name"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := soyusage.AnalyzeTemplate("test.main", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"profile": map[string]interface{}{
+			"name": "*",
+		},
+	}, mapUsage(params))
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soyusage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range loaderTemplates {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry, err := soyusage.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, filepath.ToSlash(filepath.Join(dir, "shared", "link.soy")), registry.Filename("test.link"))
+	results, err := soyusage.AnalyzeRegistry(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, 2, len(results))
+
+	if _, err := soyusage.LoadDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
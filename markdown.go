@@ -0,0 +1,63 @@
+package soyusage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ToMarkdownTable renders usage maps keyed by template name as a Markdown table,
+// with a row for each top-level param of each template, sorted by template and
+// param. Usage maps are in the form described for FlattenUsage.
+//
+// The accessed fields of a param are listed as dotted paths relative to the
+// param, as given by FlattenUsage. A param used as a whole is listed as "(value)".
+// Unknown access is any map access with an unknown key ([?]) or unknown usage.
+func ToMarkdownTable(results map[string]map[string]interface{}) string {
+	var b strings.Builder
+	b.WriteString("| Template Name | Parameter | Accessed Fields | Unknown Access |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+
+	var templates []string
+	for name := range results {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+	for _, templateName := range templates {
+		usage := results[templateName]
+		var params []string
+		for name := range usage {
+			params = append(params, name)
+		}
+		sort.Strings(params)
+		for _, param := range params {
+			var (
+				value   = usage[param]
+				fields  = "(value)"
+				unknown = "no"
+			)
+			if children, isMap := value.(map[string]interface{}); isMap && len(children) > 0 {
+				var paths []string
+				for _, path := range FlattenUsage(children) {
+					paths = append(paths, "`"+path+"`")
+				}
+				fields = strings.Join(paths, ", ")
+			}
+			if summarizeUsage(map[string]interface{}{param: value}, "", make(map[string]bool)) > 0 {
+				unknown = "yes"
+			}
+			fmt.Fprintf(&b, "| %v | %v | %v | %v |\n",
+				markdownCell(templateName),
+				markdownCell(param),
+				markdownCell(fields),
+				unknown,
+			)
+		}
+	}
+	return b.String()
+}
+
+// markdownCell escapes pipes in the content of a table cell.
+func markdownCell(content string) string {
+	return strings.Replace(content, "|", "\\|", -1)
+}
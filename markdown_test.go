@@ -0,0 +1,46 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestToMarkdownTable(t *testing.T) {
+	must.BeEqual(t, `| Template Name | Parameter | Accessed Fields | Unknown Access |
+| --- | --- | --- | --- |
+| test.card | title | (value) | no |
+| test.main | category | (value) | yes |
+| test.main | profile | `+"`avatar?`, `fields.[?].label`, `name`"+` | yes |
+`, soyusage.ToMarkdownTable(map[string]map[string]interface{}{
+		"test.main": {
+			"profile": map[string]interface{}{
+				"name":   "*",
+				"avatar": "e",
+				"fields": map[string]interface{}{
+					"[?]": map[string]interface{}{
+						"label": "*",
+					},
+				},
+			},
+			"category": "?",
+		},
+		"test.card": {
+			"title": "*",
+		},
+	}))
+}
+
+func TestToMarkdownTableEscapesPipes(t *testing.T) {
+	must.BeEqual(t, `| Template Name | Parameter | Accessed Fields | Unknown Access |
+| --- | --- | --- | --- |
+| test.main | a | `+"`b\\|c`"+` | no |
+`, soyusage.ToMarkdownTable(map[string]map[string]interface{}{
+		"test.main": {
+			"a": map[string]interface{}{
+				"b|c": "*",
+			},
+		},
+	}))
+}
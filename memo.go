@@ -0,0 +1,325 @@
+package soyusage
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// memo caches the analysis of called templates, so templates called from many
+// places are only walked once for each distinct set of bindings.
+//
+// The analysis of a called template is recorded as a trace of the operations
+// performed on the params bound to it. The trace is then replayed onto the
+// params bound at each call site with the same shape.
+type memo struct {
+	lock   sync.Mutex
+	traces map[string]*trace
+	// cyclic records whether each template can reach a recursive call
+	cyclic map[string]bool
+	// callees caches the templates called by each template
+	callees map[string][]string
+}
+
+func newMemo() *memo {
+	return &memo{
+		traces:  make(map[string]*trace),
+		cyclic:  make(map[string]bool),
+		callees: make(map[string][]string),
+	}
+}
+
+// trace records the effects of analyzing a template on the params bound to it.
+type trace struct {
+	ops      []traceOp
+	warnings []Warning
+	unknowns []error
+}
+
+// traceOp is a single operation on a bound param, or a field within it.
+// Exactly one of child, usage, list, keyed or truncated is set.
+type traceOp struct {
+	slot  int
+	path  []Identifier
+	child Identifier
+	usage *Usage
+	// list marks the param as a list, which was iterated over if iterated is set
+	list     bool
+	iterated bool
+	// keyed marks the param as accessed by a key found from a key expression
+	keyed bool
+	// truncated marks the param as having keys beyond the maximum constant keys
+	truncated bool
+}
+
+// paramOrigin identifies the bound param, and field within it, for which
+// a param is standing in while a trace is recorded.
+type paramOrigin struct {
+	trace *trace
+	slot  int
+	path  []Identifier
+}
+
+func (o *paramOrigin) record(op traceOp) {
+	op.slot = o.slot
+	op.path = o.path
+	o.trace.ops = append(o.trace.ops, op)
+}
+
+func (o *paramOrigin) child(name Identifier) *paramOrigin {
+	path := make([]Identifier, len(o.path), len(o.path)+1)
+	copy(path, o.path)
+	return &paramOrigin{
+		trace: o.trace,
+		slot:  o.slot,
+		path:  append(path, name),
+	}
+}
+
+// replay applies a trace to a scope, with slots identifying the params bound
+// in that scope.
+func (t *trace) replay(s *scope, slots []*Param) {
+	for _, op := range t.ops {
+		target := slots[op.slot]
+		for _, name := range op.path {
+			target = target.getChildOrNew(name)
+		}
+		switch {
+		case op.usage != nil:
+			target.addUsageToLeaves(*op.usage)
+		case op.list:
+			target.markList(op.iterated)
+		case op.keyed:
+			target.markKeyed()
+		case op.truncated:
+			target.markTruncated()
+		default:
+			target.getChildOrNew(op.child)
+		}
+	}
+	for _, warning := range t.warnings {
+		s.emitWarning(warning)
+	}
+	for _, err := range t.unknowns {
+		s.addUnknown(err)
+	}
+}
+
+// analyzeCallee analyzes the body of a called template in the scope of the call,
+// reusing a previous analysis if the template was called with bindings of the
+// same shape.
+func analyzeCallee(s *scope, node *ast.TemplateNode) error {
+	if !s.canMemoize() {
+		return analyzeNode(s, usageUndefined, node)
+	}
+
+	b := &binder{
+		trace:   &trace{},
+		slotIDs: make(map[*Param]int),
+	}
+	fmt.Fprintf(&b.key, "%s|", s.templateName)
+	recordScope := &scope{
+		registry:     s.registry,
+		templateName: s.templateName,
+		callStack:    s.callStack,
+		parameters:   make(Params),
+		variables:    make(map[Identifier][]*Param),
+		config:       s.config,
+		css:          b.bind(s.css),
+		xid:          b.bind(s.xid),
+		unknowns:     s.unknowns,
+		memo:         s.memo,
+		trace:        b.trace,
+	}
+	variables := s.allVariables()
+	for _, name := range sortedVariableNames(variables) {
+		fmt.Fprintf(&b.key, "v%s=", name)
+		if s.isListLiteral(name) {
+			b.key.WriteString("L")
+			recordScope.setListLiteral(name, true)
+		}
+		recordScope.variables[name] = b.bindAll(variables[name])
+	}
+	for _, name := range sortedNames(s.parameters) {
+		fmt.Fprintf(&b.key, "p%s=", name)
+		recordScope.parameters[name] = b.bind(s.parameters[name])
+	}
+	b.key.WriteString("d=")
+	recordScope.data = b.bindAll(s.data)
+
+	key := b.key.String()
+	t, found := s.memo.trace(key)
+	if !found {
+		if err := analyzeNode(recordScope, usageUndefined, node); err != nil {
+			return err
+		}
+		t = s.memo.storeTrace(key, b.trace)
+	}
+	t.replay(s, b.slots)
+	return nil
+}
+
+func (m *memo) trace(key string) (*trace, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	t, found := m.traces[key]
+	return t, found
+}
+
+// storeTrace caches a trace, returning the trace already cached for the key
+// if another analysis recorded it first.
+func (m *memo) storeTrace(key string, t *trace) *trace {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if existing, found := m.traces[key]; found {
+		return existing
+	}
+	m.traces[key] = t
+	return t
+}
+
+// invalidate discards the traces recorded for a template, along with what is
+// known of the templates it calls.
+func (m *memo) invalidate(templateName string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	prefix := templateName + "|"
+	for key := range m.traces {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.traces, key)
+		}
+	}
+	delete(m.cyclic, templateName)
+	delete(m.callees, templateName)
+}
+
+// binder builds a cache key describing the shape of a set of bindings, along
+// with params to stand in for those bindings while a trace is recorded.
+type binder struct {
+	key     bytes.Buffer
+	trace   *trace
+	slots   []*Param
+	slotIDs map[*Param]int
+}
+
+func (b *binder) bindAll(params []*Param) []*Param {
+	var out []*Param
+	b.key.WriteString("[")
+	for _, param := range params {
+		out = append(out, b.bind(param))
+	}
+	b.key.WriteString("]")
+	return out
+}
+
+// bind adds a param to the key, returning the param to stand in for it.
+// Constants and map literals are copied, other params are assigned a slot.
+func (b *binder) bind(param *Param) *Param {
+	out := newParam()
+	switch {
+	case param.isConstant():
+		fmt.Fprintf(&b.key, "c%T:%v,", param.constant, param.constant)
+		out.constant = param.constant
+	case param.isMapLiteral():
+		out.entries = make(map[string][]*Param)
+		var keys []string
+		for key := range param.entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.key.WriteString("m{")
+		for _, key := range keys {
+			fmt.Fprintf(&b.key, "%q:", key)
+			out.entries[key] = b.bindAll(param.entries[key])
+		}
+		b.key.WriteString("},")
+	default:
+		if param.Type != nil {
+			// The declared type determines how variable indexes are treated
+			fmt.Fprintf(&b.key, "t%s,", param.Type)
+			out.Type = param.Type
+		}
+		id, exists := b.slotIDs[param]
+		if !exists {
+			id = len(b.slots)
+			b.slotIDs[param] = id
+			b.slots = append(b.slots, param)
+		}
+		fmt.Fprintf(&b.key, "s%d,", id)
+		out.origin = &paramOrigin{
+			trace: b.trace,
+			slot:  id,
+		}
+	}
+	return out
+}
+
+func sortedVariableNames(variables map[Identifier][]*Param) []Identifier {
+	var names []Identifier
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].String() < names[j].String()
+	})
+	return names
+}
+
+// canMemoize returns true iff the analysis of the template for this scope
+// is guaranteed to be the same when replayed from a trace.
+//
+// Optional tracking depends on how params were bound, and recursion depends on
+// the call stack, so templates that could be analyzed differently in either case
+// are not memoized.
+func (s *scope) canMemoize() bool {
+	return s.memo != nil &&
+		s.config.Memoize &&
+		!s.config.OptionalTracking &&
+		s.config.RecursionDepth > 0 &&
+		!s.memo.isCyclic(s.registry, s.templateName)
+}
+
+func (m *memo) isCyclic(registry *template.Registry, templateName string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.reachesCycle(registry, templateName, make(map[string]bool))
+}
+
+// reachesCycle returns true iff a template is part of, or calls a template that
+// is part of a recursive cycle of calls.
+func (m *memo) reachesCycle(registry *template.Registry, templateName string, stack map[string]bool) bool {
+	if cyclic, known := m.cyclic[templateName]; known {
+		return cyclic
+	}
+	if stack[templateName] {
+		return true
+	}
+	stack[templateName] = true
+	defer delete(stack, templateName)
+
+	var cyclic bool
+	for _, callee := range m.calledTemplates(registry, templateName) {
+		if m.reachesCycle(registry, callee, stack) {
+			cyclic = true
+		}
+	}
+	m.cyclic[templateName] = cyclic
+	return cyclic
+}
+
+func (m *memo) calledTemplates(registry *template.Registry, templateName string) []string {
+	if callees, found := m.callees[templateName]; found {
+		return callees
+	}
+	var callees []string
+	if t, found := registry.Template(templateName); found {
+		callees = calledTemplates(t.Node)
+	}
+	m.callees[templateName] = callees
+	return callees
+}
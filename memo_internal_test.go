@@ -0,0 +1,133 @@
+package soyusage
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/theothertomelliott/must"
+)
+
+func TestMemoReusesCalleeResults(t *testing.T) {
+	registry, err := soy.NewBundle().AddTemplateString("test.soy", `
+		{namespace test}
+		/**
+		* @param profile
+		*/
+		{template .page}
+			{call .card data="all"/}
+		{/template}
+
+		/**
+		* @param profile
+		*/
+		{template .other}
+			{call .card data="all"/}
+			{call .card}
+				{param profile: $profile.friend/}
+			{/call}
+		{/template}
+
+		/**
+		* @param profile
+		*/
+		{template .card}
+			{$profile.name}
+		{/template}
+	`).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newMemo()
+	config := newConfig()
+	for _, name := range []string{"test.card", "test.page", "test.other"} {
+		if _, err := analyzeTemplate(name, registry, config, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The calls passing on all data reuse the analysis of .card itself, while
+	// passing a field of a param is a different shape, analyzed separately
+	var traced = make(map[string]int)
+	for key := range m.traces {
+		traced[strings.SplitN(key, "|", 2)[0]]++
+	}
+	must.BeEqual(t, map[string]int{
+		"test.card":  2,
+		"test.page":  1,
+		"test.other": 1,
+	}, traced)
+}
+
+func TestUpdateFileKeepsUnrelatedTraces(t *testing.T) {
+	analyzer, err := NewAnalyzer(map[string]string{
+		"card.soy": `
+			{namespace test}
+			/**
+			* @param profile
+			*/
+			{template .card}
+				{$profile.name}
+			{/template}
+		`,
+		"page.soy": `
+			{namespace test}
+			/**
+			* @param profile
+			* @param title
+			*/
+			{template .page}
+				{call .card data="all"/}
+				{call .heading data="all"/}
+			{/template}
+
+			/**
+			* @param title
+			*/
+			{template .heading}
+				{$title}
+			{/template}
+		`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := analyzer.Usage("test.page"); err != nil {
+		t.Fatal(err)
+	}
+	traced := func() []string {
+		var out []string
+		for key := range analyzer.memo.traces {
+			out = append(out, strings.SplitN(key, "|", 2)[0])
+		}
+		sort.Strings(out)
+		return out
+	}
+	must.BeEqual(t, []string{"test.card", "test.heading", "test.page"}, traced())
+
+	err = analyzer.UpdateFile("card.soy", `
+		{namespace test}
+		/**
+		* @param profile
+		*/
+		{template .card}
+			{$profile.avatar}
+		{/template}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, []string{"test.heading"}, traced())
+
+	params, err := analyzer.Usage("test.page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"profile": map[string]interface{}{
+			"avatar": "*",
+		},
+		"title": "*",
+	}, params.ToMap(MapOptions{}))
+}
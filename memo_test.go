@@ -0,0 +1,120 @@
+package soyusage_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/template"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+// sharedPartialRegistry creates a registry with a number of pages, all calling
+// a shared footer partial with a mix of constant and variable params.
+func sharedPartialRegistry(tb testing.TB, pages int) *template.Registry {
+	var src strings.Builder
+	src.WriteString("{namespace test}\n")
+	for i := 0; i < pages; i++ {
+		fmt.Fprintf(&src, `
+/**
+* @param site
+* @param page
+*/
+{template .page%d}
+	{$page.title%d}
+	{call .footer data="all"}
+		{param section: '%s'/}
+	{/call}
+{/template}
+`, i, i, []string{"about", "contact"}[i%2])
+	}
+	src.WriteString(`
+/**
+* @param site
+* @param section
+*/
+{template .footer}
+	{foreach $link in $site.links}
+		{call .link}
+			{param link: $link/}
+			{param section: $section/}
+		{/call}
+	{/foreach}
+	{$site.sections[$section].name}
+	{if $site.copyright}
+		{$site.copyright.year} {$site.copyright.holder}
+	{/if}
+{/template}
+
+/**
+* @param link
+* @param section
+*/
+{template .link}
+	<a href="{$link.url}">{$link.labels[$section]}</a>
+	{if $link.icon}{$link.icon.src}{/if}
+{/template}
+`)
+	registry, err := soy.NewBundle().AddTemplateString("test.soy", src.String()).Compile()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return registry
+}
+
+func TestMemoizationMatchesUnmemoized(t *testing.T) {
+	registry := sharedPartialRegistry(t, 10)
+	memoized, err := soyusage.AnalyzeRegistry(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unmemoized, err := soyusage.AnalyzeRegistry(registry, soyusage.Memoize(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, len(unmemoized), len(memoized))
+	for name, params := range unmemoized {
+		must.BeEqual(t, mapUsageFull(registry, params), mapUsageFull(registry, memoized[name]), name)
+	}
+
+	must.BeEqual(t, map[string]interface{}{
+		"page": map[string]interface{}{
+			"title1": "*",
+		},
+		"site": map[string]interface{}{
+			"links": map[string]interface{}{
+				"url": "*",
+				"labels": map[string]interface{}{
+					"contact": "*",
+				},
+				"icon": map[string]interface{}{
+					"src": "*",
+				},
+			},
+			"sections": map[string]interface{}{
+				"contact": map[string]interface{}{
+					"name": "*",
+				},
+			},
+			"copyright": map[string]interface{}{
+				"year":   "*",
+				"holder": "*",
+			},
+		},
+	}, mapUsage(memoized["test.page1"]))
+}
+
+func BenchmarkAnalyzeRegistry(b *testing.B) {
+	registry := sharedPartialRegistry(b, 200)
+	for _, memoize := range []bool{false, true} {
+		b.Run(fmt.Sprintf("memoize=%v", memoize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := soyusage.AnalyzeRegistry(registry, soyusage.Memoize(memoize)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
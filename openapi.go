@@ -0,0 +1,18 @@
+package soyusage
+
+// ToOpenAPISchema converts a usage map, as described by FlattenUsage, into an
+// OpenAPI 3.0 Schema Object suitable for marshaling as JSON or YAML.
+//
+// The usage map is read as by ParamsFromMap with WrapLists set, and described
+// as by ToJSONSchema with RequireFullUsage set. Maps become objects with a
+// property for each known field, and additionalProperties describing the values
+// under an unknown key ([?]). Elements of lists, under a "[]" key alongside any
+// other keys of the list, become the items of an array. Leaves may hold any value.
+func ToOpenAPISchema(usage map[string]interface{}) (map[string]interface{}, error) {
+	params, err := ParamsFromMap(usage, MapOptions{WrapLists: true})
+	if err != nil {
+		return nil, err
+	}
+	opts := SchemaOptions{RequireFullUsage: true}
+	return objectSchema(params, opts, make(map[*Param]bool)), nil
+}
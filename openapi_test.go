@@ -0,0 +1,126 @@
+package soyusage_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestToOpenAPISchema(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param profile
+		* @param key
+		*/
+		{template .main}
+			{$profile.name}
+			{if $profile.nickname}{$profile.nickname}{/if}
+			{if $profile.avatar}shown{/if}
+			{$profile.fields[$key].label}
+		{/template}
+	`)
+	got, err := soyusage.ToOpenAPISchema(mapUsage(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"key": map[string]interface{}{},
+			"profile": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"avatar": map[string]interface{}{},
+					"fields": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{},
+						"additionalProperties": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"label": map[string]interface{}{},
+							},
+							"required": []string{"label"},
+						},
+					},
+					"name":     map[string]interface{}{},
+					"nickname": map[string]interface{}{},
+				},
+				"required": []string{"name", "nickname"},
+			},
+		},
+		"required": []string{"key", "profile"},
+	}, got)
+}
+
+func TestToOpenAPISchemaLists(t *testing.T) {
+	got, err := soyusage.ToOpenAPISchema(map[string]interface{}{
+		"items": map[string]interface{}{
+			"[]": map[string]interface{}{
+				"label": "*",
+				"count": "e",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"items": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"count": map[string]interface{}{},
+						"label": map[string]interface{}{},
+					},
+					"required": []string{"label"},
+				},
+			},
+		},
+		"required": []string{"items"},
+	}, got)
+
+	// Keys alongside "[]" are also fields of the elements, even where they sort
+	// before it
+	got, err = soyusage.ToOpenAPISchema(map[string]interface{}{
+		"items": map[string]interface{}{
+			"Title": "*",
+			"[]": map[string]interface{}{
+				"label": "e",
+			},
+			"[0]": "*",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"items": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"Title": map[string]interface{}{},
+						"label": map[string]interface{}{},
+					},
+					"required": []string{"Title"},
+				},
+			},
+		},
+		"required": []string{"items"},
+	}, got)
+
+	_, err = soyusage.ToOpenAPISchema(map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": 1,
+		},
+	})
+	must.BeEqualErrors(t, errors.New("a.b: unexpected usage value of type int"), err)
+}
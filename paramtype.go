@@ -0,0 +1,295 @@
+package soyusage
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// ParamType describes the type declared for a param in its SoyDoc, for example:
+//
+//	@param profile: map<string, Bar>
+//
+// Lists and maps are named "list" and "map", with their element, key and value
+// types in Args. Records are named "record", with the types of their fields in Fields.
+// A union with null is marked Nullable, other unions are named "union" with each
+// member type in Args.
+//
+// The soy package's parser does not support typed declarations: it reads the name
+// of a param declared as "@param profile: map<string, Bar>" as "profile:", so
+// Bundle.Compile fails its check that each data ref names a declared param. The
+// registries built by LoadDir, LoadFS and NewAnalyzer correct these names, so
+// typed templates are loaded with them rather than a soy.Bundle.
+type ParamType struct {
+	Name     string
+	Args     []*ParamType
+	Fields   map[string]*ParamType
+	Nullable bool
+}
+
+// String renders the type using Soy's type syntax.
+func (t *ParamType) String() string {
+	if t == nil {
+		return ""
+	}
+	var out string
+	switch t.Name {
+	case "record":
+		var fields []string
+		for name := range t.Fields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		for i, name := range fields {
+			fields[i] = name + ": " + t.Fields[name].String()
+		}
+		out = "[" + strings.Join(fields, ", ") + "]"
+	case "union":
+		var members []string
+		for _, arg := range t.Args {
+			members = append(members, arg.String())
+		}
+		out = strings.Join(members, "|")
+	default:
+		out = t.Name
+		if len(t.Args) > 0 {
+			var args []string
+			for _, arg := range t.Args {
+				args = append(args, arg.String())
+			}
+			out += "<" + strings.Join(args, ", ") + ">"
+		}
+	}
+	if t.Nullable {
+		out += "|null"
+	}
+	return out
+}
+
+// Elem returns the type of the elements of a list, or nil if this is not a list type.
+func (t *ParamType) Elem() *ParamType {
+	if t == nil || t.Name != "list" || len(t.Args) != 1 {
+		return nil
+	}
+	return t.Args[0]
+}
+
+// field returns the type of a field accessed on a value of this type.
+// Fields accessed on a list are fields of its elements, as they would be
+// accessed on the loop variable when iterating.
+func (t *ParamType) field(name Identifier) *ParamType {
+	for t.Elem() != nil {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil
+	}
+	switch t.Name {
+	case "map":
+		if len(t.Args) == 2 {
+			return t.Args[1]
+		}
+	case "record":
+		return t.Fields[name.String()]
+	}
+	return nil
+}
+
+// declaredTypes returns the types declared for the params of a template, keyed by param name.
+// The types are not retained in the AST, so are parsed from the source of the SoyDoc.
+func declaredTypes(registry *template.Registry, t template.Template) map[string]*ParamType {
+	src := templateSource(registry, t.Node)
+	if src == "" {
+		return nil
+	}
+	var out = make(map[string]*ParamType)
+	for _, param := range t.Doc.Params {
+		if int(param.Pos) >= len(src) {
+			continue
+		}
+		if paramType := parseParamDeclaration(src[param.Pos:], docParamName(param)); paramType != nil {
+			out[docParamName(param)] = paramType
+		}
+	}
+	return out
+}
+
+func templateSource(registry *template.Registry, node *ast.TemplateNode) string {
+	for _, file := range registry.SoyFiles {
+		for _, n := range file.Body {
+			if n == node {
+				return file.Text
+			}
+		}
+	}
+	return ""
+}
+
+// docParamName returns the name of a param declared in SoyDoc.
+// The SoyDoc parser includes everything up to the next space in the name,
+// so the colon separating a name from its type is removed.
+func docParamName(param *ast.SoyDocParamNode) string {
+	return strings.TrimSuffix(param.Name, ":")
+}
+
+// trimDocParamNames removes the colon the SoyDoc parser includes in the names of
+// params declared with types, so the names match the data refs to them.
+func trimDocParamNames(tree *ast.SoyFileNode) {
+	for _, node := range tree.Body {
+		if doc, isDoc := node.(*ast.SoyDocNode); isDoc {
+			for _, param := range doc.Params {
+				param.Name = docParamName(param)
+			}
+		}
+	}
+}
+
+// parseParamDeclaration parses the type from a declaration of the form "@param name: type",
+// starting after the "@param" keyword. It returns nil if no type was declared or the type
+// could not be parsed.
+func parseParamDeclaration(src string, name string) *ParamType {
+	p := &typeParser{src: src}
+	if !p.consume(name) {
+		return nil
+	}
+	p.skipSpace()
+	if !p.consume(":") {
+		return nil
+	}
+	return p.parseType()
+}
+
+// typeParser is a recursive descent parser for Soy type expressions.
+type typeParser struct {
+	src string
+	pos int
+}
+
+func (p *typeParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *typeParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *typeParser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) {
+		r := rune(p.src[p.pos])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// parseType parses a union of one or more types.
+func (p *typeParser) parseType() *ParamType {
+	var (
+		members  []*ParamType
+		nullable bool
+	)
+	for {
+		member := p.parseMember()
+		if member == nil {
+			return nil
+		}
+		if member.Name == "null" {
+			nullable = true
+		} else {
+			members = append(members, member)
+		}
+		if !p.consume("|") {
+			break
+		}
+	}
+	var out *ParamType
+	switch len(members) {
+	case 0:
+		out = &ParamType{Name: "null"}
+		nullable = false
+	case 1:
+		out = members[0]
+	default:
+		out = &ParamType{Name: "union", Args: members}
+	}
+	out.Nullable = out.Nullable || nullable
+	return out
+}
+
+func (p *typeParser) parseMember() *ParamType {
+	switch {
+	case p.consume("?"):
+		return &ParamType{Name: "?"}
+	case p.consume("("):
+		inner := p.parseType()
+		if inner == nil || !p.consume(")") {
+			return nil
+		}
+		return inner
+	case p.consume("["):
+		return p.parseRecord()
+	}
+	name := p.ident()
+	if name == "" {
+		return nil
+	}
+	out := &ParamType{Name: name}
+	if !p.consume("<") {
+		return out
+	}
+	for {
+		arg := p.parseType()
+		if arg == nil {
+			return nil
+		}
+		out.Args = append(out.Args, arg)
+		if p.consume(">") {
+			return out
+		}
+		if !p.consume(",") {
+			return nil
+		}
+	}
+}
+
+// parseRecord parses the fields of a record type, after the opening bracket.
+func (p *typeParser) parseRecord() *ParamType {
+	out := &ParamType{
+		Name:   "record",
+		Fields: make(map[string]*ParamType),
+	}
+	if p.consume("]") {
+		return out
+	}
+	for {
+		name := p.ident()
+		if name == "" || !p.consume(":") {
+			return nil
+		}
+		fieldType := p.parseType()
+		if fieldType == nil {
+			return nil
+		}
+		out.Fields[name] = fieldType
+		if p.consume("]") {
+			return out
+		}
+		if !p.consume(",") {
+			return nil
+		}
+	}
+}
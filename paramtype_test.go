@@ -0,0 +1,115 @@
+package soyusage_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestDeclaredParamTypes(t *testing.T) {
+	// Build the registry directly, as the compile-time checks treat the colon
+	// following a param name as part of the name.
+	tree, err := parse.SoyFile("test.soy", `
+		{namespace test}
+		/**
+		* @param profile: map<string, [name: string, tags: list<string>]> The profile by id
+		* @param? items: list<[label: string, count: int|null]>
+		* @param title : string
+		* @param untyped
+		* @param choice: int|string
+		*/
+		{template .main}
+			{$profile[$untyped].name}
+			{$profile[$untyped].tags}
+			{foreach $item in $items}
+				{$item.label}{$item.count}
+			{/foreach}
+			{$title}
+			{$choice}
+		{/template}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &template.Registry{}
+	if err := registry.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+	got, err := soyusage.AnalyzeTemplate("test.main", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"profile": map[string]interface{}{
+			"type": "map<string, [name: string, tags: list<string>]>",
+			"[?]": map[string]interface{}{
+				"type": "[name: string, tags: list<string>]",
+				"name": map[string]interface{}{"type": "string"},
+				"tags": map[string]interface{}{"type": "list<string>"},
+			},
+		},
+		"items": map[string]interface{}{
+			"type":  "list<[count: int|null, label: string]>",
+			"label": map[string]interface{}{"type": "string"},
+			"count": map[string]interface{}{"type": "int|null"},
+		},
+		"title":   map[string]interface{}{"type": "string"},
+		"untyped": map[string]interface{}{"type": ""},
+		"choice":  map[string]interface{}{"type": "int|string"},
+	}, mapTypes(got))
+
+	items := got[soyusage.Name("items")].Type
+	must.BeEqual(t, "record", items.Elem().Name)
+	must.BeEqual(t, true, items.Elem().Fields["count"].Nullable)
+}
+
+func mapTypes(params soyusage.Params) map[string]interface{} {
+	var out = make(map[string]interface{})
+	for name, param := range params {
+		value := mapTypes(param.Children)
+		value["type"] = param.Type.String()
+		out[name.String()] = value
+	}
+	return out
+}
+
+func TestVariableIndexOnDeclaredList(t *testing.T) {
+	tree, err := parse.SoyFile("test.soy", `
+		{namespace test}
+		/**
+		* @param items: list<[name: string, id: int]>
+		* @param i: int
+		*/
+		{template .main}
+			{$items[0].name}
+			{$items[$i].id}
+		{/template}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &template.Registry{}
+	if err := registry.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+	got, err := soyusage.AnalyzeTemplate("test.main", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := got[soyusage.Name("items")]
+	must.BeEqual(t, true, items.IsList)
+	must.BeEqual(t, []string{"id", "name"}, childNames(items.Children))
+}
+
+func childNames(params soyusage.Params) []string {
+	var out []string
+	for name := range params {
+		out = append(out, name.String())
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,84 @@
+package soyusage
+
+import (
+	"sort"
+	"strings"
+)
+
+// ProjectionOptions configures the field patterns generated by ToFieldProjection.
+type ProjectionOptions struct {
+	// Wildcard is the pattern matching any field name. Defaults to "*".
+	Wildcard string
+	// ListSegments inserts a wildcard segment after each param used as a list,
+	// such as "profile.links.*.url", for stores that address list elements.
+	// Otherwise, fields of list elements follow the list, such as "profile.links.url".
+	ListSegments bool
+}
+
+// ToFieldProjection lists the dotted field patterns needed to fetch the data
+// required by a parameter tree, such as for an Elasticsearch source filter.
+//
+// A param with children that is accessed with unknown keys ([?]), or has full
+// or unknown usage itself, is fetched in its entirety, with the pattern
+// "parent.*". Otherwise, each of its children is listed, down to the leaves.
+// Fields of list elements accessed by index are listed as fields of the list,
+// and elements used as a whole are listed as the list itself.
+// The patterns are deduplicated and sorted.
+func ToFieldProjection(usage Params, opts ProjectionOptions) []string {
+	if opts.Wildcard == "" {
+		opts.Wildcard = "*"
+	}
+	var patterns = make(map[string]bool)
+	projectFields(usage, nil, opts, patterns, make(map[*Param]bool))
+	var out []string
+	for pattern := range patterns {
+		out = append(out, pattern)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func projectFields(params Params, parent []string, opts ProjectionOptions, patterns map[string]bool, visiting map[*Param]bool) {
+	for name, param := range params {
+		if visiting[param] {
+			continue
+		}
+		switch name.(type) {
+		case CSSNames, XIDNames:
+			continue
+		case ListIndex:
+			// The parent has already been given a list segment if needed, and
+			// an element used as a whole needs the elements of the list
+			if len(param.Children) == 0 {
+				patterns[strings.Join(parent, ".")] = true
+				continue
+			}
+			visiting[param] = true
+			projectFields(param.Children, parent, opts, patterns, visiting)
+			delete(visiting, param)
+			continue
+		}
+		path := append(parent[:len(parent):len(parent)], name.String())
+		if len(param.Children) == 0 {
+			patterns[strings.Join(path, ".")] = true
+			continue
+		}
+		if param.IsList && opts.ListSegments {
+			path = append(path, opts.Wildcard)
+		}
+		if projectAll(param) {
+			patterns[strings.Join(append(path, opts.Wildcard), ".")] = true
+			continue
+		}
+		visiting[param] = true
+		projectFields(param.Children, path, opts, patterns, visiting)
+		delete(visiting, param)
+	}
+}
+
+// projectAll returns true iff all fields of a param are needed, as it is
+// accessed with unknown keys, or has full or unknown usage.
+func projectAll(param *Param) bool {
+	_, unknownKeys := param.Children[MapIndex{}]
+	return unknownKeys || usesDescendants(param)
+}
@@ -0,0 +1,112 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestToFieldProjection(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param profile
+		* @param key
+		*/
+		{template .main}
+			{$profile.name.first}
+			{if $profile.avatar}shown{/if}
+			{$profile.fields[$key].label}
+			{foreach $link in $profile.links}
+				{$link.url}
+				{$link.title.text}
+			{/foreach}
+			{$profile.friends[0].name}
+			{$profile.address.city}
+			{$key}
+		{/template}
+	`)
+	var tests = []struct {
+		name     string
+		opts     soyusage.ProjectionOptions
+		expected []string
+	}{
+		{
+			name: "defaults",
+			expected: []string{
+				"key",
+				"profile.address.city",
+				"profile.avatar",
+				"profile.fields.*",
+				"profile.friends.name",
+				"profile.links.title.text",
+				"profile.links.url",
+				"profile.name.first",
+			},
+		},
+		{
+			name: "list segments",
+			opts: soyusage.ProjectionOptions{
+				Wildcard:     "%",
+				ListSegments: true,
+			},
+			expected: []string{
+				"key",
+				"profile.address.city",
+				"profile.avatar",
+				"profile.fields.%",
+				"profile.friends.%.name",
+				"profile.links.%.title.text",
+				"profile.links.%.url",
+				"profile.name.first",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			must.BeEqual(t, test.expected, soyusage.ToFieldProjection(params, test.opts))
+		})
+	}
+}
+
+func TestToFieldProjectionFullUsage(t *testing.T) {
+	address := &soyusage.Param{
+		Usage: []soyusage.Usage{{Type: soyusage.UsageFull}},
+		Children: soyusage.Params{
+			soyusage.Name("city"): &soyusage.Param{
+				Usage: []soyusage.Usage{{Type: soyusage.UsageFull}},
+			},
+		},
+	}
+	profile := &soyusage.Param{
+		Children: soyusage.Params{
+			soyusage.Name("address"): address,
+		},
+	}
+	profile.Children[soyusage.Name("self")] = profile
+	must.BeEqual(t, []string{"profile.address.*"}, soyusage.ToFieldProjection(soyusage.Params{
+		soyusage.Name("profile"): profile,
+	}, soyusage.ProjectionOptions{}))
+}
+
+func TestToFieldProjectionIndexedLeaves(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param tags
+		* @param profile
+		*/
+		{template .main}
+			{$tags[0]}{$profile.name}
+		{/template}
+	`)
+	must.BeEqual(t, []string{
+		"profile.name",
+		"tags",
+	}, soyusage.ToFieldProjection(params, soyusage.ProjectionOptions{}))
+	must.BeEqual(t, []string{
+		"profile.name",
+		"tags.*",
+	}, soyusage.ToFieldProjection(params, soyusage.ProjectionOptions{ListSegments: true}))
+}
@@ -0,0 +1,418 @@
+package soyusage
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// protoScalars lists the scalar value types of protocol buffers.
+var protoScalars = map[string]bool{
+	"double": true, "float": true, "int32": true, "int64": true,
+	"uint32": true, "uint64": true, "sint32": true, "sint64": true,
+	"fixed32": true, "fixed64": true, "sfixed32": true, "sfixed64": true,
+	"bool": true, "string": true, "bytes": true,
+}
+
+// FromProtoMessage builds the usage map for a template that accesses every field
+// of a protocol buffer message, from the source of a .proto file. The usage map
+// is in the form described for FlattenUsage, for use as the expected usage in tests.
+//
+// The message is named as in the file, such as "Profile" or "Profile.Address",
+// optionally prefixed by the package. Scalar and enum fields are used in full
+// ("*"), message fields are maps of their own fields and map fields are accessed
+// with unknown keys ("[?]"). Repeated fields are lists, described by the fields of
+// their elements. Types that are not defined in the file, such as imported
+// messages, and messages that contain themselves are used in full where they appear.
+func FromProtoMessage(proto string, messageName string) (map[string]interface{}, error) {
+	file, err := parseProto(proto)
+	if err != nil {
+		return nil, err
+	}
+	message, found := file.messages[messageName]
+	if !found && file.pkg != "" {
+		message, found = file.messages[file.pkg+"."+messageName]
+	}
+	if !found {
+		return nil, fmt.Errorf("message not found: %v", messageName)
+	}
+	return file.usage(message, make(map[*protoMessage]bool)), nil
+}
+
+type protoFile struct {
+	pkg      string
+	messages map[string]*protoMessage
+	enums    map[string]bool
+}
+
+type protoMessage struct {
+	// name is the full name of the message, including the package
+	name   string
+	fields []protoField
+}
+
+type protoField struct {
+	name string
+	// typ is the type of the field, or of the values of a map field
+	typ   string
+	isMap bool
+}
+
+func (f *protoFile) usage(message *protoMessage, visiting map[*protoMessage]bool) map[string]interface{} {
+	visiting[message] = true
+	defer delete(visiting, message)
+	var out = make(map[string]interface{})
+	for _, field := range message.fields {
+		var value interface{} = "*"
+		if fieldMessage := f.resolve(message.name, field.typ); fieldMessage != nil && !visiting[fieldMessage] {
+			value = f.usage(fieldMessage, visiting)
+		}
+		if field.isMap {
+			value = map[string]interface{}{
+				MapIndex{}.String(): value,
+			}
+		}
+		out[field.name] = value
+	}
+	return out
+}
+
+// resolve finds the message for a type referenced from within a message, searching
+// the scopes enclosing the message from the innermost out. Scalars, enums and
+// types not defined in the file resolve to nil.
+func (f *protoFile) resolve(scope string, typ string) *protoMessage {
+	if protoScalars[typ] {
+		return nil
+	}
+	if strings.HasPrefix(typ, ".") {
+		return f.messages[typ[1:]]
+	}
+	for {
+		candidate := typ
+		if scope != "" {
+			candidate = scope + "." + typ
+		}
+		if message, found := f.messages[candidate]; found {
+			return message
+		}
+		if f.enums[candidate] || scope == "" {
+			return nil
+		}
+		if dot := strings.LastIndex(scope, "."); dot >= 0 {
+			scope = scope[:dot]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+type protoToken struct {
+	text string
+	line int
+}
+
+type protoParser struct {
+	tokens []protoToken
+	pos    int
+	file   *protoFile
+}
+
+func parseProto(source string) (*protoFile, error) {
+	tokens, err := tokenizeProto(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &protoParser{
+		tokens: tokens,
+		file: &protoFile{
+			messages: make(map[string]*protoMessage),
+			enums:    make(map[string]bool),
+		},
+	}
+	for !p.done() {
+		switch token := p.next(); token.text {
+		case "syntax", "import", "option", "edition":
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		case "package":
+			p.file.pkg = p.next().text
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		case "message":
+			if err := p.parseMessage(p.file.pkg); err != nil {
+				return nil, err
+			}
+		case "enum":
+			if err := p.parseEnum(p.file.pkg); err != nil {
+				return nil, err
+			}
+		case "service", "extend":
+			p.next()
+			if err := p.skipBlock(); err != nil {
+				return nil, err
+			}
+		case ";":
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", token.line, token.text)
+		}
+	}
+	return p.file, nil
+}
+
+func (p *protoParser) parseMessage(scope string) error {
+	name := p.next()
+	message := &protoMessage{name: joinProtoName(scope, name.text)}
+	p.file.messages[message.name] = message
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	return p.parseMessageBody(message)
+}
+
+// parseMessageBody reads the fields and nested types of a message, or the
+// fields of a oneof within it, up to the closing brace.
+func (p *protoParser) parseMessageBody(message *protoMessage) error {
+	for {
+		if p.done() {
+			return fmt.Errorf("unterminated message %v", message.name)
+		}
+		token := p.next()
+		switch token.text {
+		case "}":
+			return nil
+		case ";":
+		case "message":
+			if err := p.parseMessage(message.name); err != nil {
+				return err
+			}
+		case "enum":
+			if err := p.parseEnum(message.name); err != nil {
+				return err
+			}
+		case "oneof":
+			p.next()
+			if err := p.expect("{"); err != nil {
+				return err
+			}
+			if err := p.parseMessageBody(message); err != nil {
+				return err
+			}
+		case "option", "reserved", "extensions":
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		case "extend":
+			p.next()
+			if err := p.skipBlock(); err != nil {
+				return err
+			}
+		case "map":
+			field, err := p.parseMapField()
+			if err != nil {
+				return err
+			}
+			message.fields = append(message.fields, field)
+		case "repeated", "optional", "required":
+			field, err := p.parseField(p.next())
+			if err != nil {
+				return err
+			}
+			message.fields = append(message.fields, field)
+		default:
+			field, err := p.parseField(token)
+			if err != nil {
+				return err
+			}
+			message.fields = append(message.fields, field)
+		}
+	}
+}
+
+// parseField reads a field of the given type, such as "Address address = 2;".
+func (p *protoParser) parseField(typ protoToken) (protoField, error) {
+	if typ.text == "group" {
+		return protoField{}, fmt.Errorf("line %d: groups are not supported", typ.line)
+	}
+	if !isProtoIdentifier(typ.text) {
+		return protoField{}, fmt.Errorf("line %d: unexpected %q", typ.line, typ.text)
+	}
+	name := p.next()
+	if !isProtoIdentifier(name.text) {
+		return protoField{}, fmt.Errorf("line %d: expected a field name, got %q", name.line, name.text)
+	}
+	if err := p.skipStatement(); err != nil {
+		return protoField{}, err
+	}
+	return protoField{name: name.text, typ: typ.text}, nil
+}
+
+// parseMapField reads a map field following the map keyword, such as
+// "map<string, Link> links = 3;".
+func (p *protoParser) parseMapField() (protoField, error) {
+	if err := p.expect("<"); err != nil {
+		return protoField{}, err
+	}
+	p.next()
+	if err := p.expect(","); err != nil {
+		return protoField{}, err
+	}
+	valueType := p.next()
+	if err := p.expect(">"); err != nil {
+		return protoField{}, err
+	}
+	field, err := p.parseField(valueType)
+	field.isMap = true
+	return field, err
+}
+
+func (p *protoParser) parseEnum(scope string) error {
+	name := p.next()
+	p.file.enums[joinProtoName(scope, name.text)] = true
+	return p.skipBlock()
+}
+
+// skipStatement skips tokens up to and including the next semicolon,
+// along with any bracketed field options before it.
+func (p *protoParser) skipStatement() error {
+	for !p.done() {
+		token := p.next()
+		switch token.text {
+		case ";":
+			return nil
+		case "{", "}":
+			return fmt.Errorf("line %d: expected ';', got %q", token.line, token.text)
+		}
+	}
+	return fmt.Errorf("unexpected end of file, expected ';'")
+}
+
+// skipBlock skips a block delimited by braces, including any nested blocks.
+func (p *protoParser) skipBlock() error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		if p.done() {
+			return fmt.Errorf("unexpected end of file, expected '}'")
+		}
+		switch p.next().text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+func (p *protoParser) expect(text string) error {
+	if p.done() {
+		return fmt.Errorf("unexpected end of file, expected %q", text)
+	}
+	if token := p.next(); token.text != text {
+		return fmt.Errorf("line %d: expected %q, got %q", token.line, text, token.text)
+	}
+	return nil
+}
+
+func (p *protoParser) next() protoToken {
+	if p.done() {
+		return protoToken{}
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token
+}
+
+func (p *protoParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// tokenizeProto splits the source of a .proto file into identifiers, numbers,
+// strings and symbols, discarding whitespace and comments.
+func tokenizeProto(source string) ([]protoToken, error) {
+	var (
+		tokens []protoToken
+		runes  = []rune(source)
+		line   = 1
+	)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := line
+			i += 2
+			for ; i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/'); i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated comment", start)
+			}
+			i += 2
+		case r == '"' || r == '\'':
+			start := i
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			i++
+			tokens = append(tokens, protoToken{text: string(runes[start:i]), line: line})
+		case isProtoWordRune(r):
+			start := i
+			for i < len(runes) && (isProtoWordRune(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, protoToken{text: string(runes[start:i]), line: line})
+		case r == '.':
+			// The leading dot of a fully qualified type name
+			start := i
+			for i++; i < len(runes) && (isProtoWordRune(runes[i]) || runes[i] == '.'); i++ {
+			}
+			tokens = append(tokens, protoToken{text: string(runes[start:i]), line: line})
+		default:
+			tokens = append(tokens, protoToken{text: string(r), line: line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isProtoWordRune(r rune) bool {
+	return r == '_' || r == '-' || r == '+' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isProtoIdentifier(text string) bool {
+	if text == "" || !(text[0] == '_' || text[0] == '.' || unicode.IsLetter(rune(text[0]))) {
+		return false
+	}
+	for _, r := range text {
+		if !(r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func joinProtoName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
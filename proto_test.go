@@ -0,0 +1,155 @@
+package soyusage_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+const profileProto = `
+syntax = "proto3";
+
+package example.profiles;
+
+import "google/protobuf/timestamp.proto";
+
+option go_package = "example.com/profiles";
+
+// Profile is the data for a profile page.
+message Profile {
+	string name = 1;
+	Address address = 2 [json_name = "addr"];
+	repeated Link links = 3;
+	map<string, Field> fields = 4;
+	map<string, string> labels = 5;
+	Status status = 6;
+	google.protobuf.Timestamp updated = 7;
+	Profile manager = 8;
+	oneof contact {
+		string email = 9;
+		string phone = 10;
+	}
+	reserved 11, 12;
+
+	/* Address is a postal address. */
+	message Address {
+		string city = 1;
+		repeated string lines = 2;
+	}
+
+	enum Status {
+		UNKNOWN = 0;
+		ACTIVE = 1;
+	}
+}
+
+message Link {
+	string url = 1;
+	.example.profiles.Profile.Address address = 2;
+}
+
+message Field {
+	string label = 1;
+	optional int32 order = 2;
+}
+
+service Profiles {
+	rpc Get(Profile) returns (Profile) {}
+}
+`
+
+func TestFromProtoMessage(t *testing.T) {
+	expectedAddress := map[string]interface{}{
+		"city":  "*",
+		"lines": "*",
+	}
+	expected := map[string]interface{}{
+		"name":    "*",
+		"address": expectedAddress,
+		"links": map[string]interface{}{
+			"url":     "*",
+			"address": expectedAddress,
+		},
+		"fields": map[string]interface{}{
+			"[?]": map[string]interface{}{
+				"label": "*",
+				"order": "*",
+			},
+		},
+		"labels": map[string]interface{}{
+			"[?]": "*",
+		},
+		"status":  "*",
+		"updated": "*",
+		"manager": "*",
+		"email":   "*",
+		"phone":   "*",
+	}
+
+	got, err := soyusage.FromProtoMessage(profileProto, "Profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, expected, got)
+
+	got, err = soyusage.FromProtoMessage(profileProto, "example.profiles.Profile.Address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, expectedAddress, got)
+}
+
+func TestFromProtoMessageMatchesAnalysis(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param link
+		*/
+		{template .main}
+			{$link.url}
+			{$link.address.city}
+			{$link.address.lines}
+		{/template}
+	`)
+	link, err := soyusage.FromProtoMessage(profileProto, "Link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{"link": link}, mapUsage(params))
+}
+
+func TestFromProtoMessageErrors(t *testing.T) {
+	var tests = []struct {
+		name        string
+		proto       string
+		message     string
+		expectedErr error
+	}{
+		{
+			name:        "missing message",
+			proto:       profileProto,
+			message:     "Account",
+			expectedErr: errors.New("message not found: Account"),
+		},
+		{
+			name:        "unterminated message",
+			proto:       "message A {\n  string name = 1;\n",
+			message:     "A",
+			expectedErr: errors.New("unterminated message A"),
+		},
+		{
+			name:        "missing semicolon",
+			proto:       "message A {\n  string name = 1\n}\n",
+			message:     "A",
+			expectedErr: errors.New(`line 3: expected ';', got "}"`),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := soyusage.FromProtoMessage(test.proto, test.message)
+			must.BeEqualErrors(t, test.expectedErr, err)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package soyusage
+
+// At returns the children of the param at a path of constant keys, such as
+// At("profile", "address") for the fields used from $profile.address, and true
+// if the path exists. Elements accessed by index are given by keys such as "[0]".
+// An empty path returns the params themselves.
+//
+// The elements of a list that was iterated over are all described by the
+// fields of the list, so any index into such a list, such as "[0]", gives the
+// fields of the list itself.
+//
+// Keys are only matched exactly, so a path through a map accessed with unknown
+// keys must use "[?]". A path continuing below a leaf does not exist, even if
+// the leaf is used as a whole. Use Has to check for implicit usage.
+func (p Params) At(path ...string) (Params, bool) {
+	var (
+		params   = p
+		iterated bool
+	)
+	for _, key := range path {
+		if iterated && isIndexKey(key) {
+			continue
+		}
+		param, exists := params.child(key)
+		if !exists {
+			return nil, false
+		}
+		params, iterated = param.Children, param.iterated
+	}
+	return params, true
+}
+
+// Has returns true if a path of keys is used, either explicitly, or implicitly
+// by one of its ancestors.
+//
+// A key matches a param of the same name, or a map accessed with unknown keys
+// ([?]), so Has("profile", "anything") is true if $profile was accessed with an
+// unknown key. A leaf with full or unknown usage uses everything below it, so
+// every path continuing below it is used. Leaves with other usage, such as an
+// existence check, do not use anything below them.
+//
+// As for At, an index into a list that was iterated over matches the fields of
+// the list, so for {foreach $link in $profile.links}{$link.url}{/foreach},
+// Has("profile", "links", "[0]", "url") is true.
+func (p Params) Has(path ...string) bool {
+	return p.has(path, false, make(map[*Param]bool))
+}
+
+// has checks for a path within params, which are the fields of an iterated
+// list if iterated is set.
+func (p Params) has(path []string, iterated bool, visiting map[*Param]bool) bool {
+	if len(path) == 0 {
+		return true
+	}
+	if iterated && isIndexKey(path[0]) {
+		return p.has(path[1:], iterated, visiting)
+	}
+	var candidates []*Param
+	if param, exists := p.child(path[0]); exists {
+		candidates = append(candidates, param)
+	}
+	if param, exists := p[MapIndex{}]; exists {
+		candidates = append(candidates, param)
+	}
+	for _, param := range candidates {
+		if visiting[param] {
+			continue
+		}
+		if len(path) > 1 && len(param.Children) == 0 {
+			if usesDescendants(param) {
+				return true
+			}
+			continue
+		}
+		visiting[param] = true
+		found := param.Children.has(path[1:], param.iterated, visiting)
+		delete(visiting, param)
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// child returns the param whose identifier is given by key.
+func (p Params) child(key string) (*Param, bool) {
+	if param, exists := p[Name(key)]; exists {
+		return param, true
+	}
+	for name, param := range p {
+		if _, isName := name.(Name); !isName && name.String() == key {
+			return param, true
+		}
+	}
+	return nil, false
+}
+
+// isIndexKey returns true iff a key identifies a list element by index, such as "[0]".
+func isIndexKey(key string) bool {
+	_, isIndex := parseIdentifier(key).(ListIndex)
+	return isIndex
+}
+
+// usesDescendants returns true iff a param has usage that requires all of its value.
+func usesDescendants(param *Param) bool {
+	for _, usage := range param.Usage {
+		if usage.Type == UsageFull || usage.Type == UsageUnknown {
+			return true
+		}
+	}
+	return false
+}
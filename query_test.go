@@ -0,0 +1,96 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+)
+
+// queryTemplate uses fields of a param in each of the ways a path may be queried.
+const queryTemplate = `
+	{namespace test}
+	/**
+	* @param profile
+	* @param key
+	*/
+	{template .main}
+		{$profile.name}
+		{if $profile.avatar}shown{/if}
+		{$profile.address.city}
+		{$profile.fields[$key].label}
+		{$profile.friends[0].url}
+		{foreach $link in $profile.links}{$link.url}{/foreach}
+		{myFunc($profile.settings)}
+	{/template}
+`
+
+func TestParamsAt(t *testing.T) {
+	params := analyzeSource(t, queryTemplate)
+
+	address, ok := params.At("profile", "address")
+	must.BeEqual(t, true, ok)
+	must.BeEqual(t, map[string]interface{}{"city": "*"}, mapUsage(address))
+
+	fields, ok := params.At("profile", "fields", "[?]")
+	must.BeEqual(t, true, ok)
+	must.BeEqual(t, map[string]interface{}{"label": "*"}, mapUsage(fields))
+
+	friend, ok := params.At("profile", "friends", "[0]")
+	must.BeEqual(t, true, ok)
+	must.BeEqual(t, map[string]interface{}{"url": "*"}, mapUsage(friend))
+	_, ok = params.At("profile", "friends", "[1]")
+	must.BeEqual(t, false, ok)
+
+	// Any index into an iterated list gives the fields of its elements
+	link, ok := params.At("profile", "links", "[0]")
+	must.BeEqual(t, true, ok)
+	must.BeEqual(t, map[string]interface{}{"url": "*"}, mapUsage(link))
+
+	root, ok := params.At()
+	must.BeEqual(t, true, ok)
+	must.BeEqual(t, mapUsage(params), mapUsage(root))
+
+	// A leaf has no children, but nothing exists below it
+	name, ok := params.At("profile", "name")
+	must.BeEqual(t, true, ok)
+	must.BeEqual(t, 0, len(name))
+	_, ok = params.At("profile", "name", "first")
+	must.BeEqual(t, false, ok)
+
+	// Unknown keys are not matched by other keys
+	_, ok = params.At("profile", "fields", "first")
+	must.BeEqual(t, false, ok)
+	_, ok = params.At("missing")
+	must.BeEqual(t, false, ok)
+}
+
+func TestParamsHas(t *testing.T) {
+	params := analyzeSource(t, queryTemplate)
+	var tests = []struct {
+		path     []string
+		expected bool
+	}{
+		{path: []string{"profile"}, expected: true},
+		{path: []string{"profile", "name"}, expected: true},
+		{path: []string{"profile", "address", "city"}, expected: true},
+		{path: []string{"profile", "address", "country"}, expected: false},
+		{path: []string{"profile", "fields", "anything", "label"}, expected: true},
+		{path: []string{"profile", "fields", "anything", "other"}, expected: false},
+		{path: []string{"profile", "friends", "[0]", "url"}, expected: true},
+		{path: []string{"profile", "friends", "[1]", "url"}, expected: false},
+		{path: []string{"profile", "links", "[0]", "url"}, expected: true},
+		{path: []string{"profile", "links", "[1]", "url"}, expected: true},
+		{path: []string{"profile", "links", "[0]", "title"}, expected: false},
+		// Everything below a leaf with full or unknown usage is used
+		{path: []string{"profile", "name", "first"}, expected: true},
+		{path: []string{"profile", "settings", "theme", "color"}, expected: true},
+		// An existence check does not use the value
+		{path: []string{"profile", "avatar"}, expected: true},
+		{path: []string{"profile", "avatar", "url"}, expected: false},
+		{path: []string{"missing"}, expected: false},
+		{path: nil, expected: true},
+	}
+	for _, test := range tests {
+		must.BeEqual(t, test.expected, params.Has(test.path...), test.path)
+	}
+}
@@ -0,0 +1,152 @@
+package soyusage
+
+import "encoding/json"
+
+// SchemaOptions configures the schema generated by ToJSONSchema.
+type SchemaOptions struct {
+	// RequireFullUsage lists fields as required where they are used other than
+	// by an existence check, or contain a required field, as described by
+	// ValidateData. Otherwise, no fields are required.
+	RequireFullUsage bool
+	// LeafSchema is the schema for leaves with full usage, such as
+	// {"type": "string"}. Defaults to an empty schema, allowing any value.
+	LeafSchema map[string]interface{}
+}
+
+// ToJSONSchema generates a draft-07 JSON Schema describing the data required by
+// a parameter tree.
+//
+// Params with fields are objects, with a property for each constant key and
+// additionalProperties for unknown keys. Params used as lists are arrays of their
+// elements. A param that contains itself is not described again within itself.
+//
+// Where a param was declared with a type, a param declared as a list is an array,
+// and a leaf is described by its declared type, such as {"type": "string"} for
+// string or an array for list<string>, in place of LeafSchema.
+func ToJSONSchema(usage Params, opts SchemaOptions) ([]byte, error) {
+	return json.MarshalIndent(jsonSchema(usage, opts), "", "  ")
+}
+
+// jsonSchema builds the schema for a parameter tree as a map suitable for JSON encoding.
+func jsonSchema(params Params, opts SchemaOptions) map[string]interface{} {
+	schema := objectSchema(params, opts, make(map[*Param]bool))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	return schema
+}
+
+func objectSchema(params Params, opts SchemaOptions, visiting map[*Param]bool) map[string]interface{} {
+	var (
+		properties = make(map[string]interface{})
+		required   = []string{}
+		schema     = map[string]interface{}{
+			"type": "object",
+		}
+	)
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		if visiting[param] {
+			continue
+		}
+		switch name.(type) {
+		case Name:
+			properties[name.String()] = paramSchema(param, opts, visiting)
+			if opts.RequireFullUsage && isRequired(param) {
+				required = append(required, name.String())
+			}
+		case MapIndex:
+			schema["additionalProperties"] = paramSchema(param, opts, visiting)
+		}
+	}
+	schema["properties"] = properties
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func paramSchema(param *Param, opts SchemaOptions, visiting map[*Param]bool) map[string]interface{} {
+	var elements = make(Params)
+	for name, child := range param.Children {
+		if _, isIndex := name.(ListIndex); !isIndex {
+			elements[name] = child
+		}
+	}
+	var (
+		schema       = make(map[string]interface{})
+		isList       = param.IsList || param.Type.Elem() != nil
+		declaredType = param.Type
+	)
+	if isList {
+		declaredType = declaredType.Elem()
+	}
+	if len(elements) > 0 {
+		visiting[param] = true
+		schema = objectSchema(elements, opts, visiting)
+		delete(visiting, param)
+	} else if typed := typeSchema(declaredType); len(param.Children) == 0 && len(typed) > 0 {
+		schema = typed
+	} else if len(param.Children) == 0 && opts.LeafSchema != nil && hasFullUsage(param) {
+		for key, value := range opts.LeafSchema {
+			schema[key] = value
+		}
+	}
+	if isList {
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schema,
+		}
+	}
+	return schema
+}
+
+// jsonSchemaTypes are the JSON Schema types of Soy's primitive types
+var jsonSchemaTypes = map[string]string{
+	"string": "string",
+	"int":    "integer",
+	"float":  "number",
+	"number": "number",
+	"bool":   "boolean",
+}
+
+// typeSchema describes a declared type, returning an empty schema for types
+// with no JSON Schema equivalent, such as unknown (?) or a proto message.
+func typeSchema(t *ParamType) map[string]interface{} {
+	var schema = make(map[string]interface{})
+	if t == nil {
+		return schema
+	}
+	switch t.Name {
+	case "list":
+		schema["type"] = "array"
+		schema["items"] = typeSchema(t.Elem())
+	case "map":
+		schema["type"] = "object"
+		if len(t.Args) == 2 {
+			schema["additionalProperties"] = typeSchema(t.Args[1])
+		}
+	case "record":
+		var properties = make(map[string]interface{})
+		for name, field := range t.Fields {
+			properties[name] = typeSchema(field)
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+	default:
+		if jsonType, isPrimitive := jsonSchemaTypes[t.Name]; isPrimitive {
+			schema["type"] = jsonType
+		}
+	}
+	if jsonType, hasType := schema["type"]; hasType && t.Nullable {
+		schema["type"] = []interface{}{jsonType, "null"}
+	}
+	return schema
+}
+
+func hasFullUsage(param *Param) bool {
+	for _, usage := range param.Usage {
+		if usage.Type == UsageFull {
+			return true
+		}
+	}
+	return false
+}
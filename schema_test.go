@@ -0,0 +1,282 @@
+package soyusage_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+const schemaTemplate = `
+	{namespace test}
+	/**
+	* @param profile
+	* @param key
+	*/
+	{template .main}
+		{$profile.name}
+		{if $profile.avatar}shown{/if}
+		{$profile.fields[$key].label}
+		{foreach $link in $profile.links}
+			{$link.url}
+		{/foreach}
+	{/template}
+`
+
+func TestToJSONSchema(t *testing.T) {
+	params := analyzeSource(t, schemaTemplate)
+	got, err := soyusage.ToJSONSchema(params, soyusage.SchemaOptions{
+		RequireFullUsage: true,
+		LeafSchema: map[string]interface{}{
+			"type": "string",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(got, &schema); err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"key": map[string]interface{}{
+				"type": "string",
+			},
+			"profile": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"avatar": map[string]interface{}{},
+					"fields": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{},
+						"additionalProperties": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"label": map[string]interface{}{
+									"type": "string",
+								},
+							},
+							"required": []interface{}{"label"},
+						},
+					},
+					"links": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"url": map[string]interface{}{
+									"type": "string",
+								},
+							},
+							"required": []interface{}{"url"},
+						},
+					},
+					"name": map[string]interface{}{
+						"type": "string",
+					},
+				},
+				"required": []interface{}{"links", "name"},
+			},
+		},
+		"required": []interface{}{"key", "profile"},
+	}, schema)
+}
+
+func TestToJSONSchemaOptional(t *testing.T) {
+	got, err := soyusage.ToJSONSchema(analyzeSource(t, schemaTemplate), soyusage.SchemaOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(got, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var required []string
+	var findRequired func(value interface{})
+	findRequired = func(value interface{}) {
+		if m, isMap := value.(map[string]interface{}); isMap {
+			for key, child := range m {
+				if key == "required" {
+					required = append(required, fmt.Sprint(child))
+				}
+				findRequired(child)
+			}
+		}
+	}
+	findRequired(schema)
+	must.BeEqual(t, []string(nil), required)
+	must.BeEqual(t, map[string]interface{}{}, schema["properties"].(map[string]interface{})["key"])
+}
+
+func TestToJSONSchemaValidatesSampleData(t *testing.T) {
+	params := analyzeSource(t, schemaTemplate)
+	got, err := soyusage.ToJSONSchema(params, soyusage.SchemaOptions{
+		RequireFullUsage: true,
+		LeafSchema: map[string]interface{}{
+			"type": "string",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(got, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	sample := sampleData(params)
+	must.BeEqual(t, []string(nil), validateSchema(schema, sample, ""))
+	must.BeEqual(t, []soyusage.ValidationError(nil), soyusage.ValidateData(sample, params))
+
+	delete(sample["profile"].(map[string]interface{}), "name")
+	must.BeEqual(t, []string{"profile: missing required property name"}, validateSchema(schema, sample, ""))
+}
+
+// sampleData builds data providing every field in a parameter tree, with a
+// string for each leaf, a single element for each list and a single key for
+// each map accessed with unknown keys.
+func sampleData(params soyusage.Params) map[string]interface{} {
+	var out = make(map[string]interface{})
+	for name, param := range params {
+		switch name.(type) {
+		case soyusage.Name:
+			out[name.String()] = sampleValue(param)
+		case soyusage.MapIndex:
+			out["sample"] = sampleValue(param)
+		}
+	}
+	return out
+}
+
+func sampleValue(param *soyusage.Param) interface{} {
+	var value interface{} = "sample"
+	if len(param.Children) > 0 {
+		value = sampleData(param.Children)
+	}
+	if param.IsList {
+		return []interface{}{value}
+	}
+	return value
+}
+
+// validateSchema checks a decoded JSON value against the subset of JSON Schema
+// generated by ToJSONSchema, returning a message for each violation.
+func validateSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	var out []string
+	switch schema["type"] {
+	case "object":
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return []string{fmt.Sprintf("%v: expected an object, got %T", path, value)}
+		}
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, exists := object[name.(string)]; !exists {
+					out = append(out, fmt.Sprintf("%v: missing required property %v", path, name))
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		var keys []string
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childSchema, isProperty := properties[key].(map[string]interface{})
+			if !isProperty {
+				childSchema, _ = schema["additionalProperties"].(map[string]interface{})
+			}
+			if childSchema != nil {
+				out = append(out, validateSchema(childSchema, object[key], joinPath(path, key))...)
+			}
+		}
+	case "array":
+		list, isList := value.([]interface{})
+		if !isList {
+			return []string{fmt.Sprintf("%v: expected an array, got %T", path, value)}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for index, element := range list {
+			out = append(out, validateSchema(items, element, fmt.Sprintf("%v[%d]", path, index))...)
+		}
+	case "string":
+		if _, isString := value.(string); !isString {
+			return []string{fmt.Sprintf("%v: expected a string, got %T", path, value)}
+		}
+	}
+	return out
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func TestToJSONSchemaDeclaredTypes(t *testing.T) {
+	params := analyzeTypedSource(t, `
+		{namespace test}
+		/**
+		* @param profile: [name: string, tags: list<string>, age: int|null]
+		* @param items: list<[label: string]>
+		* @param scores: map<string, float>
+		*/
+		{template .main}
+			{$profile.name}
+			{$profile.tags}
+			{if $profile.age}{$profile.age}{/if}
+			{foreach $item in $items}{$item.label}{/foreach}
+			{$scores}
+		{/template}
+	`)
+	got, err := soyusage.ToJSONSchema(params, soyusage.SchemaOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(got, &schema); err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"profile": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string"},
+					"tags": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "string"},
+					},
+					"age": map[string]interface{}{
+						"type": []interface{}{"integer", "null"},
+					},
+				},
+			},
+			"items": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"label": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+			"scores": map[string]interface{}{
+				"type": "object",
+				"additionalProperties": map[string]interface{}{
+					"type": "number",
+				},
+			},
+		},
+	}, schema)
+}
@@ -1,15 +1,50 @@
 package soyusage
 
-import "github.com/robfig/soy/template"
+import (
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
 
 // scope represents the usage at the current position in the stack
 type scope struct {
+	// parent is the scope this scope is inside, if any
+	parent       *scope
 	registry     *template.Registry
 	templateName string
 	callStack    []*scope
 	parameters   Params
 	variables    map[Identifier][]*Param
+	// listLiterals identifies variables in this scope holding a list literal,
+	// whose values are the elements of the list rather than lists themselves
+	listLiterals map[Identifier]bool
+	// keysOf identifies variables in this scope holding the keys of params,
+	// such as the variable of a loop over keys($map)
+	keysOf map[Identifier][]*Param
+	// keyListsOf identifies variables in this scope holding the list of keys
+	// of params, such as {let $keys: keys($map)/}
+	keyListsOf map[Identifier][]*Param
+	// data holds the params, other than map literals, passed as the data of the
+	// call to this template, which also provide any params passed on with
+	// data="all" that the template does not declare
+	data []*Param
+	// attribute is the command whose attribute holds the expression being
+	// analyzed, such as the data of a call, if any. The parser positions such
+	// expressions within the attribute rather than the file, so errors are
+	// reported at the position of the command.
+	attribute ast.Node
+	// loopVariable is the variable of the foreach loop whose body this scope contains, if any
+	loopVariable Identifier
 	config       Config
+	// css collects the class names referenced by {css} commands
+	css *Param
+	// xid collects the identifiers referenced by the xid function
+	xid *Param
+	// unknowns collects constructs with unknown usage when in strict mode
+	unknowns *[]error
+	// memo caches the analysis of called templates
+	memo *memo
+	// trace records warnings and unknown usage while a template's analysis is recorded
+	trace *trace
 }
 
 // isRecursive returns true iff this scope is part of a recursive call stack
@@ -32,22 +67,201 @@ func (s *scope) callCycles() int {
 // inner creates a new scope "inside" the current scope
 // The new scope has all the same state, but a new set of variables
 // is created so assignments don't escape up the stack.
+//
+// Variables defined in containing scopes are looked up through the parent
+// rather than copied, so creating a scope only allocates for its own assignments.
 func (s *scope) inner() *scope {
-	out := &scope{
+	return &scope{
+		parent:       s,
 		registry:     s.registry,
 		templateName: s.templateName,
-		callStack:    nil,
+		callStack:    s.callStack,
 		parameters:   s.parameters,
 		variables:    make(map[Identifier][]*Param),
+		data:         s.data,
+		attribute:    s.attribute,
 		config:       s.config,
+		css:          s.css,
+		xid:          s.xid,
+		unknowns:     s.unknowns,
+		memo:         s.memo,
+		trace:        s.trace,
+	}
+}
+
+// variable returns the values of a variable defined in this scope or any scope containing it.
+func (s *scope) variable(name Identifier) ([]*Param, bool) {
+	for p := s; p != nil; p = p.parent {
+		if params, defined := p.variables[name]; defined {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// isListLiteral returns true iff a variable holds the elements of a list literal.
+func (s *scope) isListLiteral(name Identifier) bool {
+	for p := s; p != nil; p = p.parent {
+		if _, defined := p.variables[name]; defined {
+			return p.listLiterals[name]
+		}
+	}
+	return false
+}
+
+// setListLiteral records whether a variable assigned in this scope holds a list literal.
+func (s *scope) setListLiteral(name Identifier, isLiteral bool) {
+	if !isLiteral {
+		delete(s.listLiterals, name)
+		return
+	}
+	if s.listLiterals == nil {
+		s.listLiterals = make(map[Identifier]bool)
+	}
+	s.listLiterals[name] = true
+}
+
+// isLoopVariable returns true iff a variable is defined by a foreach loop containing this scope.
+func (s *scope) isLoopVariable(name Identifier) bool {
+	for p := s; p != nil; p = p.parent {
+		if _, defined := p.variables[name]; defined {
+			return p.loopVariable == name
+		}
+	}
+	return false
+}
+
+// keysOfVariable returns the params whose keys a variable holds, if any.
+func (s *scope) keysOfVariable(name Identifier) []*Param {
+	for p := s; p != nil; p = p.parent {
+		if _, defined := p.variables[name]; defined {
+			return p.keysOf[name]
+		}
+	}
+	return nil
+}
+
+// setKeysOf records the params whose keys a variable assigned in this scope holds.
+func (s *scope) setKeysOf(name Identifier, params []*Param) {
+	if len(params) == 0 {
+		delete(s.keysOf, name)
+		return
+	}
+	if s.keysOf == nil {
+		s.keysOf = make(map[Identifier][]*Param)
+	}
+	s.keysOf[name] = params
+}
+
+// keyListOfVariable returns the params whose list of keys a variable holds, if any.
+func (s *scope) keyListOfVariable(name Identifier) []*Param {
+	for p := s; p != nil; p = p.parent {
+		if _, defined := p.variables[name]; defined {
+			return p.keyListsOf[name]
+		}
+	}
+	return nil
+}
+
+// setKeyListOf records the params whose list of keys a variable assigned in
+// this scope holds.
+func (s *scope) setKeyListOf(name Identifier, params []*Param) {
+	if len(params) == 0 {
+		delete(s.keyListsOf, name)
+		return
+	}
+	if s.keyListsOf == nil {
+		s.keyListsOf = make(map[Identifier][]*Param)
+	}
+	s.keyListsOf[name] = params
+}
+
+// mapKeysOf returns the params, other than map literals, whose list of keys is
+// the result of an expression, such as keys($map) or a variable assigned from it.
+func mapKeysOf(s *scope, node ast.Node) ([]*Param, error) {
+	if ref, isDataRef := node.(*ast.DataRefNode); isDataRef {
+		if len(ref.Access) > 0 {
+			return nil, nil
+		}
+		return s.keyListOfVariable(Name(ref.Key)), nil
+	}
+	function, isFunction := node.(*ast.FunctionNode)
+	if !isFunction || functionName(function) != "keys" || len(function.Args) != 1 {
+		return nil, nil
+	}
+	ref, isDataRef := function.Args[0].(*ast.DataRefNode)
+	if !isDataRef {
+		return nil, nil
+	}
+	params, err := resolveRecordedDataRef(s, ref)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Param
+	for _, param := range params {
+		if !param.isMapLiteral() && !param.isConstant() {
+			out = append(out, param)
+		}
+	}
+	return out, nil
+}
+
+// mapKeyOf returns the params, other than map literals, one of whose keys is
+// the result of an expression, such as the variable of a loop over keys($map),
+// or an element of a variable holding keys($map).
+func mapKeyOf(s *scope, node ast.Node) []*Param {
+	ref, isDataRef := node.(*ast.DataRefNode)
+	if !isDataRef {
+		return nil
+	}
+	switch len(ref.Access) {
+	case 0:
+		return s.keysOfVariable(Name(ref.Key))
+	case 1:
+		switch ref.Access[0].(type) {
+		case *ast.DataRefIndexNode, *ast.DataRefExprNode:
+			return s.keyListOfVariable(Name(ref.Key))
+		}
 	}
+	return nil
+}
 
-	for _, template := range s.callStack {
-		out.callStack = append(out.callStack, template)
+// holdsListLiteral returns true iff an expression evaluates to a list literal,
+// or a list containing the elements of one.
+func holdsListLiteral(s *scope, node ast.Node) bool {
+	switch v := node.(type) {
+	case *ast.ListLiteralNode:
+		return true
+	case *ast.DataRefNode:
+		return len(v.Access) == 0 && s.isListLiteral(Name(v.Key))
+	case *ast.FunctionNode:
+		switch functionName(v) {
+		case "list":
+			return true
+		case "concat":
+			for _, arg := range v.Args {
+				if holdsListLiteral(s, arg) {
+					return true
+				}
+			}
+		case "slice":
+			return len(v.Args) > 0 && holdsListLiteral(s, v.Args[0])
+		}
 	}
+	return false
+}
 
+// allVariables returns the values of every variable visible from this scope.
+func (s *scope) allVariables() map[Identifier][]*Param {
+	if s.parent == nil {
+		return s.variables
+	}
+	out := make(map[Identifier][]*Param)
+	for name, params := range s.parent.allVariables() {
+		out[name] = params
+	}
 	for name, params := range s.variables {
-		out.variables[name] = params
+		out[name] = params
 	}
 	return out
 }
@@ -61,11 +275,65 @@ func (s *scope) call(templateName string) *scope {
 		parameters:   make(Params),
 		variables:    make(map[Identifier][]*Param),
 		config:       s.config,
+		css:          s.css,
+		xid:          s.xid,
+		unknowns:     s.unknowns,
+		memo:         s.memo,
+		trace:        s.trace,
 	}
 
-	for _, template := range s.callStack {
-		out.callStack = append(out.callStack, template)
-	}
+	// The call stack is shared between inner scopes, so is copied before appending
+	out.callStack = make([]*scope, len(s.callStack), len(s.callStack)+1)
+	copy(out.callStack, s.callStack)
 	out.callStack = append(out.callStack, s)
 	return out
 }
+
+// accumulate adds values to all definitions of a variable in the scopes
+// containing this one.
+func (s *scope) accumulate(name Identifier, values []*Param) {
+	for p := s.parent; p != nil; p = p.parent {
+		existing, defined := p.variables[name]
+		if !defined {
+			continue
+		}
+		for _, value := range values {
+			if !containsParam(existing, value) {
+				existing = append(existing, value)
+			}
+		}
+		p.variables[name] = existing
+	}
+}
+
+func containsParam(params []*Param, param *Param) bool {
+	for _, p := range params {
+		if p == param {
+			return true
+		}
+	}
+	return false
+}
+
+// reportUnknown records a construct resulting in unknown usage if
+// the analysis is in strict mode.
+func (s *scope) reportUnknown(node ast.Node, message string, args ...interface{}) {
+	if !s.config.Strict {
+		return
+	}
+	s.addUnknown(newErrorf(s, node, message, args...))
+}
+
+// addUnknown adds an error for unknown usage, if it has not already been added.
+func (s *scope) addUnknown(err error) {
+	unknowns := s.unknowns
+	if s.trace != nil {
+		unknowns = &s.trace.unknowns
+	}
+	for _, existing := range *unknowns {
+		if existing.Error() == err.Error() {
+			return
+		}
+	}
+	*unknowns = append(*unknowns, err)
+}
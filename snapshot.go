@@ -0,0 +1,230 @@
+package soyusage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ComparisonResult describes the differences between the fields used by a
+// template and the fields of a snapshot of the data it is rendered with.
+type ComparisonResult struct {
+	// Missing lists the paths to fields the template requires that are not
+	// present in the snapshot, which may cause errors in production
+	Missing []string
+	// Unused lists the paths to fields present in the snapshot that the
+	// template does not access, which may be fetched unnecessarily
+	Unused []string
+}
+
+// CompareToSnapshot compares a usage map with a JSON-encoded snapshot of the
+// data a template was rendered with, such as data captured from production.
+//
+// The usage map is in the form described for FlattenUsage, and paths are
+// dotted in the same form, such as "profile.name". Fields of the elements of a
+// list have the same path as the list, and elements accessed by a constant
+// index are given as "links.[0]". Fields under a map accessed with unknown keys
+// are given with the keys found in the snapshot.
+//
+// A field is missing if it is used other than by an existence check or optional
+// usage, or contains such a field. Null values are present, but their fields are
+// not compared. Full or unknown usage of a field uses all of its contents, while
+// other usage, such as an existence check, uses none of them. A field that is
+// unused is listed without the fields it contains.
+func CompareToSnapshot(usage map[string]interface{}, data []byte) (*ComparisonResult, error) {
+	var snapshot interface{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("reading snapshot: %v", err)
+	}
+	object, isObject := snapshot.(map[string]interface{})
+	if !isObject {
+		return nil, fmt.Errorf("snapshot must be a JSON object, got %T", snapshot)
+	}
+	c := &snapshotComparison{
+		missing: make(map[string]bool),
+		unused:  make(map[string]bool),
+	}
+	if err := c.compareMap(usage, object, ""); err != nil {
+		return nil, err
+	}
+	return &ComparisonResult{
+		Missing: sortedPaths(c.missing),
+		Unused:  sortedPaths(c.unused),
+	}, nil
+}
+
+type snapshotComparison struct {
+	missing map[string]bool
+	unused  map[string]bool
+}
+
+func (c *snapshotComparison) compareMap(usage map[string]interface{}, snapshot map[string]interface{}, path string) error {
+	unknownKeys, hasUnknownKeys := usage[MapIndex{}.String()]
+	for _, key := range sortedKeys(usage, snapshot) {
+		if key == (MapIndex{}).String() {
+			continue
+		}
+		var (
+			fieldPath      = joinUsagePath(path, key)
+			fieldUsage, ok = usage[key]
+			value, present = snapshot[key]
+		)
+		switch {
+		case !ok && hasUnknownKeys:
+			if err := c.compareValue(unknownKeys, value, fieldPath); err != nil {
+				return err
+			}
+		case !ok:
+			c.unused[fieldPath] = true
+		case !present:
+			required, err := isRequiredUsage(fieldUsage, fieldPath)
+			if err != nil {
+				return err
+			}
+			if required {
+				c.missing[fieldPath] = true
+			}
+		default:
+			if err := c.compareValue(fieldUsage, value, fieldPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *snapshotComparison) compareValue(usage interface{}, value interface{}, path string) error {
+	switch usage := usage.(type) {
+	case string:
+		if usesContents(usage) {
+			return nil
+		}
+		c.unusedContents(value, path)
+		return nil
+	case map[string]interface{}:
+		switch value := value.(type) {
+		case nil:
+			return nil
+		case map[string]interface{}:
+			return c.compareMap(usage, value, path)
+		case []interface{}:
+			return c.compareList(usage, value, path)
+		}
+		// Fields of a scalar are all absent
+		return c.compareMap(usage, nil, path)
+	}
+	return fmt.Errorf("%v: unexpected usage value of type %T", path, usage)
+}
+
+// compareList compares each element of a list with the fields used from the
+// elements of the list, or those used from the element at its index, if any.
+func (c *snapshotComparison) compareList(usage map[string]interface{}, list []interface{}, path string) error {
+	var (
+		elementUsage = make(map[string]interface{})
+		indexUsage   = make(map[int]interface{})
+	)
+	for key, value := range usage {
+		if index, isIndex := parseIdentifier(key).(ListIndex); isIndex {
+			indexUsage[int(index)] = value
+			continue
+		}
+		elementUsage[key] = value
+	}
+	for index, element := range list {
+		elementPath := joinUsagePath(path, ListIndex(index).String())
+		if indexed, isIndexed := indexUsage[index]; isIndexed {
+			if err := c.compareValue(indexed, element, elementPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(elementUsage) == 0 {
+			c.unused[elementPath] = true
+			continue
+		}
+		if err := c.compareValue(elementUsage, element, path); err != nil {
+			return err
+		}
+	}
+	for index, indexed := range indexUsage {
+		if index < len(list) {
+			continue
+		}
+		elementPath := joinUsagePath(path, ListIndex(index).String())
+		required, err := isRequiredUsage(indexed, elementPath)
+		if err != nil {
+			return err
+		}
+		if required {
+			c.missing[elementPath] = true
+		}
+	}
+	return nil
+}
+
+// unusedContents records the fields of a value as unused, including the fields
+// of the elements of a list.
+func (c *snapshotComparison) unusedContents(value interface{}, path string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key := range value {
+			c.unused[joinUsagePath(path, key)] = true
+		}
+	case []interface{}:
+		for _, element := range value {
+			c.unusedContents(element, path)
+		}
+	}
+}
+
+// usesContents returns true iff a leaf of a usage map describes usage of the
+// whole value, rather than only its existence, length or keys.
+func usesContents(usage string) bool {
+	switch usage {
+	case "*", "?", "~optional~":
+		return true
+	}
+	return false
+}
+
+// isRequiredUsage returns true iff a value in a usage map describes usage other
+// than an existence check or optional usage, or contains such usage.
+func isRequiredUsage(usage interface{}, path string) (bool, error) {
+	switch usage := usage.(type) {
+	case string:
+		return !isConditionalUsage(usage), nil
+	case map[string]interface{}:
+		for key, child := range usage {
+			if key == (MapIndex{}).String() {
+				continue
+			}
+			required, err := isRequiredUsage(child, joinUsagePath(path, key))
+			if required || err != nil {
+				return required, err
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("%v: unexpected usage value of type %T", path, usage)
+}
+
+// sortedKeys returns the keys of both maps, sorted.
+func sortedKeys(a, b map[string]interface{}) []string {
+	var keys = make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	return sortedPaths(keys)
+}
+
+func sortedPaths(leaves map[string]bool) []string {
+	var out []string
+	for path := range leaves {
+		out = append(out, path)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,160 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestCompareToSnapshot(t *testing.T) {
+	const template = `
+		{namespace test}
+		/**
+		* @param profile
+		* @param links
+		* @param labels
+		* @param key
+		* @param banner
+		*/
+		{template .main}
+			{$profile.name}
+			{if $profile.nickname}nicknamed{/if}
+			{foreach $link in $links}
+				<a href="{$link.url}">{$link.label}</a>
+			{/foreach}
+			{$labels[$key].text}
+			{if $banner}shown{/if}
+		{/template}
+	`
+	params := analyzeSource(t, template)
+	usage := params.ToMap(soyusage.MapOptions{})
+
+	var tests = []struct {
+		name     string
+		snapshot string
+		expected *soyusage.ComparisonResult
+	}{
+		{
+			name: "exact data",
+			snapshot: `{
+				"profile": {"name": "Name", "nickname": "Nick"},
+				"links": [{"url": "/a", "label": "A"}, {"url": "/b", "label": "B"}],
+				"labels": {"en": {"text": "Hello"}},
+				"key": "en",
+				"banner": true
+			}`,
+			expected: &soyusage.ComparisonResult{},
+		},
+		{
+			name: "optional fields absent",
+			snapshot: `{
+				"profile": {"name": "Name"},
+				"links": [],
+				"labels": {},
+				"key": "en"
+			}`,
+			expected: &soyusage.ComparisonResult{},
+		},
+		{
+			name: "required fields missing",
+			snapshot: `{
+				"profile": {"nickname": "Nick"},
+				"links": [{"url": "/a"}, {"label": "B"}],
+				"labels": {"en": {}}
+			}`,
+			expected: &soyusage.ComparisonResult{
+				Missing: []string{
+					"key",
+					"labels.en.text",
+					"links.label",
+					"links.url",
+					"profile.name",
+				},
+			},
+		},
+		{
+			name: "unused fields",
+			snapshot: `{
+				"profile": {"name": "Name", "avatar": {"url": "/avatar.png"}},
+				"links": [{"url": "/a", "label": "A", "icon": "a.png"}],
+				"labels": {"en": {"text": "Hello", "lang": "en"}},
+				"key": "en",
+				"banner": {"title": "Sale", "image": "sale.png"},
+				"footer": "unused"
+			}`,
+			expected: &soyusage.ComparisonResult{
+				Unused: []string{
+					"banner.image",
+					"banner.title",
+					"footer",
+					"labels.en.lang",
+					"links.icon",
+					"profile.avatar",
+				},
+			},
+		},
+		{
+			name: "null values",
+			snapshot: `{
+				"profile": null,
+				"links": null,
+				"labels": null,
+				"key": null
+			}`,
+			expected: &soyusage.ComparisonResult{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := soyusage.CompareToSnapshot(usage, []byte(test.snapshot))
+			if err != nil {
+				t.Fatal(err)
+			}
+			must.BeEqual(t, test.expected, result)
+		})
+	}
+}
+
+func TestCompareToSnapshotIndexedElements(t *testing.T) {
+	usage := map[string]interface{}{
+		"items": map[string]interface{}{
+			"[0]": map[string]interface{}{
+				"title": "*",
+			},
+			"[2]": "*",
+		},
+		"data": "*",
+	}
+	result, err := soyusage.CompareToSnapshot(usage, []byte(`{
+		"items": [{"title": "First", "body": "..."}, {"title": "Second"}],
+		"data": {"any": {"nested": "value"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, &soyusage.ComparisonResult{
+		Missing: []string{"items.[2]"},
+		Unused:  []string{"items.[0].body", "items.[1]"},
+	}, result)
+}
+
+func TestCompareToSnapshotErrors(t *testing.T) {
+	usage := map[string]interface{}{"a": "*"}
+	var tests = []struct {
+		name     string
+		usage    map[string]interface{}
+		snapshot string
+	}{
+		{name: "invalid json", usage: usage, snapshot: `{"a":`},
+		{name: "not an object", usage: usage, snapshot: `["a"]`},
+		{name: "invalid usage", usage: map[string]interface{}{"a": 1}, snapshot: `{"a": "value"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := soyusage.CompareToSnapshot(test.usage, []byte(test.snapshot)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
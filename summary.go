@@ -0,0 +1,138 @@
+package soyusage
+
+import "sort"
+
+// summaryTopPaths is the number of most commonly accessed paths listed in a summary.
+const summaryTopPaths = 10
+
+// AnalysisSummary aggregates the usage maps for a set of templates.
+type AnalysisSummary struct {
+	// Templates is the number of templates summarized
+	Templates int
+	// Paths is the number of distinct dotted paths accessed across all templates
+	Paths int
+	// UnknownAccesses counts the map accesses with unknown keys ([?]) and the
+	// leaves with unknown usage ("?") across all templates
+	UnknownAccesses int
+	// TemplatesWithUnknown is the number of templates with at least one unknown access
+	TemplatesWithUnknown int
+	// TopPaths lists the most commonly accessed paths, in descending order of
+	// the number of templates accessing them
+	TopPaths []PathCount
+}
+
+// PathCount gives the number of templates accessing a dotted path.
+type PathCount struct {
+	Path  string
+	Count int
+}
+
+// Summarize computes an AnalysisSummary for usage maps keyed by template name.
+// Usage maps are in the form described for FlattenUsage.
+//
+// Paths are counted once per template that accesses them, and TopPaths lists
+// up to 10 paths, with ties ordered by path.
+func Summarize(results map[string]map[string]interface{}) AnalysisSummary {
+	var (
+		summary = AnalysisSummary{
+			Templates: len(results),
+		}
+		counts = FieldFrequency(results)
+	)
+	for _, usage := range results {
+		unknown := summarizeUsage(usage, "", make(map[string]bool))
+		summary.UnknownAccesses += unknown
+		if unknown > 0 {
+			summary.TemplatesWithUnknown++
+		}
+	}
+	summary.Paths = len(counts)
+
+	for path, count := range counts {
+		summary.TopPaths = append(summary.TopPaths, PathCount{Path: path, Count: count})
+	}
+	sort.Slice(summary.TopPaths, func(i, j int) bool {
+		a, b := summary.TopPaths[i], summary.TopPaths[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Path < b.Path
+	})
+	if len(summary.TopPaths) > summaryTopPaths {
+		summary.TopPaths = summary.TopPaths[:summaryTopPaths]
+	}
+	return summary
+}
+
+// FieldFrequency counts the number of templates accessing each dotted path to a
+// leaf of the usage maps, such as "profile.name", for usage maps keyed by
+// template name. Usage maps are in the form described for FlattenUsage.
+func FieldFrequency(results map[string]map[string]interface{}) map[string]int {
+	var counts = make(map[string]int)
+	for _, usage := range results {
+		var paths = make(map[string]bool)
+		summarizeUsage(usage, "", paths)
+		for path := range paths {
+			counts[path]++
+		}
+	}
+	return counts
+}
+
+// summarizeUsage adds the path to every leaf of a usage map to paths, returning
+// the number of unknown accesses found.
+func summarizeUsage(usage map[string]interface{}, prefix string, paths map[string]bool) int {
+	var unknown int
+	for name, value := range usage {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if name == (MapIndex{}).String() {
+			unknown++
+		}
+		if children, isMap := value.(map[string]interface{}); isMap && len(children) > 0 {
+			unknown += summarizeUsage(children, path, paths)
+			continue
+		}
+		if value == "?" {
+			unknown++
+		}
+		paths[path] = true
+	}
+	return unknown
+}
+
+// InvertUsage groups usage maps keyed by template name by top-level param, for a
+// report of which fields of each param are accessed by which templates. Usage
+// maps are in the form described for FlattenUsage.
+//
+// The result is keyed by param name, then by the dotted path to each accessed
+// field relative to the param, such as "fields.[?].label", with a sorted list of
+// the templates accessing that field. A param used as a whole is listed with an
+// empty path.
+func InvertUsage(results map[string]map[string]interface{}) map[string]map[string][]string {
+	var out = make(map[string]map[string][]string)
+	for templateName, usage := range results {
+		for param, value := range usage {
+			var fields = make(map[string]bool)
+			if children, isMap := value.(map[string]interface{}); isMap && len(children) > 0 {
+				summarizeUsage(children, "", fields)
+			} else {
+				fields[""] = true
+			}
+			if out[param] == nil {
+				out[param] = make(map[string][]string)
+			}
+			for field := range fields {
+				out[param][field] = append(out[param][field], templateName)
+			}
+		}
+	}
+	for _, fields := range out {
+		for _, templates := range fields {
+			sort.Strings(templates)
+		}
+	}
+	return out
+}
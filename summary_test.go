@@ -0,0 +1,121 @@
+package soyusage_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestSummarize(t *testing.T) {
+	summary := soyusage.Summarize(map[string]map[string]interface{}{
+		"test.first": {
+			"a": map[string]interface{}{
+				"b": "*",
+				"c": "e",
+			},
+			"d": "*",
+		},
+		"test.second": {
+			"a": map[string]interface{}{
+				"b": "*",
+				"[?]": map[string]interface{}{
+					"x": "?",
+				},
+			},
+		},
+		"test.third": {
+			"d": "*",
+			"e": "?",
+		},
+	})
+	must.BeEqual(t, soyusage.AnalysisSummary{
+		Templates:            3,
+		Paths:                5,
+		UnknownAccesses:      3,
+		TemplatesWithUnknown: 2,
+		TopPaths: []soyusage.PathCount{
+			{Path: "a.b", Count: 2},
+			{Path: "d", Count: 2},
+			{Path: "a.[?].x", Count: 1},
+			{Path: "a.c", Count: 1},
+			{Path: "e", Count: 1},
+		},
+	}, summary)
+}
+
+func TestSummarizeLimitsTopPaths(t *testing.T) {
+	var usage = make(map[string]interface{})
+	for i := 0; i < 15; i++ {
+		usage[fmt.Sprintf("p%02d", i)] = "*"
+	}
+	summary := soyusage.Summarize(map[string]map[string]interface{}{
+		"test.main": usage,
+	})
+	must.BeEqual(t, 15, summary.Paths)
+	must.BeEqual(t, 10, len(summary.TopPaths))
+	must.BeEqual(t, "p00", summary.TopPaths[0].Path)
+	must.BeEqual(t, "p09", summary.TopPaths[9].Path)
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	must.BeEqual(t, soyusage.AnalysisSummary{}, soyusage.Summarize(nil))
+}
+
+func TestFieldFrequency(t *testing.T) {
+	must.BeEqual(t, map[string]int{
+		"profile.name":      2,
+		"profile.[?].label": 1,
+		"profile.avatar":    1,
+		"category":          1,
+	}, soyusage.FieldFrequency(map[string]map[string]interface{}{
+		"test.first": {
+			"profile": map[string]interface{}{
+				"name":   "*",
+				"avatar": "e",
+			},
+		},
+		"test.second": {
+			"profile": map[string]interface{}{
+				"name": "*",
+				"[?]": map[string]interface{}{
+					"label": "*",
+				},
+			},
+			"category": "*",
+		},
+	}))
+}
+
+func TestInvertUsage(t *testing.T) {
+	must.BeEqual(t, map[string]map[string][]string{
+		"profile": {
+			"name":             {"test.card", "test.main"},
+			"avatar":           {"test.main"},
+			"fields.[?].label": {"test.card"},
+		},
+		"locale": {
+			"": {"test.card", "test.main"},
+		},
+	}, soyusage.InvertUsage(map[string]map[string]interface{}{
+		"test.main": {
+			"profile": map[string]interface{}{
+				"name":   "*",
+				"avatar": "e",
+			},
+			"locale": "*",
+		},
+		"test.card": {
+			"profile": map[string]interface{}{
+				"name": "*",
+				"fields": map[string]interface{}{
+					"[?]": map[string]interface{}{
+						"label": "*",
+					},
+				},
+			},
+			"locale": "?",
+		},
+	}))
+}
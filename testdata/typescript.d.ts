@@ -0,0 +1,45 @@
+export interface MainParams {
+  key: unknown;
+  profile: MainParamsProfile;
+  theme?: unknown;
+}
+
+export interface MainParamsProfile {
+  avatar?: MainParamsProfileAvatar;
+  "c_life-about": unknown;
+  fields?: MainParamsProfileFields;
+  links: MainParamsProfileLinks[];
+  name: MainParamsProfileName;
+  settings: MainParamsProfileSettings;
+  tags: unknown[];
+}
+
+export interface MainParamsProfileAvatar {
+  url: unknown;
+}
+
+export interface MainParamsProfileFields {
+  [key: string]: MainParamsProfileFieldsValue;
+}
+
+export interface MainParamsProfileLinks {
+  title: MainParamsProfileLinksTitle;
+  url: unknown;
+}
+
+export interface MainParamsProfileName {
+  first: unknown;
+}
+
+export interface MainParamsProfileSettings {
+  mode: unknown;
+  [key: string]: unknown;
+}
+
+export interface MainParamsProfileFieldsValue {
+  label: unknown;
+}
+
+export interface MainParamsProfileLinksTitle {
+  text: unknown;
+}
@@ -0,0 +1,29 @@
+interface MainParams {
+  key: unknown;
+  profile: {
+    avatar?: {
+      url: unknown;
+    };
+    "c_life-about": unknown;
+    fields?: {
+      [key: string]: {
+        label: unknown;
+      };
+    };
+    links: {
+      title: {
+        text: unknown;
+      };
+      url: unknown;
+    }[];
+    name: {
+      first: unknown;
+    };
+    settings: {
+      mode: unknown;
+      [key: string]: unknown;
+    };
+    tags: unknown[];
+  };
+  theme?: unknown;
+}
@@ -0,0 +1,145 @@
+// Package testing provides helpers for asserting the data usage of soy templates
+// in unit tests.
+package testing
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/theothertomelliott/soyusage"
+)
+
+// AssertUsage analyzes the template named templateName, from a set of template
+// files keyed by filename, and reports an error to t if the usage differs from
+// expected.
+//
+// The expected usage is in the form produced by soyusage.Params.ToMap with the
+// default options, such as {"profile": {"name": "*", "avatar": "e"}}. Differences
+// are reported as missing, extra or changed leaves, with the path to each leaf as
+// a soy expression such as $profile.fields[?].label.
+func AssertUsage(t testing.TB, templates map[string]string, templateName string, expected map[string]interface{}) {
+	t.Helper()
+	bundle := soy.NewBundle()
+	var filenames []string
+	for filename := range templates {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		bundle = bundle.AddTemplateString(filename, templates[filename])
+	}
+	registry, err := bundle.Compile()
+	if err != nil {
+		t.Fatalf("compiling templates: %v", err)
+		return
+	}
+	params, err := soyusage.AnalyzeTemplate(templateName, registry)
+	if err != nil {
+		t.Fatalf("analyzing %v: %v", templateName, err)
+		return
+	}
+	if diff := DiffUsage(expected, params.ToMap(soyusage.MapOptions{})); diff != "" {
+		t.Errorf("unexpected usage for %v:\n%v", templateName, diff)
+	}
+}
+
+// DiffUsage compares expected and actual usage maps in the form described for
+// soyusage.FlattenUsage, returning a line for each leaf that is missing, extra
+// or has changed, sorted by path. It returns an empty string if the maps match.
+func DiffUsage(expected, actual map[string]interface{}) string {
+	var (
+		expectedLeaves = make(map[string]string)
+		actualLeaves   = make(map[string]string)
+		paths          = make(map[string]bool)
+	)
+	usageLeaves(expected, nil, expectedLeaves)
+	usageLeaves(actual, nil, actualLeaves)
+	for path := range expectedLeaves {
+		paths[path] = true
+	}
+	for path := range actualLeaves {
+		paths[path] = true
+	}
+	var sorted []string
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var out []string
+	for _, path := range sorted {
+		expectedUsage, isExpected := expectedLeaves[path]
+		actualUsage, isActual := actualLeaves[path]
+		switch {
+		case !isActual:
+			out = append(out, fmt.Sprintf("missing %v (%v)", path, expectedUsage))
+		case !isExpected:
+			out = append(out, fmt.Sprintf("extra %v (%v)", path, actualUsage))
+		case expectedUsage != actualUsage:
+			out = append(out, fmt.Sprintf("changed %v: expected %v, got %v", path, expectedUsage, actualUsage))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// usageLeaves adds the path expression for every leaf of a usage map to leaves,
+// along with a description of its usage.
+func usageLeaves(usage map[string]interface{}, parent []string, leaves map[string]string) {
+	for name, value := range usage {
+		path := append(parent[:len(parent):len(parent)], name)
+		if children, isMap := value.(map[string]interface{}); isMap && len(children) > 0 {
+			usageLeaves(children, path, leaves)
+			continue
+		}
+		leaves[pathExpression(path)] = describeUsage(value)
+	}
+}
+
+var soyIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// pathExpression renders a path as a soy expression, such as $profile['c_life-about'].
+func pathExpression(path []string) string {
+	var out strings.Builder
+	for i, name := range path {
+		switch {
+		case i == 0:
+			out.WriteString("$" + name)
+		case strings.HasPrefix(name, "["):
+			out.WriteString(name)
+		case soyIdentifier.MatchString(name):
+			out.WriteString("." + name)
+		default:
+			out.WriteString("['" + strings.Replace(name, "'", "\\'", -1) + "']")
+		}
+	}
+	return out.String()
+}
+
+func describeUsage(value interface{}) string {
+	switch value {
+	case "*":
+		return "full"
+	case "?":
+		return "unknown"
+	case "e":
+		return "exists"
+	case "m":
+		return "meta"
+	case "c":
+		return "css-reference"
+	case "k":
+		return "keys"
+	case "x":
+		return "xid-reference"
+	case "~optional~":
+		return "optional"
+	}
+	if children, isMap := value.(map[string]interface{}); isMap && len(children) == 0 {
+		return "no usage"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,109 @@
+package testing_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	soytesting "github.com/theothertomelliott/soyusage/testing"
+)
+
+// recorder captures the failures reported to a testing.TB.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+var templates = map[string]string{
+	"test.soy": `
+		{namespace test}
+		/**
+		* @param profile
+		* @param key
+		*/
+		{template .main}
+			{$profile.name}
+			{if $profile.avatar}shown{/if}
+			{$profile.fields[$key].label}
+			{$profile['c_life-about']}
+			{call .details}
+				{param profile: $profile /}
+			{/call}
+		{/template}
+
+		/**
+		* @param profile
+		*/
+		{template .details}
+			{$profile.location}
+		{/template}
+	`,
+}
+
+func TestAssertUsage(t *testing.T) {
+	soytesting.AssertUsage(t, templates, "test.main", map[string]interface{}{
+		"key": "*",
+		"profile": map[string]interface{}{
+			"name":         "*",
+			"avatar":       "e",
+			"c_life-about": "*",
+			"location":     "*",
+			"fields": map[string]interface{}{
+				"[?]": map[string]interface{}{
+					"label": "*",
+				},
+			},
+		},
+	})
+}
+
+func TestAssertUsageFailure(t *testing.T) {
+	r := &recorder{}
+	soytesting.AssertUsage(r, templates, "test.main", map[string]interface{}{
+		"key": "*",
+		"profile": map[string]interface{}{
+			"name":     "*",
+			"avatar":   "*",
+			"nickname": "e",
+			"fields": map[string]interface{}{
+				"[?]": map[string]interface{}{
+					"label": "*",
+				},
+			},
+		},
+	})
+	must.BeEqual(t, []string{`unexpected usage for test.main:
+changed $profile.avatar: expected full, got exists
+extra $profile.location (full)
+missing $profile.nickname (exists)
+extra $profile['c_life-about'] (full)`}, r.errors)
+}
+
+func TestAssertUsageCompileError(t *testing.T) {
+	r := &recorder{}
+	soytesting.AssertUsage(r, map[string]string{
+		"test.soy": "{namespace test}{template .main}{/templat}",
+	}, "test.main", nil)
+	must.BeEqual(t, 1, len(r.errors))
+}
+
+func TestDiffUsage(t *testing.T) {
+	must.BeEqual(t, "", soytesting.DiffUsage(
+		map[string]interface{}{"a": map[string]interface{}{"b": "*"}},
+		map[string]interface{}{"a": map[string]interface{}{"b": "*"}},
+	))
+	must.BeEqual(t, "changed $a[?]: expected unknown, got optional\nmissing $b (meta)", soytesting.DiffUsage(
+		map[string]interface{}{"a": map[string]interface{}{"[?]": "?"}, "b": "m"},
+		map[string]interface{}{"a": map[string]interface{}{"[?]": "~optional~"}},
+	))
+}
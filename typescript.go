@@ -0,0 +1,255 @@
+package soyusage
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TSOptions configures the declarations generated by ToTypeScript.
+type TSOptions struct {
+	// Export adds the export keyword to each interface
+	Export bool
+	// Inline declares nested objects as inline types within their parent,
+	// rather than as separate interfaces
+	Inline bool
+}
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// ToTypeScript generates TypeScript interface declarations describing the data
+// required by a parameter tree, with the interface for the params named rootName.
+//
+// Params with fields are objects, declared as interfaces named after the path to
+// them, such as RootProfileLinks, or as inline types. Leaves have their declared
+// type, or unknown where no type was declared, unknown keys ([?]) are index
+// signatures and params used or declared as lists are arrays of their elements. Fields are optional unless required as described by ValidateData.
+// Where an object has both constant and unknown keys, the index signature has the
+// type unknown, so it is compatible with every property.
+func ToTypeScript(usage Params, rootName string, opts TSOptions) (string, error) {
+	if !tsIdentifier.MatchString(rootName) {
+		return "", fmt.Errorf("invalid interface name: %q", rootName)
+	}
+	g := &tsGenerator{
+		opts:     opts,
+		names:    map[string]bool{rootName: true},
+		declared: make(map[*Param]string),
+		visiting: make(map[*Param]bool),
+	}
+	g.declare(rootName, usage)
+	return g.out.String(), nil
+}
+
+type tsGenerator struct {
+	opts     TSOptions
+	out      bytes.Buffer
+	names    map[string]bool
+	declared map[*Param]string
+	visiting map[*Param]bool
+	pending  []tsInterface
+}
+
+type tsInterface struct {
+	name   string
+	fields Params
+}
+
+// declare writes the interface for a set of fields, followed by the interfaces
+// for any nested objects.
+func (g *tsGenerator) declare(name string, fields Params) {
+	g.pending = append(g.pending, tsInterface{name: name, fields: fields})
+	for len(g.pending) > 0 {
+		next := g.pending[0]
+		g.pending = g.pending[1:]
+		if g.out.Len() > 0 {
+			g.out.WriteString("\n")
+		}
+		if g.opts.Export {
+			g.out.WriteString("export ")
+		}
+		fmt.Fprintf(&g.out, "interface %v ", next.name)
+		g.writeObject(next.name, next.fields, 0)
+		g.out.WriteString("\n")
+	}
+}
+
+// writeObject writes an object type for a set of fields.
+func (g *tsGenerator) writeObject(name string, fields Params, depth int) {
+	indent := strings.Repeat("  ", depth+1)
+	g.out.WriteString("{\n")
+	var (
+		index    *Param
+		hasNamed bool
+	)
+	for _, fieldName := range sortedNames(fields) {
+		param := fields[fieldName]
+		switch fieldName.(type) {
+		case Name:
+			hasNamed = true
+			optional := "?"
+			if isRequired(param) {
+				optional = ""
+			}
+			fmt.Fprintf(&g.out, "%v%v%v: ", indent, tsKey(fieldName.String()), optional)
+			g.writeType(name+tsTypeName(fieldName.String()), param, depth+1)
+			g.out.WriteString(";\n")
+		case MapIndex:
+			index = param
+		}
+	}
+	if index != nil {
+		fmt.Fprintf(&g.out, "%v[key: string]: ", indent)
+		if hasNamed {
+			g.out.WriteString("unknown")
+		} else {
+			g.writeType(name+"Value", index, depth+1)
+		}
+		g.out.WriteString(";\n")
+	}
+	fmt.Fprintf(&g.out, "%v}", strings.Repeat("  ", depth))
+}
+
+// writeType writes the type of a param, declaring an interface for it if needed.
+// Inline types for a param that contains itself are not repeated within it.
+func (g *tsGenerator) writeType(name string, param *Param, depth int) {
+	var elements = make(Params)
+	for childName, child := range param.Children {
+		if _, isIndex := childName.(ListIndex); !isIndex {
+			elements[childName] = child
+		}
+	}
+	var (
+		isList       = param.IsList || param.Type.Elem() != nil
+		declaredType = param.Type
+	)
+	if isList {
+		declaredType = declaredType.Elem()
+	}
+	switch {
+	case len(elements) == 0 && !g.visiting[param]:
+		elemType := tsType(declaredType)
+		if isList && strings.Contains(elemType, "|") {
+			elemType = "(" + elemType + ")"
+		}
+		g.out.WriteString(elemType)
+	case g.visiting[param]:
+		g.out.WriteString("unknown")
+	case g.opts.Inline:
+		g.visiting[param] = true
+		g.writeObject(name, elements, depth)
+		delete(g.visiting, param)
+	default:
+		// A param that contains itself refers to the interface already declared
+		declared, isDeclared := g.declared[param]
+		if !isDeclared {
+			declared = g.uniqueName(name)
+			g.declared[param] = declared
+			g.pending = append(g.pending, tsInterface{name: declared, fields: elements})
+		}
+		g.out.WriteString(declared)
+	}
+	if isList {
+		g.out.WriteString("[]")
+	}
+}
+
+// tsTypes are the TypeScript types of Soy's primitive types
+var tsTypes = map[string]string{
+	"string": "string",
+	"int":    "number",
+	"float":  "number",
+	"number": "number",
+	"bool":   "boolean",
+}
+
+// tsType renders a declared type, with unknown for types that have no
+// TypeScript equivalent, such as unknown (?) or a proto message.
+func tsType(t *ParamType) string {
+	if t == nil {
+		return "unknown"
+	}
+	var out string
+	switch t.Name {
+	case "list":
+		out = tsType(t.Elem())
+		if strings.Contains(out, "|") {
+			out = "(" + out + ")"
+		}
+		out += "[]"
+	case "map":
+		out = "{ [key: string]: unknown }"
+		if len(t.Args) == 2 {
+			out = "{ [key: string]: " + tsType(t.Args[1]) + " }"
+		}
+	case "record":
+		var fields []string
+		for name := range t.Fields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		for i, name := range fields {
+			fields[i] = tsKey(name) + ": " + tsType(t.Fields[name])
+		}
+		out = "{}"
+		if len(fields) > 0 {
+			out = "{ " + strings.Join(fields, "; ") + " }"
+		}
+	case "union":
+		var members []string
+		for _, arg := range t.Args {
+			members = append(members, tsType(arg))
+		}
+		out = strings.Join(members, " | ")
+	default:
+		out = "unknown"
+		if tsPrimitive, isPrimitive := tsTypes[t.Name]; isPrimitive {
+			out = tsPrimitive
+		}
+	}
+	if t.Nullable && out != "unknown" {
+		out += " | null"
+	}
+	return out
+}
+
+// uniqueName returns an interface name that has not been used, adding a
+// numeric suffix to the name if needed.
+func (g *tsGenerator) uniqueName(name string) string {
+	out := name
+	for i := 2; g.names[out]; i++ {
+		out = fmt.Sprintf("%v%d", name, i)
+	}
+	g.names[out] = true
+	return out
+}
+
+// tsKey returns a property name, quoted if it is not a valid identifier.
+func tsKey(name string) string {
+	if tsIdentifier.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// tsTypeName converts a field name to a PascalCase fragment of a type name,
+// so "c_life-about" becomes "CLifeAbout".
+func tsTypeName(name string) string {
+	var out strings.Builder
+	upper := true
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			upper = true
+			continue
+		}
+		if upper {
+			out.WriteString(strings.ToUpper(string(r)))
+			upper = false
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
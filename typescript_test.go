@@ -0,0 +1,123 @@
+package soyusage_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+const typeScriptTemplate = `
+	{namespace test}
+	/**
+	* @param profile
+	* @param key
+	* @param? theme
+	*/
+	{template .main}
+		{$profile.name.first}
+		{$profile['c_life-about']}
+		{if $profile.avatar}{$profile.avatar.url}{/if}
+		{$profile.fields[$key].label}
+		{foreach $link in $profile.links}
+			{$link.url}
+			{$link.title.text}
+		{/foreach}
+		{foreach $tag in $profile.tags}
+			{$tag}
+		{/foreach}
+		{$profile.settings[$key]}
+		{$profile.settings.mode}
+		{if $theme}dark{/if}
+	{/template}
+`
+
+func TestToTypeScript(t *testing.T) {
+	params := analyzeSource(t, typeScriptTemplate)
+	var tests = []struct {
+		name   string
+		golden string
+		opts   soyusage.TSOptions
+	}{
+		{
+			name:   "interfaces",
+			golden: "typescript.d.ts",
+			opts: soyusage.TSOptions{
+				Export: true,
+			},
+		},
+		{
+			name:   "inline",
+			golden: "typescript_inline.d.ts",
+			opts: soyusage.TSOptions{
+				Inline: true,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := soyusage.ToTypeScript(params, "MainParams", test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", test.golden)
+			if *updateGolden {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			must.BeEqual(t, string(expected), got)
+		})
+	}
+}
+
+func TestToTypeScriptInvalidName(t *testing.T) {
+	_, err := soyusage.ToTypeScript(soyusage.Params{}, "main-params", soyusage.TSOptions{})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestToTypeScriptDeclaredTypes(t *testing.T) {
+	params := analyzeTypedSource(t, `
+		{namespace test}
+		/**
+		* @param profile: [name: string, tags: list<string>, age: int|null]
+		* @param items: list<[label: string, count: int|null]>
+		* @param scores: map<string, float>
+		* @param untyped
+		*/
+		{template .main}
+			{$profile.name}
+			{$profile.tags}
+			{$profile.age}
+			{foreach $item in $items}{$item.label}{/foreach}
+			{$items[0]}
+			{$scores}
+			{$untyped}
+		{/template}
+	`)
+	got, err := soyusage.ToTypeScript(params, "Params", soyusage.TSOptions{Inline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, `interface Params {
+  items: {
+    label: string;
+  }[];
+  profile: {
+    age: number | null;
+    name: string;
+    tags: string[];
+  };
+  scores: { [key: string]: number };
+  untyped: unknown;
+}
+`, got)
+}
@@ -1,6 +1,8 @@
 package soyusage
 
 import (
+	"fmt"
+
 	"github.com/robfig/soy/ast"
 )
 
@@ -21,6 +23,15 @@ const (
 	// UsageReference indicates that the parameter was used in a reference,
 	// such as a parameter to a call or assigned to a variable.
 	UsageReference
+	// UsageCSSReference indicates that the parameter was used to build a CSS
+	// class name in a {css} command, or that a CSS class name was referenced.
+	UsageCSSReference
+	// UsageKeys indicates that the keys of a map parameter were used, such as
+	// by iterating over keys($map), which does not require the values.
+	UsageKeys
+	// UsageXIDReference indicates that the parameter was used to build an
+	// identifier in a call to xid, or that an identifier was referenced.
+	UsageXIDReference
 )
 
 // Usage provides details of the manner in which a param was used.
@@ -35,9 +46,29 @@ type (
 		Children Params
 		// Usage describes how this parameter or field was used
 		Usage []Usage
+		// IsList indicates that this parameter was used as a list, by iterating
+		// over it or accessing an element by index. Children of a list describe
+		// the fields of its elements.
+		IsList bool
+		// Type is the type declared for this parameter in the template's SoyDoc,
+		// or the corresponding field type within a declared type.
+		// It is nil if no type was declared.
+		Type *ParamType
 
+		// Whether this param was iterated over, rather than only accessed by index
+		iterated bool
 		// A constant value for this param
 		constant interface{}
+		// Entries of a map literal, keyed by their constant names
+		entries map[string][]*Param
+		// Whether this param was declared optional, or is a field within an optional param
+		optional bool
+		// Whether this param was accessed by a key found from a key expression, such as $m[$k]
+		keyed bool
+		// Whether keys beyond the maximum constant keys were recorded as an unknown key
+		truncated bool
+		// The binding this param stands in for while a template's analysis is recorded
+		origin *paramOrigin
 	}
 
 	// Identifier names a parameter
@@ -48,6 +79,17 @@ type (
 	Name     string
 	MapIndex struct{}
 
+	// ListIndex identifies an element of a list accessed by a constant index.
+	ListIndex int
+
+	// CSSNames is the reserved identifier under which CSS class names referenced
+	// by {css} commands are listed.
+	CSSNames struct{}
+
+	// XIDNames is the reserved identifier under which identifiers referenced
+	// by the xid function are listed.
+	XIDNames struct{}
+
 	// UsageType specifies the manner in which a parameter was used.
 	UsageType int
 
@@ -56,6 +98,10 @@ type (
 		Type UsageType
 		// Template provides the name of the template containing the usage.
 		Template string
+		// Optional indicates that the usage was through a variable derived
+		// from an optional param, so the param may have been null.
+		// This is only set when optional tracking is enabled.
+		Optional bool
 
 		node ast.Node
 	}
@@ -69,21 +115,163 @@ func (MapIndex) String() string {
 	return "[?]"
 }
 
+func (i ListIndex) String() string {
+	return fmt.Sprintf("[%d]", int(i))
+}
+
+func (t UsageType) String() string {
+	switch t {
+	case UsageFull:
+		return "full"
+	case UsageUnknown:
+		return "unknown"
+	case UsageMeta:
+		return "meta"
+	case UsageExists:
+		return "exists"
+	case UsageReference:
+		return "reference"
+	case UsageCSSReference:
+		return "css-reference"
+	case UsageKeys:
+		return "keys"
+	case UsageXIDReference:
+		return "xid-reference"
+	}
+	return "undefined"
+}
+
+func (CSSNames) String() string {
+	return "$css"
+}
+
+func (XIDNames) String() string {
+	return "$xid"
+}
+
 func (p *Param) addUsageToLeaves(usage Usage) {
+	if p.origin != nil {
+		p.origin.record(traceOp{usage: &usage})
+	}
+	p.applyUsageToLeaves(usage)
+}
+
+func (p *Param) applyUsageToLeaves(usage Usage) {
+	if p.isMapLiteral() {
+		for _, entry := range p.allEntries() {
+			entry.addUsageToLeaves(usage)
+		}
+		return
+	}
 	if len(p.Children) == 0 {
-		for _, otherUsage := range p.Usage {
-			if otherUsage.Template == usage.Template &&
-				otherUsage.Type == usage.Type &&
-				otherUsage.node.Position() == usage.node.Position() {
-				return
+		p.appendUsage(usage)
+		return
+	}
+	for _, child := range p.Children {
+		child.applyUsageToLeaves(usage)
+	}
+}
+
+// appendUsage adds a usage to this param, if an equivalent usage has not already been added.
+func (p *Param) appendUsage(usage Usage) {
+	for _, otherUsage := range p.Usage {
+		if otherUsage.Template == usage.Template &&
+			otherUsage.Type == usage.Type &&
+			otherUsage.Optional == usage.Optional &&
+			otherUsage.node.Position() == usage.node.Position() {
+			return
+		}
+	}
+	p.Usage = append(p.Usage, usage)
+}
+
+// subsumeIndexes merges the elements accessed by index into the fields of all
+// elements for every list in a tree that was also iterated over, as iterating
+// uses every element.
+func subsumeIndexes(params Params) {
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		subsumeIndexes(param.Children)
+		if !param.iterated {
+			continue
+		}
+		for _, childName := range sortedNames(param.Children) {
+			if _, isIndex := childName.(ListIndex); isIndex {
+				param.merge(param.Children[childName])
+				delete(param.Children, childName)
 			}
 		}
-		p.Usage = append(p.Usage, usage)
+	}
+}
+
+// merge adds the usage and fields of another param to this param.
+func (p *Param) merge(other *Param) {
+	for _, usage := range other.Usage {
+		p.appendUsage(usage)
+	}
+	for _, name := range sortedNames(other.Children) {
+		if child, exists := p.Children[name]; exists {
+			child.merge(other.Children[name])
+			continue
+		}
+		p.Children[name] = other.Children[name]
+	}
+	p.IsList = p.IsList || other.IsList
+	p.iterated = p.iterated || other.iterated
+	p.keyed = p.keyed || other.keyed
+	p.truncated = p.truncated || other.truncated
+}
+
+// markKeyed records that a param was accessed by a key found from a key
+// expression, so counts towards the maximum constant keys of its parent.
+func (p *Param) markKeyed() {
+	if p.keyed {
 		return
 	}
-	for _, child := range p.Children {
-		child.addUsageToLeaves(usage)
+	if p.origin != nil {
+		p.origin.record(traceOp{keyed: true})
+	}
+	p.keyed = true
+}
+
+// markTruncated records that a key expression found more constant keys for a map
+// than the maximum, so further keys were recorded as an unknown key.
+func (p *Param) markTruncated() {
+	if p.truncated {
+		return
+	}
+	if p.origin != nil {
+		p.origin.record(traceOp{truncated: true})
+	}
+	p.truncated = true
+}
+
+// keyLimitReached returns true iff a param has as many children found from key
+// expressions as the maximum constant keys allows.
+func (p *Param) keyLimitReached(max int) bool {
+	if max < 1 {
+		return false
+	}
+	var keys int
+	for name, child := range p.Children {
+		if _, isName := name.(Name); isName && child.keyed {
+			keys++
+		}
 	}
+	return keys >= max
+}
+
+// markList records that a param was used as a list, and whether
+// it was iterated over, so all of its elements were used.
+func (p *Param) markList(iterated bool) {
+	if p.IsList && (p.iterated || !iterated) {
+		return
+	}
+	if p.origin != nil {
+		p.origin.record(traceOp{list: true, iterated: iterated})
+	}
+	p.IsList = true
+	p.iterated = p.iterated || iterated
 }
 
 func (p *Param) addChild(name Identifier, child *Param) *Param {
@@ -95,7 +283,14 @@ func (p *Param) getChildOrNew(name Identifier) *Param {
 	if child, exists := p.Children[name]; exists {
 		return child
 	}
-	return p.addChild(name, newParam())
+	child := newParam()
+	child.optional = p.optional
+	child.Type = p.Type.field(name)
+	if p.origin != nil {
+		p.origin.record(traceOp{child: name})
+		child.origin = p.origin.child(name)
+	}
+	return p.addChild(name, child)
 }
 
 // Node provides a reference to the AST node where the param was used.
@@ -109,6 +304,19 @@ func (p *Param) isConstant() bool {
 	return p.constant != nil
 }
 
+func (p *Param) isMapLiteral() bool {
+	return p.entries != nil
+}
+
+// allEntries returns the values for every key in a map literal
+func (p *Param) allEntries() []*Param {
+	var out []*Param
+	for _, values := range p.entries {
+		out = append(out, values...)
+	}
+	return out
+}
+
 func newParam() *Param {
 	return &Param{
 		Children: make(Params),
@@ -0,0 +1,259 @@
+package soyusage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DiffUsage compares two usage maps in the form described for FlattenUsage, as
+// read by ParamsFromMap, by the dotted path to each leaf, as Diff does for
+// parameter trees.
+func DiffUsage(old, new map[string]interface{}) (Changes, error) {
+	oldParams, err := ParamsFromMap(old, MapOptions{})
+	if err != nil {
+		return Changes{}, fmt.Errorf("old usage: %v", err)
+	}
+	newParams, err := ParamsFromMap(new, MapOptions{})
+	if err != nil {
+		return Changes{}, fmt.Errorf("new usage: %v", err)
+	}
+	return Diff(oldParams, newParams), nil
+}
+
+// usageStrength orders the leaves of a usage map, so a stronger access implies
+// any weaker one, from unknown usage, which may be anything, down to keys.
+var usageStrength = map[string]int{
+	"k":          1,
+	"c":          2,
+	"x":          2,
+	"e":          3,
+	"m":          4,
+	"~optional~": 5,
+	"*":          6,
+	"?":          7,
+}
+
+// IsSubset returns true iff every access in one usage map is also made in
+// another, with at least as strong a type of access. Both maps are in the form
+// described for FlattenUsage.
+//
+// Access is ordered from unknown usage ("?"), then full ("*"), optional
+// ("~optional~"), meta ("m"), exists ("e"), CSS or xid reference ("c" or "x") and keys ("k").
+// Full, optional or unknown usage of a value includes any access to its fields,
+// as long as that access is not stronger, and an unknown key ("[?]") in the
+// superset includes any constant key in the subset. Any access other than to the
+// whole value is included by access to the fields of that value.
+func IsSubset(subset, superset map[string]interface{}) bool {
+	for key, value := range subset {
+		super, exists := superset[key]
+		if !exists && key != (MapIndex{}).String() {
+			super, exists = superset[(MapIndex{}).String()]
+		}
+		if !exists || !isUsageSubset(value, super) {
+			return false
+		}
+	}
+	return true
+}
+
+func isUsageSubset(subset, superset interface{}) bool {
+	subsetFields, subsetHasFields := usageFields(subset)
+	supersetFields, supersetHasFields := usageFields(superset)
+	switch {
+	case subsetHasFields && supersetHasFields:
+		return IsSubset(subsetFields, supersetFields)
+	case subsetHasFields:
+		// Access to the fields of a value is included in any stronger use of the whole value
+		superLeaf, _ := superset.(string)
+		if !usesContents(superLeaf) {
+			return false
+		}
+		for _, field := range subsetFields {
+			if !isUsageSubset(field, superLeaf) {
+				return false
+			}
+		}
+		return true
+	case supersetHasFields:
+		subLeaf, _ := subset.(string)
+		return !usesContents(subLeaf)
+	}
+	subLeaf, _ := subset.(string)
+	superLeaf, _ := superset.(string)
+	return usageStrength[subLeaf] <= usageStrength[superLeaf]
+}
+
+// usageFields returns the fields of a value in a usage map, and whether it
+// has any, rather than being a leaf.
+func usageFields(value interface{}) (map[string]interface{}, bool) {
+	fields, isMap := value.(map[string]interface{})
+	return fields, isMap && len(fields) > 0
+}
+
+// Severity classifies the impact of a change in usage on the callers of a template.
+type Severity int
+
+const (
+	// SeverityInfo indicates a change that requires no action, as callers
+	// may provide less data
+	SeverityInfo Severity = iota
+	// SeverityWarning indicates a change that callers may need to review
+	SeverityWarning
+	// SeverityBreaking indicates that callers must provide more data
+	SeverityBreaking
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityBreaking:
+		return "breaking"
+	}
+	return "undefined"
+}
+
+// Change is a single classified difference between two usage maps.
+type Change struct {
+	Severity Severity
+	// Path is the dotted path to the changed leaf, or map for a change to its keys
+	Path string
+	// Message describes the change
+	Message string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%v: %v", c.Severity, c.Message)
+}
+
+// ClassifyChanges assigns a severity to each change found by Diff or DiffUsage.
+//
+// A new unconditional access is breaking, as callers must provide more data.
+// An unconditional access becoming conditional is a warning, and the reverse is
+// breaking. New conditional accesses and removed accesses are informational.
+// Other changes to the type of access are compared as for IsSubset, so a stronger
+// access is breaking, or a warning if conditional, and a weaker one informational.
+// Access to fields of a value that was previously used in full, or unknown, is
+// included in that usage, as long as it is not stronger, so is not reported.
+// A map becoming accessed with unknown keys is breaking, as callers may need to
+// provide any key, and the reverse is informational.
+// Changes are listed in descending order of severity, then by path.
+func ClassifyChanges(changes Changes) []Change {
+	var (
+		out     []Change
+		removed = make(map[string]bool)
+	)
+	for _, added := range changes.Added {
+		leaf := changeLeaf(added.New, added.NewOptional)
+		if container, found := removedContainer(changes.Removed, added.Path); found {
+			removed[container.Path] = true
+			containerLeaf := changeLeaf(container.Old, container.OldOptional)
+			if usesContents(containerLeaf) && usageStrength[leaf] <= usageStrength[containerLeaf] {
+				continue
+			}
+		}
+		if isConditionalUsage(leaf) {
+			out = append(out, Change{
+				Severity: SeverityInfo,
+				Path:     added.Path,
+				Message:  fmt.Sprintf("%v is conditionally accessed", added.Path),
+			})
+			continue
+		}
+		out = append(out, Change{
+			Severity: SeverityBreaking,
+			Path:     added.Path,
+			Message:  fmt.Sprintf("%v is required", added.Path),
+		})
+	}
+	for _, change := range changes.Removed {
+		message := fmt.Sprintf("%v is no longer accessed", change.Path)
+		if removed[change.Path] {
+			message = fmt.Sprintf("%v is only accessed by its fields", change.Path)
+		}
+		out = append(out, Change{
+			Severity: SeverityInfo,
+			Path:     change.Path,
+			Message:  message,
+		})
+	}
+	for _, changed := range changes.Changed {
+		var (
+			oldLeaf        = changeLeaf(changed.Old, changed.OldOptional)
+			newLeaf        = changeLeaf(changed.New, changed.NewOptional)
+			oldConditional = isConditionalUsage(oldLeaf)
+			newConditional = isConditionalUsage(newLeaf)
+			change         = Change{
+				Severity: SeverityInfo,
+				Path:     changed.Path,
+				Message: fmt.Sprintf("%v changed from %v to %v", changed.Path,
+					usageKinds(changed.Old, changed.OldOptional),
+					usageKinds(changed.New, changed.NewOptional)),
+			}
+		)
+		switch {
+		case !oldConditional && newConditional:
+			change.Severity = SeverityWarning
+			change.Message = fmt.Sprintf("%v changed from required to conditional", changed.Path)
+		case oldConditional && !newConditional:
+			change.Severity = SeverityBreaking
+			change.Message = fmt.Sprintf("%v changed from conditional to required", changed.Path)
+		case usageStrength[newLeaf] > usageStrength[oldLeaf] && newConditional:
+			change.Severity = SeverityWarning
+		case usageStrength[newLeaf] > usageStrength[oldLeaf]:
+			change.Severity = SeverityBreaking
+		}
+		out = append(out, change)
+	}
+	for _, widened := range changes.Widened {
+		out = append(out, Change{
+			Severity: SeverityBreaking,
+			Path:     widened.Path,
+			Message:  fmt.Sprintf("%v is accessed with unknown keys", widened.Path),
+		})
+	}
+	for _, narrowed := range changes.Narrowed {
+		out = append(out, Change{
+			Severity: SeverityInfo,
+			Path:     narrowed.Path,
+			Message:  fmt.Sprintf("%v is no longer accessed with unknown keys", narrowed.Path),
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Severity != out[j].Severity {
+			return out[i].Severity > out[j].Severity
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// removedContainer returns the removed leaf containing a path, if any, such as
+// "profile" for "profile.name" where profile was previously a leaf.
+func removedContainer(removed []UsageChange, path string) (UsageChange, bool) {
+	for _, change := range removed {
+		if strings.HasPrefix(path, change.Path+".") {
+			return change, true
+		}
+	}
+	return UsageChange{}, false
+}
+
+// changeLeaf returns the strongest of the types of usage on one side of a change,
+// in the form of a leaf of a usage map, ordered as for IsSubset.
+func changeLeaf(usageTypes []UsageType, optional bool) string {
+	var (
+		opts      = MapOptions{}.withDefaults()
+		strongest string
+	)
+	for _, usageType := range usageTypes {
+		leaf := opts.leaf(Usage{Type: usageType, Optional: optional})
+		if leaf != "" && (strongest == "" || usageStrength[leaf] > usageStrength[strongest]) {
+			strongest = leaf
+		}
+	}
+	return strongest
+}
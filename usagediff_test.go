@@ -0,0 +1,319 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestDiffUsage(t *testing.T) {
+	changes, err := soyusage.DiffUsage(
+		map[string]interface{}{
+			"profile": map[string]interface{}{
+				"name":     "*",
+				"nickname": "*",
+				"avatar":   "e",
+			},
+			"category": "*",
+		},
+		map[string]interface{}{
+			"profile": map[string]interface{}{
+				"name":     "*",
+				"nickname": "~optional~",
+				"avatar":   "*",
+				"bio":      "*",
+				"banner":   "e",
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, soyusage.Changes{
+		Added: []soyusage.UsageChange{
+			{Path: "profile.banner", New: []soyusage.UsageType{soyusage.UsageExists}},
+			{Path: "profile.bio", New: []soyusage.UsageType{soyusage.UsageFull}},
+		},
+		Removed: []soyusage.UsageChange{
+			{Path: "category", Old: []soyusage.UsageType{soyusage.UsageFull}},
+		},
+		Changed: []soyusage.UsageChange{
+			{
+				Path: "profile.avatar",
+				Old:  []soyusage.UsageType{soyusage.UsageExists},
+				New:  []soyusage.UsageType{soyusage.UsageFull},
+			},
+			{
+				Path:        "profile.nickname",
+				Old:         []soyusage.UsageType{soyusage.UsageFull},
+				New:         []soyusage.UsageType{soyusage.UsageFull},
+				NewOptional: true,
+			},
+		},
+	}, changes)
+	must.BeEqual(t, `- category (full)
+~ profile.avatar (exists -> full)
++ profile.banner (exists)
++ profile.bio (full)
+~ profile.nickname (full -> optional)`, changes.String())
+
+	var messages []string
+	for _, change := range soyusage.ClassifyChanges(changes) {
+		messages = append(messages, change.String())
+	}
+	must.BeEqual(t, []string{
+		"breaking: profile.avatar changed from conditional to required",
+		"breaking: profile.bio is required",
+		"warning: profile.nickname changed from required to conditional",
+		"info: category is no longer accessed",
+		"info: profile.banner is conditionally accessed",
+	}, messages)
+}
+
+func TestDiffUsageUnchanged(t *testing.T) {
+	usage := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": "*",
+		},
+	}
+	changes, err := soyusage.DiffUsage(usage, usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, true, changes.Empty())
+	must.BeEqual(t, []soyusage.Change(nil), soyusage.ClassifyChanges(changes))
+}
+
+func TestDiffUsageInvalid(t *testing.T) {
+	_, err := soyusage.DiffUsage(
+		map[string]interface{}{"a": "*"},
+		map[string]interface{}{"a": "unexpected"},
+	)
+	must.BeEqual(t, `new usage: a: unknown usage "unexpected"`, err.Error())
+}
+
+func TestClassifyChanges(t *testing.T) {
+	var tests = []struct {
+		name     string
+		old      map[string]interface{}
+		new      map[string]interface{}
+		expected []string
+	}{
+		{
+			name: "fields of a value used in full are contained by it",
+			old:  map[string]interface{}{"a": "*"},
+			new: map[string]interface{}{
+				"a": map[string]interface{}{"b": "*"},
+			},
+			expected: []string{
+				"info: a is only accessed by its fields",
+			},
+		},
+		{
+			name: "fields of a value with unknown usage are contained by it",
+			old:  map[string]interface{}{"a": "?"},
+			new: map[string]interface{}{
+				"a": map[string]interface{}{"b": "*", "c": "e"},
+			},
+			expected: []string{
+				"info: a is only accessed by its fields",
+			},
+		},
+		{
+			name: "fields of a value only checked for existence are required",
+			old:  map[string]interface{}{"a": "e"},
+			new: map[string]interface{}{
+				"a": map[string]interface{}{"b": "*"},
+			},
+			expected: []string{
+				"breaking: a.b is required",
+				"info: a is only accessed by its fields",
+			},
+		},
+		{
+			name: "using a value in full rather than its fields is required",
+			old: map[string]interface{}{
+				"a": map[string]interface{}{"b": "*"},
+			},
+			new: map[string]interface{}{"a": "*"},
+			expected: []string{
+				"breaking: a is required",
+				"info: a.b is no longer accessed",
+			},
+		},
+		{
+			name: "stronger usage is breaking",
+			old:  map[string]interface{}{"a": "k"},
+			new:  map[string]interface{}{"a": "*"},
+			expected: []string{
+				"breaking: a changed from keys to full",
+			},
+		},
+		{
+			name: "weaker usage is informational",
+			old:  map[string]interface{}{"a": "*"},
+			new:  map[string]interface{}{"a": "k"},
+			expected: []string{
+				"info: a changed from full to keys",
+			},
+		},
+		{
+			name: "stronger conditional usage is a warning",
+			old:  map[string]interface{}{"a": "e"},
+			new:  map[string]interface{}{"a": "~optional~"},
+			expected: []string{
+				"warning: a changed from exists to optional",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := soyusage.DiffUsage(test.old, test.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var messages []string
+			for _, change := range soyusage.ClassifyChanges(changes) {
+				messages = append(messages, change.String())
+			}
+			must.BeEqual(t, test.expected, messages)
+		})
+	}
+}
+
+func TestClassifyChangesUnknownKeys(t *testing.T) {
+	changes := soyusage.Diff(
+		analyzeSource(t, diffTemplate(`{$key}{$profile.fields.first}`)),
+		analyzeSource(t, diffTemplate(`{$profile.fields[$key]}`)),
+	)
+	var messages []string
+	for _, change := range soyusage.ClassifyChanges(changes) {
+		messages = append(messages, change.String())
+	}
+	must.BeEqual(t, []string{
+		"breaking: profile.fields is accessed with unknown keys",
+	}, messages)
+}
+
+func TestIsSubset(t *testing.T) {
+	superset := map[string]interface{}{
+		"profile": map[string]interface{}{
+			"name":   "*",
+			"avatar": "e",
+			"links": map[string]interface{}{
+				"[?]": map[string]interface{}{
+					"url": "*",
+				},
+			},
+			"settings": "*",
+		},
+		"items": "m",
+	}
+	var tests = []struct {
+		name     string
+		subset   map[string]interface{}
+		expected bool
+	}{
+		{
+			name:     "empty",
+			subset:   map[string]interface{}{},
+			expected: true,
+		},
+		{
+			name:     "equal",
+			subset:   superset,
+			expected: true,
+		},
+		{
+			name: "fewer fields",
+			subset: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": "*",
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "weaker access",
+			subset: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": "~optional~",
+				},
+				"items": "e",
+			},
+			expected: true,
+		},
+		{
+			name: "stronger access",
+			subset: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"avatar": "*",
+				},
+			},
+			expected: false,
+		},
+		{
+			name: "additional field",
+			subset: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"email": "*",
+				},
+			},
+			expected: false,
+		},
+		{
+			name: "fields of a value used in full",
+			subset: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"settings": map[string]interface{}{
+						"theme": "*",
+						"lang":  "e",
+					},
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "constant key of a map with unknown keys",
+			subset: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"links": map[string]interface{}{
+						"home": map[string]interface{}{
+							"url": "*",
+						},
+					},
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "unknown keys of a map with constant keys",
+			subset: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"[?]": "*",
+				},
+			},
+			expected: false,
+		},
+		{
+			name: "value used in full where only fields are used",
+			subset: map[string]interface{}{
+				"profile": "*",
+			},
+			expected: false,
+		},
+		{
+			name: "existence of a value whose fields are used",
+			subset: map[string]interface{}{
+				"profile": "e",
+			},
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			must.BeEqual(t, test.expected, soyusage.IsSubset(test.subset, superset))
+		})
+	}
+}
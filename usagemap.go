@@ -0,0 +1,278 @@
+package soyusage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MapOptions configures the usage maps produced by Params.ToMap and read by
+// ParamsFromMap. Empty strings are replaced by the defaults given for each field.
+type MapOptions struct {
+	// Full describes full usage. Defaults to "*".
+	Full string
+	// Optional describes full usage of a value derived from an optional param,
+	// when optional tracking is enabled. Defaults to "~optional~".
+	Optional string
+	// Unknown describes unknown usage. Defaults to "?".
+	Unknown string
+	// Exists describes an existence check. Defaults to "e".
+	Exists string
+	// Meta describes usage of a meta property, such as the length of a list.
+	// Defaults to "m".
+	Meta string
+	// CSSReference describes usage in a CSS class name. Defaults to "c".
+	CSSReference string
+	// Keys describes usage of only the keys of a map. Defaults to "k".
+	Keys string
+	// XIDReference describes usage in an identifier passed to xid. Defaults to "x".
+	XIDReference string
+	// UnknownKey is the key for a map accessed with unknown keys. Defaults to "[?]".
+	UnknownKey string
+	// ListKey is the key for the fields of list elements when WrapLists is
+	// set. Defaults to "[]".
+	ListKey string
+
+	// MergeExists describes existence checks as full usage, rather than separately
+	MergeExists bool
+	// WrapLists nests the fields of the elements of a list under ListKey,
+	// alongside any elements accessed by index, such as "[0]".
+	WrapLists bool
+}
+
+func (o MapOptions) withDefaults() MapOptions {
+	defaults := []struct {
+		value    *string
+		fallback string
+	}{
+		{&o.Full, "*"},
+		{&o.Optional, "~optional~"},
+		{&o.Unknown, "?"},
+		{&o.Exists, "e"},
+		{&o.Meta, "m"},
+		{&o.CSSReference, "c"},
+		{&o.Keys, "k"},
+		{&o.XIDReference, "x"},
+		{&o.UnknownKey, MapIndex{}.String()},
+		{&o.ListKey, "[]"},
+	}
+	for _, d := range defaults {
+		if *d.value == "" {
+			*d.value = d.fallback
+		}
+	}
+	if o.MergeExists {
+		o.Exists = o.Full
+	}
+	return o
+}
+
+// mapUsagePrecedence orders the types of usage, so a leaf with several types of
+// usage is described by the one with the highest precedence.
+var mapUsagePrecedence = map[UsageType]int{
+	UsageKeys:         1,
+	UsageCSSReference: 2,
+	UsageXIDReference: 2,
+	UsageExists:       3,
+	UsageMeta:         4,
+	UsageFull:         5,
+	UsageUnknown:      6,
+}
+
+// ToMap renders a parameter tree as nested maps, keyed by the names of params,
+// as used by FlattenUsage and for test fixtures.
+//
+// Each param with children is a map of its children, and each leaf is a string
+// describing its usage. Where a leaf has several types of usage, the one with the
+// highest precedence is given, in order from unknown, full, meta, exists, CSS
+// reference and keys. Full or unknown usage of a param with children replaces its
+// children. References are not described, so a leaf only used as a reference is
+// an empty map. A param that contains itself is not repeated within itself.
+//
+// For example, {"profile": {"name": "*", "[?]": "e"}} describes the printing of
+// $profile.name, and an existence check on $profile[$key].
+func (p Params) ToMap(opts MapOptions) map[string]interface{} {
+	return paramsToMap(p, opts.withDefaults(), make(map[*Param]bool))
+}
+
+func paramsToMap(params Params, opts MapOptions, visiting map[*Param]bool) map[string]interface{} {
+	var out = make(map[string]interface{})
+	for name, param := range params {
+		if visiting[param] {
+			continue
+		}
+		visiting[param] = true
+		out[mapKey(name, opts)] = paramToMap(param, opts, visiting)
+		delete(visiting, param)
+	}
+	return out
+}
+
+func paramToMap(param *Param, opts MapOptions, visiting map[*Param]bool) interface{} {
+	var value interface{} = paramsToMap(param.Children, opts, visiting)
+	if opts.WrapLists && param.IsList && len(param.Children) > 0 {
+		var (
+			elements = make(Params)
+			list     = make(map[string]interface{})
+		)
+		for name, child := range param.Children {
+			if _, isIndex := name.(ListIndex); isIndex {
+				list[name.String()] = paramToMap(child, opts, visiting)
+				continue
+			}
+			elements[name] = child
+		}
+		if len(elements) > 0 {
+			list[opts.ListKey] = paramsToMap(elements, opts, visiting)
+		}
+		value = list
+	}
+
+	precedence := 0
+	for _, usage := range param.Usage {
+		leaf := opts.leaf(usage)
+		if leaf == "" {
+			continue
+		}
+		if len(param.Children) > 0 && usage.Type != UsageFull && usage.Type != UsageUnknown {
+			continue
+		}
+		// Later usage of the same type takes precedence
+		if mapUsagePrecedence[usage.Type] >= precedence {
+			value = leaf
+			precedence = mapUsagePrecedence[usage.Type]
+		}
+	}
+	return value
+}
+
+// leaf returns the string describing a usage in a usage map, or an empty string
+// for usage that is not described, such as a reference.
+func (o MapOptions) leaf(usage Usage) string {
+	switch usage.Type {
+	case UsageFull:
+		if usage.Optional {
+			return o.Optional
+		}
+		return o.Full
+	case UsageUnknown:
+		return o.Unknown
+	case UsageMeta:
+		return o.Meta
+	case UsageExists:
+		return o.Exists
+	case UsageCSSReference:
+		return o.CSSReference
+	case UsageKeys:
+		return o.Keys
+	case UsageXIDReference:
+		return o.XIDReference
+	}
+	return ""
+}
+
+func mapKey(name Identifier, opts MapOptions) string {
+	if _, isIndex := name.(MapIndex); isIndex {
+		return opts.UnknownKey
+	}
+	return name.String()
+}
+
+// ParamsFromMap reads a parameter tree from nested maps in the form produced by
+// Params.ToMap with the same options, such as a test fixture or golden file.
+//
+// The usage read has no template or location. Where MergeExists is set, leaves
+// are read as full usage.
+func ParamsFromMap(usage map[string]interface{}, opts MapOptions) (Params, error) {
+	opts = opts.withDefaults()
+	root := newParam()
+	if err := readUsageMap(root, usage, opts, ""); err != nil {
+		return nil, err
+	}
+	return root.Children, nil
+}
+
+func readUsageMap(parent *Param, usage map[string]interface{}, opts MapOptions, path string) error {
+	var keys []string
+	for key := range usage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		var param *Param
+		switch {
+		case opts.WrapLists && key == opts.ListKey:
+			parent.IsList = true
+			param = parent
+		case key == opts.UnknownKey:
+			param = parent.getChildOrNew(MapIndex{})
+		default:
+			name := parseIdentifier(key)
+			if _, isIndex := name.(ListIndex); isIndex {
+				parent.IsList = true
+			}
+			param = parent.getChildOrNew(name)
+		}
+		switch value := usage[key].(type) {
+		case map[string]interface{}:
+			if err := readUsageMap(param, value, opts, keyPath); err != nil {
+				return err
+			}
+		case string:
+			leaf, err := usageFromMap(value, opts)
+			if err != nil {
+				return fmt.Errorf("%v: %v", keyPath, err)
+			}
+			param.Usage = append(param.Usage, leaf)
+		default:
+			return fmt.Errorf("%v: unexpected usage value of type %T", keyPath, value)
+		}
+	}
+	return nil
+}
+
+func usageFromMap(value string, opts MapOptions) (Usage, error) {
+	switch value {
+	case opts.Full:
+		return Usage{Type: UsageFull}, nil
+	case opts.Optional:
+		return Usage{Type: UsageFull, Optional: true}, nil
+	case opts.Unknown:
+		return Usage{Type: UsageUnknown}, nil
+	case opts.Exists:
+		return Usage{Type: UsageExists}, nil
+	case opts.Meta:
+		return Usage{Type: UsageMeta}, nil
+	case opts.CSSReference:
+		return Usage{Type: UsageCSSReference}, nil
+	case opts.Keys:
+		return Usage{Type: UsageKeys}, nil
+	case opts.XIDReference:
+		return Usage{Type: UsageXIDReference}, nil
+	}
+	return Usage{}, fmt.Errorf("unknown usage %q", value)
+}
+
+// parseIdentifier returns the identifier whose string form is key, such as
+// MapIndex for "[?]" or ListIndex(2) for "[2]".
+func parseIdentifier(key string) Identifier {
+	switch key {
+	case MapIndex{}.String():
+		return MapIndex{}
+	case CSSNames{}.String():
+		return CSSNames{}
+	case XIDNames{}.String():
+		return XIDNames{}
+	}
+	if strings.HasPrefix(key, "[") && strings.HasSuffix(key, "]") {
+		if index, err := strconv.Atoi(key[1 : len(key)-1]); err == nil {
+			return ListIndex(index)
+		}
+	}
+	return Name(key)
+}
@@ -0,0 +1,142 @@
+package soyusage_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+// usageMapTemplate uses fields of a param in each of the ways rendered in a usage map.
+const usageMapTemplate = `
+	{namespace test}
+	/**
+	* @param profile
+	* @param key
+	*/
+	{template .main}
+		{$profile.name}
+		{if $profile.avatar}shown{/if}
+		{$profile.fields[$key].label}
+		{foreach $link in $profile.links}
+			{$link.url}
+		{/foreach}
+		{$profile.friends[0].name}
+		{myFunc($profile.settings)}
+	{/template}
+`
+
+func TestParamsToMap(t *testing.T) {
+	params := analyzeSource(t, usageMapTemplate)
+	var tests = []struct {
+		name     string
+		opts     soyusage.MapOptions
+		expected map[string]interface{}
+	}{
+		{
+			name: "defaults",
+			expected: map[string]interface{}{
+				"key": "*",
+				"profile": map[string]interface{}{
+					"name":   "*",
+					"avatar": "e",
+					"fields": map[string]interface{}{
+						"[?]": map[string]interface{}{
+							"label": "*",
+						},
+					},
+					"links": map[string]interface{}{
+						"url": "*",
+					},
+					"friends": map[string]interface{}{
+						"[0]": map[string]interface{}{
+							"name": "*",
+						},
+					},
+					"settings": "?",
+				},
+			},
+		},
+		{
+			name: "custom sentinels with wrapped lists and merged exists",
+			opts: soyusage.MapOptions{
+				Full:        "full",
+				Unknown:     "unknown",
+				UnknownKey:  "*",
+				ListKey:     "items",
+				MergeExists: true,
+				WrapLists:   true,
+			},
+			expected: map[string]interface{}{
+				"key": "full",
+				"profile": map[string]interface{}{
+					"name":   "full",
+					"avatar": "full",
+					"fields": map[string]interface{}{
+						"*": map[string]interface{}{
+							"label": "full",
+						},
+					},
+					"links": map[string]interface{}{
+						"items": map[string]interface{}{
+							"url": "full",
+						},
+					},
+					"friends": map[string]interface{}{
+						"[0]": map[string]interface{}{
+							"name": "full",
+						},
+					},
+					"settings": "unknown",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendered := params.ToMap(test.opts)
+			must.BeEqual(t, test.expected, rendered)
+
+			read, err := soyusage.ParamsFromMap(rendered, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			must.BeEqual(t, rendered, read.ToMap(test.opts))
+		})
+	}
+}
+
+func TestParamsFromMap(t *testing.T) {
+	params, err := soyusage.ParamsFromMap(map[string]interface{}{
+		"items": map[string]interface{}{
+			"[]": map[string]interface{}{
+				"title": "~optional~",
+			},
+			"[2]": "m",
+		},
+		"$css": map[string]interface{}{
+			"[?]": "c",
+		},
+	}, soyusage.MapOptions{WrapLists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := params[soyusage.Name("items")]
+	must.BeEqual(t, true, items.IsList)
+	must.BeEqual(t, []soyusage.Usage{{Type: soyusage.UsageFull, Optional: true}}, items.Children[soyusage.Name("title")].Usage)
+	must.BeEqual(t, []soyusage.Usage{{Type: soyusage.UsageMeta}}, items.Children[soyusage.ListIndex(2)].Usage)
+	must.BeEqual(t, []soyusage.Usage{{Type: soyusage.UsageCSSReference}}, params[soyusage.CSSNames{}].Children[soyusage.MapIndex{}].Usage)
+
+	_, err = soyusage.ParamsFromMap(map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": "everything",
+		},
+	}, soyusage.MapOptions{})
+	must.BeEqualErrors(t, errors.New(`a.b: unknown usage "everything"`), err)
+
+	_, err = soyusage.ParamsFromMap(map[string]interface{}{
+		"a": 1,
+	}, soyusage.MapOptions{})
+	must.BeEqualErrors(t, errors.New("a: unexpected usage value of type int"), err)
+}
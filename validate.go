@@ -0,0 +1,122 @@
+package soyusage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/robfig/soy/data"
+)
+
+// ValidationError describes a field required by a template that is missing
+// from, or null in, the data to be rendered.
+type ValidationError struct {
+	// Path identifies the field, such as "profile.links[2].url"
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidateData checks that data, such as a decoded JSON object, provides every
+// field required by an analysis result.
+//
+// A field is required if it is used other than by an existence check, or if it
+// contains a required field. Fields that are checked for existence, such as by
+// {if $field}, are treated as optional, but their contents are validated when
+// present. Fields accessed through a map index that could not be determined ([?])
+// are skipped, as are usages marked Optional when optional tracking is enabled.
+// Each element of a list is validated against the fields used within the list,
+// or only the elements accessed by constant index if the list is not iterated.
+func ValidateData(in map[string]interface{}, params Params) []ValidationError {
+	return validateMap(data.New(in), params, "")
+}
+
+func validateMap(in data.Value, params Params, path string) []ValidationError {
+	var (
+		out      []ValidationError
+		inMap, _ = in.(data.Map)
+	)
+	for _, name := range sortedNames(params) {
+		if name == (MapIndex{}) || name == (CSSNames{}) || name == (XIDNames{}) {
+			continue
+		}
+		fieldPath := name.String()
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+		out = append(out, validateParam(inMap[name.String()], params[name], fieldPath)...)
+	}
+	return out
+}
+
+func validateParam(in data.Value, param *Param, path string) []ValidationError {
+	switch v := in.(type) {
+	case nil:
+		if isRequired(param) {
+			return []ValidationError{{Path: path, Message: "required field is missing"}}
+		}
+		return nil
+	case data.Null, data.Undefined:
+		if isRequired(param) {
+			return []ValidationError{{Path: path, Message: "required field is null"}}
+		}
+		return nil
+	case data.List:
+		var out []ValidationError
+		if indexes, onlyIndexes := indexedElements(param); onlyIndexes {
+			for _, index := range sortedIndexes(indexes) {
+				var value data.Value
+				if index < len(v) {
+					value = v[index]
+				}
+				out = append(out, validateParam(value, indexes[index], fmt.Sprintf("%s[%d]", path, index))...)
+			}
+			return out
+		}
+		for index, value := range v {
+			out = append(out, validateParam(value, param, fmt.Sprintf("%s[%d]", path, index))...)
+		}
+		return out
+	}
+	if len(param.Children) == 0 {
+		return nil
+	}
+	if _, isMap := in.(data.Map); !isMap {
+		return []ValidationError{{Path: path, Message: fmt.Sprintf("expected a map, got %T", in)}}
+	}
+	return validateMap(in, param.Children, path)
+}
+
+// isRequired returns true iff a param is not checked for existence, and is either
+// used or contains a required field.
+func isRequired(param *Param) bool {
+	var used bool
+	for _, usage := range param.Usage {
+		if usage.Type == UsageExists {
+			return false
+		}
+		if !usage.Optional {
+			used = true
+		}
+	}
+	if used {
+		return true
+	}
+	for name, child := range param.Children {
+		if name != (MapIndex{}) && isRequired(child) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedIndexes(indexes map[int]*Param) []int {
+	var out = make([]int, 0, len(indexes))
+	for index := range indexes {
+		out = append(out, index)
+	}
+	sort.Ints(out)
+	return out
+}
@@ -0,0 +1,86 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestValidateData(t *testing.T) {
+	const template = `
+		{namespace test}
+		/**
+		* @param profile
+		* @param links
+		* @param banner
+		* @param key
+		*/
+		{template .main}
+			{$profile.name}
+			{if $profile.nickname}{$profile.nickname}{/if}
+			{$profile.fields[$key]}
+			{foreach $link in $links}
+				<a href="{$link.url}">{$link.label}</a>
+			{/foreach}
+			{if $banner}shown{/if}
+		{/template}
+	`
+	var tests = []struct {
+		name     string
+		in       map[string]interface{}
+		expected []string
+	}{
+		{
+			name: "all required fields present",
+			in: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name":   "Name",
+					"fields": map[string]interface{}{},
+				},
+				"links": []interface{}{
+					map[string]interface{}{"url": "/a", "label": "A"},
+				},
+				"key": "a",
+			},
+		},
+		{
+			name: "missing and null fields",
+			in: map[string]interface{}{
+				"profile": map[string]interface{}{
+					"name": nil,
+				},
+				"links": []interface{}{
+					map[string]interface{}{"url": "/a", "label": "A"},
+					map[string]interface{}{"url": "/b"},
+				},
+			},
+			expected: []string{
+				"key: required field is missing",
+				"links[1].label: required field is missing",
+				"profile.name: required field is null",
+			},
+		},
+		{
+			name: "scalar in place of map",
+			in: map[string]interface{}{
+				"profile": "Name",
+				"links":   []interface{}{},
+				"key":     "a",
+			},
+			expected: []string{
+				"profile: expected a map, got data.String",
+			},
+		},
+	}
+	params := analyzeSource(t, template)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, err := range soyusage.ValidateData(test.in, params) {
+				got = append(got, err.Error())
+			}
+			must.BeEqual(t, test.expected, got)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package soyusage
+
+import "github.com/robfig/soy/ast"
+
+// walkNodes calls visit for a node and all of its descendants, depth first.
+func walkNodes(node ast.Node, visit func(ast.Node)) {
+	if node == nil {
+		return
+	}
+	visit(node)
+	if parent, isParent := node.(ast.ParentNode); isParent {
+		for _, child := range parent.Children() {
+			walkNodes(child, visit)
+		}
+	}
+}
+
+// referencesVariable returns true iff the node contains a data ref to the
+// named variable.
+func referencesVariable(node ast.Node, name string) bool {
+	var found bool
+	walkNodes(node, func(node ast.Node) {
+		if dataRef, isDataRef := node.(*ast.DataRefNode); isDataRef && dataRef.Key == name {
+			found = true
+		}
+	})
+	return found
+}
@@ -0,0 +1,110 @@
+package soyusage
+
+import "sort"
+
+// WalkUsage calls fn for each leaf in a parameter tree, with the path of names
+// from the root to the leaf, and each distinct type of usage of that leaf.
+//
+// Leaves are visited depth first, in order of their names. A param that contains
+// itself is not visited again, so a cyclic tree will not loop forever.
+func WalkUsage(params Params, fn func(path []string, usageType UsageType)) {
+	walkUsage(params, nil, make(map[*Param]bool), fn)
+}
+
+func walkUsage(params Params, path []string, visiting map[*Param]bool, fn func([]string, UsageType)) {
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		if visiting[param] {
+			continue
+		}
+		paramPath := append(path[:len(path):len(path)], name.String())
+		if len(param.Children) > 0 {
+			visiting[param] = true
+			walkUsage(param.Children, paramPath, visiting, fn)
+			delete(visiting, param)
+			continue
+		}
+		for _, usageType := range usageTypes(param) {
+			fn(paramPath, usageType)
+		}
+	}
+}
+
+// usageTypes returns the distinct types of usage of a param, in order.
+func usageTypes(param *Param) []UsageType {
+	var (
+		out  []UsageType
+		seen = make(map[UsageType]bool)
+	)
+	for _, usage := range param.Usage {
+		if !seen[usage.Type] {
+			seen[usage.Type] = true
+			out = append(out, usage.Type)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// Walk calls fn for each param in a tree, with the path of names from the root to
+// the param, such as ["profile", "[?]", "label"]. Params are visited depth first,
+// in order of their names, with each param before its children. If fn returns
+// false, the children of that param are not visited.
+//
+// The param gives the usage of the node and where it was found, and whether it
+// is a list. A map accessed with unknown keys has a child named "[?]". A param
+// that contains itself is not visited again, so a cyclic tree will not loop forever.
+func (p Params) Walk(fn func(path []string, param *Param) bool) {
+	walkParams(p, nil, make(map[*Param]bool), fn)
+}
+
+func walkParams(params Params, path []string, visiting map[*Param]bool, fn func([]string, *Param) bool) {
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		if visiting[param] {
+			continue
+		}
+		paramPath := append(path[:len(path):len(path)], name.String())
+		if !fn(paramPath, param) {
+			continue
+		}
+		visiting[param] = true
+		walkParams(param.Children, paramPath, visiting, fn)
+		delete(visiting, param)
+	}
+}
+
+// Transform returns a copy of a tree with each param rewritten by fn, leaving
+// the original tree unchanged.
+//
+// Params are transformed from the leaves up, so fn is called with a copy of each
+// param whose children have already been transformed, and may modify and return
+// it, return a different param, or return nil to drop the param from the tree.
+// For example, params with only existence checks could be dropped, followed by
+// any params left without children or usage. A param that contains itself is
+// not copied within itself.
+func (p Params) Transform(fn func(path []string, param *Param) *Param) Params {
+	return transformParams(p, nil, make(map[*Param]bool), fn)
+}
+
+func transformParams(params Params, path []string, visiting map[*Param]bool, fn func([]string, *Param) *Param) Params {
+	var out = make(Params)
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		if visiting[param] {
+			continue
+		}
+		paramPath := append(path[:len(path):len(path)], name.String())
+		visiting[param] = true
+		copied := *param
+		copied.Children = transformParams(param.Children, paramPath, visiting, fn)
+		copied.Usage = append([]Usage(nil), param.Usage...)
+		delete(visiting, param)
+		if transformed := fn(paramPath, &copied); transformed != nil {
+			out[name] = transformed
+		}
+	}
+	return out
+}
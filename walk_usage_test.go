@@ -0,0 +1,158 @@
+package soyusage_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestWalkUsage(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param profile
+		* @param items
+		* @param key
+		*/
+		{template .main}
+			{if $profile.name}{$profile.name}{/if}
+			{$profile.fields[$key]}
+			{length($items)}
+		{/template}
+	`)
+	var got []string
+	soyusage.WalkUsage(params, func(path []string, usageType soyusage.UsageType) {
+		got = append(got, fmt.Sprintf("%s:%d", strings.Join(path, "."), usageType))
+	})
+	must.BeEqual(t, []string{
+		fmt.Sprintf("items:%d", soyusage.UsageMeta),
+		fmt.Sprintf("key:%d", soyusage.UsageFull),
+		fmt.Sprintf("profile.fields.[?]:%d", soyusage.UsageFull),
+		fmt.Sprintf("profile.name:%d", soyusage.UsageFull),
+		fmt.Sprintf("profile.name:%d", soyusage.UsageExists),
+	}, got)
+}
+
+func TestWalkUsageCycle(t *testing.T) {
+	leaf := &soyusage.Param{
+		Usage: []soyusage.Usage{{Type: soyusage.UsageFull}},
+	}
+	root := &soyusage.Param{
+		Children: soyusage.Params{
+			soyusage.Name("leaf"): leaf,
+		},
+	}
+	root.Children[soyusage.Name("self")] = root
+
+	var got []string
+	soyusage.WalkUsage(soyusage.Params{soyusage.Name("root"): root}, func(path []string, usageType soyusage.UsageType) {
+		got = append(got, strings.Join(path, "."))
+	})
+	must.BeEqual(t, []string{"root.leaf"}, got)
+}
+
+// walkTemplate uses fields of a param in each of the ways visited by a walk.
+const walkTemplate = `
+	{namespace test}
+	/**
+	* @param profile
+	* @param key
+	*/
+	{template .main}
+		{$profile.name}
+		{if $profile.avatar}shown{/if}
+		{if $profile.address.city}shown{/if}
+		{$profile.fields[$key].label}
+		{foreach $link in $profile.links}
+			{$link.url}
+		{/foreach}
+	{/template}
+`
+
+func TestParamsWalk(t *testing.T) {
+	params := analyzeSource(t, walkTemplate)
+	var got []string
+	params.Walk(func(path []string, param *soyusage.Param) bool {
+		description := strings.Join(path, ".")
+		if param.IsList {
+			description += " (list)"
+		}
+		for _, usage := range param.Usage {
+			description += fmt.Sprintf(" %v@%v", usage.Type, usage.Template)
+		}
+		got = append(got, description)
+		// Prune the fields accessed with unknown keys
+		return path[len(path)-1] != "fields"
+	})
+	must.BeEqual(t, []string{
+		"key full@test.main",
+		"profile",
+		"profile.address",
+		"profile.address.city exists@test.main",
+		"profile.avatar exists@test.main",
+		"profile.fields",
+		"profile.links (list) reference@test.main",
+		"profile.links.url full@test.main",
+		"profile.name full@test.main",
+	}, got)
+}
+
+func TestParamsWalkCycle(t *testing.T) {
+	root := &soyusage.Param{
+		Children: soyusage.Params{},
+	}
+	root.Children[soyusage.Name("self")] = root
+
+	var got []string
+	soyusage.Params{soyusage.Name("root"): root}.Walk(func(path []string, param *soyusage.Param) bool {
+		got = append(got, strings.Join(path, "."))
+		return true
+	})
+	must.BeEqual(t, []string{"root"}, got)
+}
+
+func TestParamsTransform(t *testing.T) {
+	params := analyzeSource(t, walkTemplate)
+	original := mapUsage(params)
+
+	// Strip everything with only exists usage, and any maps left empty
+	stripped := params.Transform(func(path []string, param *soyusage.Param) *soyusage.Param {
+		if len(param.Children) > 0 {
+			return param
+		}
+		for _, usage := range param.Usage {
+			if usage.Type != soyusage.UsageExists {
+				return param
+			}
+		}
+		return nil
+	})
+	must.BeEqual(t, map[string]interface{}{
+		"key": "*",
+		"profile": map[string]interface{}{
+			"name": "*",
+			"fields": map[string]interface{}{
+				"[?]": map[string]interface{}{
+					"label": "*",
+				},
+			},
+			"links": map[string]interface{}{
+				"url": "*",
+			},
+		},
+	}, mapUsage(stripped))
+	must.BeEqual(t, true, stripped[soyusage.Name("profile")].Children[soyusage.Name("links")].IsList)
+
+	// Rewriting usage does not modify the original tree
+	rewritten := params.Transform(func(path []string, param *soyusage.Param) *soyusage.Param {
+		for i := range param.Usage {
+			param.Usage[i].Type = soyusage.UsageUnknown
+		}
+		return param
+	})
+	must.BeEqual(t, "?", mapUsage(rewritten)["key"])
+	must.BeEqual(t, original, mapUsage(params))
+}
@@ -0,0 +1,82 @@
+package soyusage
+
+import (
+	"fmt"
+
+	"github.com/robfig/soy/ast"
+)
+
+// WarningCode identifies the kind of situation a Warning describes.
+type WarningCode string
+
+const (
+	// WarningMissingTemplate indicates that a called template could not be found.
+	// All params passed to the call are given unknown usage.
+	WarningMissingTemplate WarningCode = "missing-template"
+	// WarningNonListIteration indicates that a foreach loop iterated over
+	// a value that is not a list, such as a map literal.
+	WarningNonListIteration WarningCode = "non-list-iteration"
+	// WarningUnrecognisedParamAttribute indicates that a param of a call had an
+	// attribute that does not apply to it, and was ignored.
+	WarningUnrecognisedParamAttribute WarningCode = "unrecognised-param-attribute"
+	// WarningUnusedParam indicates that a declared param was never used
+	// by the template or any template it calls.
+	WarningUnusedParam WarningCode = "unused-param"
+	// WarningTruncatedKeys indicates that a map was accessed with more constant
+	// keys than the configured maximum, and the remaining keys were recorded as [?].
+	WarningTruncatedKeys WarningCode = "truncated-keys"
+)
+
+// Warning describes a situation that does not prevent analysis, but may
+// affect the accuracy of the result.
+type Warning struct {
+	// Code identifies the kind of warning
+	Code WarningCode
+	// Message describes the warning
+	Message string
+	// Template is the name of the template being analyzed
+	Template string
+	// File is the soy file containing the template
+	File string
+	// Line is the line number of the relevant node within File
+	Line int
+	// Col is the column of the relevant node within Line
+	Col int
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%v:%d:%d in template %v: %v (%v)", w.File, w.Line, w.Col, w.Template, w.Message, w.Code)
+}
+
+// Warnings sets a handler to be called for each warning found during analysis
+func Warnings(handler func(Warning)) Option {
+	return func(c Config) Config {
+		c.WarningHandler = handler
+		return c
+	}
+}
+
+// warn reports a warning to the configured handler, if any.
+func (s *scope) warn(node ast.Node, code WarningCode, message string, args ...interface{}) {
+	if s.trace == nil && s.config.WarningHandler == nil {
+		return
+	}
+	s.emitWarning(Warning{
+		Code:     code,
+		Message:  fmt.Sprintf(message, args...),
+		Template: s.templateName,
+		File:     s.registry.Filename(s.templateName),
+		Line:     s.registry.LineNumber(s.templateName, node),
+		Col:      s.registry.ColNumber(s.templateName, node),
+	})
+}
+
+func (s *scope) emitWarning(warning Warning) {
+	if s.trace != nil {
+		s.trace.warnings = append(s.trace.warnings, warning)
+		return
+	}
+	if s.config.WarningHandler != nil {
+		s.config.WarningHandler(warning)
+	}
+}
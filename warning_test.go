@@ -0,0 +1,204 @@
+package soyusage_test
+
+import (
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestWarnings(t *testing.T) {
+	var tests = []struct {
+		name             string
+		template         string
+		expectedCodes    []soyusage.WarningCode
+		expectedUsage    map[string]interface{}
+		expectedMessages []string
+	}{
+		{
+			name: "no warnings",
+			template: `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{$a.b}
+				{/template}
+			`,
+			expectedUsage: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": "*",
+				},
+			},
+		},
+		{
+			name: "missing call target",
+			template: `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				* @param c
+				*/
+				{template .main}
+					{call .missing}
+						{param x: $a.x/}
+						{param y}{$b}{/param}
+					{/call}
+					{call .missing data="$c"/}
+				{/template}
+			`,
+			expectedCodes: []soyusage.WarningCode{
+				soyusage.WarningMissingTemplate,
+				soyusage.WarningMissingTemplate,
+			},
+			expectedMessages: []string{
+				"template not found: test.missing",
+				"template not found: test.missing",
+			},
+			expectedUsage: map[string]interface{}{
+				"a": map[string]interface{}{
+					"x": "?",
+				},
+				"b": "*",
+				"c": "?",
+			},
+		},
+		{
+			name: "unused param",
+			template: `
+				{namespace test}
+				/**
+				* @param a
+				* @param? b
+				*/
+				{template .main}
+				{/template}
+			`,
+			expectedCodes: []soyusage.WarningCode{
+				soyusage.WarningUnusedParam,
+				soyusage.WarningUnusedParam,
+			},
+			expectedMessages: []string{
+				"param a is never used",
+				"param b is never used",
+			},
+			expectedUsage: map[string]interface{}{
+				"a": map[string]interface{}{},
+			},
+		},
+		{
+			name: "param used only by augmentMap",
+			template: `
+				{namespace test}
+				/**
+				* @param a
+				* @param b
+				*/
+				{template .main}
+					{let $merged: augmentMap($a, $b)/}
+					{$merged.key}
+				{/template}
+			`,
+			expectedUsage: map[string]interface{}{
+				"a": map[string]interface{}{
+					"key": "*",
+				},
+				"b": map[string]interface{}{
+					"key": "*",
+				},
+			},
+		},
+		{
+			name: "unrecognised param attributes",
+			template: `
+				{namespace test}
+				/**
+				* @param a
+				*/
+				{template .main}
+					{call .callee}
+						{param x key="y" kind="text"}{$a.b}{/param}
+						{param key="z" value="$a.c" kind="text"/}
+					{/call}
+				{/template}
+
+				/**
+				* @param x
+				* @param z
+				*/
+				{template .callee}
+					{$x}{$z}
+				{/template}
+			`,
+			expectedCodes: []soyusage.WarningCode{
+				soyusage.WarningUnrecognisedParamAttribute,
+				soyusage.WarningUnrecognisedParamAttribute,
+			},
+			expectedMessages: []string{
+				"unrecognised attribute key on param x",
+				"unrecognised attribute kind on param z",
+			},
+			expectedUsage: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": "*",
+					"c": "*",
+				},
+			},
+		},
+		{
+			name: "iterating over a map literal",
+			template: `
+				{namespace test}
+				{template .main}
+					{let $m: ['a': 1]/}
+					{foreach $item in $m}
+						{$item}
+					{/foreach}
+				{/template}
+			`,
+			expectedCodes: []soyusage.WarningCode{
+				soyusage.WarningNonListIteration,
+			},
+			expectedMessages: []string{
+				"iterating over a map literal: $m",
+			},
+			expectedUsage: map[string]interface{}{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Build the registry directly to avoid the compile-time checks for
+			// missing templates.
+			tree, err := parse.SoyFile("test.soy", test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			registry := &template.Registry{}
+			if err := registry.Add(tree); err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				codes    []soyusage.WarningCode
+				messages []string
+			)
+			got, err := soyusage.AnalyzeTemplate("test.main", registry, soyusage.Warnings(func(w soyusage.Warning) {
+				codes = append(codes, w.Code)
+				messages = append(messages, w.Message)
+				if w.Template != "test.main" || w.File != "test.soy" || w.Line == 0 {
+					t.Errorf("position not populated: %v", w)
+				}
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			must.BeEqual(t, test.expectedCodes, codes)
+			must.BeEqual(t, test.expectedMessages, messages)
+			must.BeEqual(t, test.expectedUsage, mapUsage(got))
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package soyusage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ToYAML converts a usage map into a YAML document, with a mapping for each
+// param with children and sorted keys.
+//
+// The usage map is in the form described for FlattenUsage. Strings are always
+// quoted, so usage values such as "*" and "?" are preserved rather than being
+// read as YAML syntax.
+func ToYAML(usage map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if len(usage) == 0 {
+		buf.WriteString("{}\n")
+		return buf.Bytes(), nil
+	}
+	if err := writeYAMLMap(&buf, usage, 0, ""); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeYAMLMap(buf *bytes.Buffer, usage map[string]interface{}, depth int, path string) error {
+	var names []string
+	for name := range usage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indent := strings.Repeat("  ", depth)
+	for _, name := range names {
+		childPath := name
+		if path != "" {
+			childPath = path + "." + name
+		}
+		fmt.Fprintf(buf, "%v%v:", indent, yamlKey(name))
+		switch value := usage[name].(type) {
+		case map[string]interface{}:
+			if len(value) == 0 {
+				buf.WriteString(" {}\n")
+				continue
+			}
+			buf.WriteString("\n")
+			if err := writeYAMLMap(buf, value, depth+1, childPath); err != nil {
+				return err
+			}
+		case string:
+			fmt.Fprintf(buf, " %v\n", strconv.Quote(value))
+		default:
+			return fmt.Errorf("%v: unexpected usage value of type %T", childPath, value)
+		}
+	}
+	return nil
+}
+
+// yamlKey returns a mapping key, quoted unless it only contains characters
+// that cannot be read as YAML syntax.
+func yamlKey(name string) string {
+	if name == "" {
+		return `""`
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case (r >= '0' && r <= '9') || r == '-' || r == '.':
+			if i == 0 {
+				return strconv.Quote(name)
+			}
+		default:
+			return strconv.Quote(name)
+		}
+	}
+	switch strings.ToLower(name) {
+	case "true", "false", "yes", "no", "on", "off", "null", "y", "n":
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// YAMLOption configures the output of WriteYAML.
+type YAMLOption func(*yamlConfig)
+
+type yamlConfig struct {
+	templateComments bool
+}
+
+// YAMLTemplateComments enables or disables a comment on each usage, listing the
+// templates the usage was found in, where known.
+func YAMLTemplateComments(enabled bool) YAMLOption {
+	return func(c *yamlConfig) {
+		c.templateComments = enabled
+	}
+}
+
+const (
+	// yamlListKey is the key for the elements of a list
+	yamlListKey = "[]"
+	// yamlUsageKey is the key for the usage of a param that also has children
+	yamlUsageKey = "$usage"
+	// yamlOptional describes full usage of an optional param
+	yamlOptional = "optional"
+)
+
+// WriteYAML writes a parameter tree as a YAML document for review, with sorted
+// keys and the usage of each param as a readable scalar, such as "full" or
+// "exists", or a sequence where there are several types of usage.
+//
+// The fields of a param used as a list are nested under "[]", alongside elements
+// accessed by index, such as "[0]". Where a param with children also has usage of
+// its own, it is listed under "$usage". References, where a param is passed on
+// to be used elsewhere, are not listed. A param that contains itself is not
+// repeated within itself. The document can be read back with ReadYAML.
+func WriteYAML(w io.Writer, usage Params, opts ...YAMLOption) error {
+	var cfg yamlConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var buf bytes.Buffer
+	if len(usage) == 0 {
+		buf.WriteString("{}\n")
+	}
+	writeYAMLParams(&buf, usage, 0, cfg, make(map[*Param]bool))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeYAMLParams(buf *bytes.Buffer, params Params, depth int, cfg yamlConfig, visiting map[*Param]bool) {
+	for _, name := range sortedNames(params) {
+		param := params[name]
+		if visiting[param] {
+			continue
+		}
+		visiting[param] = true
+		writeYAMLParam(buf, name.String(), param, depth, cfg, visiting)
+		delete(visiting, param)
+	}
+}
+
+func writeYAMLParam(buf *bytes.Buffer, key string, param *Param, depth int, cfg yamlConfig, visiting map[*Param]bool) {
+	indent := strings.Repeat("  ", depth)
+	if param.IsList {
+		var (
+			element = &Param{Children: make(Params), Usage: param.Usage}
+			indexes = make(Params)
+		)
+		for name, child := range param.Children {
+			if _, isIndex := name.(ListIndex); isIndex {
+				indexes[name] = child
+				continue
+			}
+			element.Children[name] = child
+		}
+		fmt.Fprintf(buf, "%v%v:\n", indent, yamlKey(key))
+		writeYAMLParam(buf, yamlListKey, element, depth+1, cfg, visiting)
+		writeYAMLParams(buf, indexes, depth+1, cfg, visiting)
+		return
+	}
+	var usages []Usage
+	for _, usage := range param.Usage {
+		if usage.Type != UsageReference {
+			usages = append(usages, usage)
+		}
+	}
+	if len(param.Children) == 0 {
+		fmt.Fprintf(buf, "%v%v: %v\n", indent, yamlKey(key), yamlUsage(usages, cfg))
+		return
+	}
+	fmt.Fprintf(buf, "%v%v:\n", indent, yamlKey(key))
+	if len(usages) > 0 {
+		fmt.Fprintf(buf, "%v  %v: %v\n", indent, yamlKey(yamlUsageKey), yamlUsage(usages, cfg))
+	}
+	writeYAMLParams(buf, param.Children, depth+1, cfg, visiting)
+}
+
+// yamlUsage describes a list of usages as a scalar, or a flow sequence if there
+// are several types of usage, followed by a comment listing templates if enabled.
+func yamlUsage(usages []Usage, cfg yamlConfig) string {
+	var (
+		names     []string
+		templates []string
+		seen      = make(map[string]bool)
+	)
+	for _, usage := range usages {
+		name := usage.Type.String()
+		if usage.Type == UsageFull && usage.Optional {
+			name = yamlOptional
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		if usage.Template != "" && !seen["#"+usage.Template] {
+			seen["#"+usage.Template] = true
+			templates = append(templates, usage.Template)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(templates)
+
+	var out string
+	switch len(names) {
+	case 0:
+		out = "{}"
+	case 1:
+		out = names[0]
+	default:
+		out = "[" + strings.Join(names, ", ") + "]"
+	}
+	if cfg.templateComments && len(templates) > 0 {
+		out += " # " + strings.Join(templates, ", ")
+	}
+	return out
+}
+
+// ReadYAML reads a parameter tree from a YAML document written by WriteYAML.
+//
+// Comments are ignored, so the templates and locations of usages are not restored.
+func ReadYAML(r io.Reader) (Params, error) {
+	type level struct {
+		indent int
+		param  *Param
+	}
+	var (
+		root    = newParam()
+		stack   = []level{{indent: -1, param: root}}
+		scanner = bufio.NewScanner(r)
+		lineNum int
+		// expectChildren is set when the previous line opened a mapping
+		expectChildren bool
+	)
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		content := strings.TrimLeft(line, " ")
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if lineNum == 1 && strings.TrimSpace(content) == "{}" {
+			continue
+		}
+		indent := len(line) - len(content)
+		if expectChildren && indent <= stack[len(stack)-1].indent {
+			return nil, fmt.Errorf("line %d: expected fields of the previous key", lineNum)
+		}
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1].param
+
+		key, value, err := parseYAMLLine(content)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		var target *Param
+		switch key {
+		case yamlUsageKey:
+			usage, err := parseYAMLUsage(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			parent.Usage = append(parent.Usage, usage...)
+			expectChildren = false
+			continue
+		case yamlListKey:
+			parent.IsList = true
+			target = parent
+		default:
+			target = newParam()
+			parent.Children[parseIdentifier(key)] = target
+		}
+		if value == "" {
+			stack = append(stack, level{indent: indent, param: target})
+			expectChildren = true
+			continue
+		}
+		expectChildren = false
+		usage, err := parseYAMLUsage(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		target.Usage = append(target.Usage, usage...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if expectChildren {
+		return nil, fmt.Errorf("line %d: expected fields of the previous key", lineNum)
+	}
+	return root.Children, nil
+}
+
+// parseYAMLLine splits a line into its key and value, with any comment removed.
+func parseYAMLLine(content string) (key string, value string, err error) {
+	if strings.HasPrefix(content, `"`) {
+		end := 1
+		for ; end < len(content); end++ {
+			if content[end] == '\\' {
+				end++
+				continue
+			}
+			if content[end] == '"' {
+				break
+			}
+		}
+		if end >= len(content) {
+			return "", "", fmt.Errorf("unterminated key: %v", content)
+		}
+		if key, err = strconv.Unquote(content[:end+1]); err != nil {
+			return "", "", fmt.Errorf("invalid key: %v", content)
+		}
+		content = content[end+1:]
+	} else {
+		colon := strings.Index(content, ":")
+		if colon < 0 {
+			return "", "", fmt.Errorf("expected a key: %v", content)
+		}
+		key = content[:colon]
+		content = content[colon:]
+	}
+	if !strings.HasPrefix(content, ":") {
+		return "", "", fmt.Errorf("expected ':' after key %q", key)
+	}
+	value = content[1:]
+	if comment := strings.Index(value, "#"); comment >= 0 {
+		value = value[:comment]
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
+// parseYAMLUsage reads the usages described by a scalar or flow sequence.
+func parseYAMLUsage(value string) ([]Usage, error) {
+	if value == "{}" {
+		return nil, nil
+	}
+	names := []string{value}
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		names = strings.Split(value[1:len(value)-1], ",")
+	}
+	var out []Usage
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == yamlOptional {
+			out = append(out, Usage{Type: UsageFull, Optional: true})
+			continue
+		}
+		usageType, err := parseUsageType(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Usage{Type: usageType})
+	}
+	return out, nil
+}
+
+func parseUsageType(name string) (UsageType, error) {
+	for _, usageType := range []UsageType{
+		UsageFull,
+		UsageUnknown,
+		UsageMeta,
+		UsageExists,
+		UsageReference,
+		UsageCSSReference,
+		UsageKeys,
+		UsageXIDReference,
+	} {
+		if usageType.String() == name {
+			return usageType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown usage type: %q", name)
+}
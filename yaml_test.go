@@ -0,0 +1,183 @@
+package soyusage_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/theothertomelliott/must"
+	"github.com/theothertomelliott/soyusage"
+)
+
+func TestToYAML(t *testing.T) {
+	params := analyzeSource(t, `
+		{namespace test}
+		/**
+		* @param profile
+		* @param key
+		*/
+		{template .main}
+			{$profile.name}
+			{if $profile.avatar}shown{/if}
+			{$profile.fields[$key].label}
+			{myFunc($profile.true)}
+		{/template}
+	`)
+	got, err := soyusage.ToYAML(mapUsage(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, `key: "*"
+profile:
+  avatar: "e"
+  fields:
+    "[?]":
+      label: "*"
+  name: "*"
+  "true": "?"
+`, string(got))
+}
+
+func TestToYAMLEmpty(t *testing.T) {
+	got, err := soyusage.ToYAML(map[string]interface{}{
+		"a": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, "a: {}\n", string(got))
+
+	got, err = soyusage.ToYAML(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, "{}\n", string(got))
+}
+
+func TestToYAMLUnexpectedValue(t *testing.T) {
+	_, err := soyusage.ToYAML(map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": 1,
+		},
+	})
+	must.BeEqualErrors(t, errors.New("a.b: unexpected usage value of type int"), err)
+}
+
+const writeYAMLTemplate = `
+	{namespace test}
+	/**
+	* @param profile
+	* @param key
+	*/
+	{template .main}
+		{$profile.name}
+		{if $profile.name}shown{/if}
+		{$profile.fields[$key].label}
+		{foreach $link in $profile.links}
+			{$link.url}
+		{/foreach}
+		{$profile.friends[0].name}
+		{call .details}
+			{param avatar: $profile.avatar /}
+		{/call}
+	{/template}
+
+	/**
+	* @param avatar
+	*/
+	{template .details}
+		{if $avatar}{$avatar}{/if}
+	{/template}
+`
+
+func TestWriteYAML(t *testing.T) {
+	params := analyzeSource(t, writeYAMLTemplate)
+
+	var buf bytes.Buffer
+	if err := soyusage.WriteYAML(&buf, params, soyusage.YAMLTemplateComments(true)); err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, `key: full # test.main
+profile:
+  avatar: [exists, full] # test.details
+  fields:
+    "[?]":
+      label: full # test.main
+  friends:
+    "[]": {}
+    "[0]":
+      name: full # test.main
+  links:
+    "[]":
+      url: full # test.main
+  name: [exists, full] # test.main
+`, buf.String())
+
+	read, err := soyusage.ReadYAML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, soyusage.FlattenUsage(mapUsageWithLists(params)), soyusage.FlattenUsage(mapUsageWithLists(read)))
+
+	// Writing the tree that was read gives the same document, without comments
+	var rewritten, uncommented bytes.Buffer
+	if err := soyusage.WriteYAML(&rewritten, read); err != nil {
+		t.Fatal(err)
+	}
+	if err := soyusage.WriteYAML(&uncommented, params); err != nil {
+		t.Fatal(err)
+	}
+	must.BeEqual(t, uncommented.String(), rewritten.String())
+}
+
+func TestReadYAML(t *testing.T) {
+	params, err := soyusage.ReadYAML(strings.NewReader(`# Usage of test.main
+items:
+  "[]":
+    "$usage": meta
+    title: optional
+  "[2]": {}
+"$css":
+  "[?]": css-reference
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := params[soyusage.Name("items")]
+	must.BeEqual(t, true, items.IsList)
+	must.BeEqual(t, []soyusage.Usage{{Type: soyusage.UsageMeta}}, items.Usage)
+	must.BeEqual(t, []soyusage.Usage{{Type: soyusage.UsageFull, Optional: true}}, items.Children[soyusage.Name("title")].Usage)
+	must.BeEqual(t, 0, len(items.Children[soyusage.ListIndex(2)].Usage))
+	must.BeEqual(t, []soyusage.Usage{{Type: soyusage.UsageCSSReference}}, params[soyusage.CSSNames{}].Children[soyusage.MapIndex{}].Usage)
+}
+
+func TestReadYAMLErrors(t *testing.T) {
+	var tests = []struct {
+		name     string
+		document string
+		expected error
+	}{
+		{
+			name:     "unknown usage",
+			document: "a:\n  b: everything\n",
+			expected: errors.New(`line 2: unknown usage type: "everything"`),
+		},
+		{
+			name:     "missing fields",
+			document: "a:\nb: full\n",
+			expected: errors.New("line 2: expected fields of the previous key"),
+		},
+		{
+			name:     "missing key",
+			document: "a: full\n- b\n",
+			expected: errors.New("line 2: expected a key: - b"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := soyusage.ReadYAML(strings.NewReader(test.document))
+			must.BeEqualErrors(t, test.expected, err)
+		})
+	}
+}